@@ -0,0 +1,80 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric/protos/common"
+)
+
+// ChainBlockSource ...
+/**
+ * The ChainBlockSource reads blocks from the ledger of a chain's peers
+ * through the query system chaincode. It is the BlockSource used by
+ * durable subscriptions (see events.NewDurableSubscription) to replay
+ * the blocks of the chain they missed.
+ */
+type ChainBlockSource struct {
+	chain Chain
+}
+
+// NewChainBlockSource ...
+/**
+ * Returns a ChainBlockSource reading the blocks of chain. The chain's user
+ * context must be allowed to query the ledger of its peers.
+ */
+func NewChainBlockSource(chain Chain) (*ChainBlockSource, error) {
+	if chain == nil {
+		return nil, fmt.Errorf("chain is nil")
+	}
+	return &ChainBlockSource{chain: chain}, nil
+}
+
+// GetBlockHeight ...
+/**
+ * Returns the number of blocks in the chain's ledger.
+ */
+func (s *ChainBlockSource) GetBlockHeight() (uint64, error) {
+	info, err := s.chain.QueryInfo()
+	if err != nil {
+		return 0, err
+	}
+	return info.Height, nil
+}
+
+// GetBlock ...
+/**
+ * Returns the block with the given number from the chain's ledger.
+ */
+func (s *ChainBlockSource) GetBlock(number uint64) (*common.Block, error) {
+	if number > math.MaxInt32 {
+		return nil, fmt.Errorf("Block number %d is out of range", number)
+	}
+	block, err := s.chain.QueryBlock(int(number))
+	if err != nil {
+		return nil, err
+	}
+	if block.Header == nil || block.Header.Number != number {
+		return nil, fmt.Errorf("Ledger returned the wrong block for block number %d", number)
+	}
+	return block, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protos_utils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// ledgerPeer answers query system chaincode proposals from a list of blocks
+type ledgerPeer struct {
+	mockPeer
+	chainID string
+	blocks  []*common.Block
+}
+
+func (p *ledgerPeer) SendProposal(signedProposal *pb.SignedProposal) (*pb.ProposalResponse, error) {
+	proposal, err := protos_utils.GetProposal(signedProposal.ProposalBytes)
+	if err != nil {
+		return nil, err
+	}
+	ccis, err := protos_utils.GetChaincodeInvocationSpec(proposal)
+	if err != nil {
+		return nil, err
+	}
+	args := ccis.ChaincodeSpec.Input.Args
+	if ccis.ChaincodeSpec.ChaincodeId.Name != "qscc" || len(args) < 2 || string(args[1]) != p.chainID {
+		return errorResponse("unexpected proposal"), nil
+	}
+
+	var message proto.Message
+	switch string(args[0]) {
+	case "GetChainInfo":
+		message = &common.BlockchainInfo{Height: uint64(len(p.blocks))}
+	case "GetBlockByNumber":
+		number, err := strconv.Atoi(string(args[2]))
+		if err != nil || number >= len(p.blocks) {
+			return errorResponse(fmt.Sprintf("block %s not found", args[2])), nil
+		}
+		message = p.blocks[number]
+	default:
+		return errorResponse("unknown function"), nil
+	}
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ProposalResponse{Response: &pb.Response{Status: 200, Payload: payload}}, nil
+}
+
+func errorResponse(message string) *pb.ProposalResponse {
+	return &pb.ProposalResponse{Response: &pb.Response{Status: 500, Message: message}}
+}
+
+func TestChainBlockSource(t *testing.T) {
+	chain, err := setupTestChain()
+	if err != nil {
+		t.Fatalf("Failed to create chain: %s", err)
+	}
+	peer := &ledgerPeer{mockPeer: mockPeer{MockURL: "ledger"}, chainID: "testChain"}
+	for i := 0; i < 3; i++ {
+		peer.blocks = append(peer.blocks, &common.Block{Header: &common.BlockHeader{Number: uint64(i)}})
+	}
+	chain.AddPeer(peer)
+
+	if _, err := NewChainBlockSource(nil); err == nil {
+		t.Fatalf("NewChainBlockSource should fail without chain")
+	}
+	source, err := NewChainBlockSource(chain)
+	if err != nil {
+		t.Fatalf("NewChainBlockSource return error: %s", err)
+	}
+	height, err := source.GetBlockHeight()
+	if err != nil || height != 3 {
+		t.Fatalf("GetBlockHeight should return 3, got %d: %v", height, err)
+	}
+	block, err := source.GetBlock(2)
+	if err != nil || block.Header.Number != 2 {
+		t.Fatalf("GetBlock should return block 2, got %v: %v", block, err)
+	}
+	if _, err := source.GetBlock(3); err == nil {
+		t.Fatalf("GetBlock should fail for a block beyond the height")
+	}
+
+	// the ledger must return the requested block
+	peer.blocks[1].Header.Number = 5
+	if _, err := source.GetBlock(1); err == nil {
+		t.Fatalf("GetBlock should fail when the ledger returns the wrong block")
+	}
+}
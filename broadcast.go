@@ -0,0 +1,226 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hyperledger/fabric/protos/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/hyperledger/fabric-sdk-go/retry"
+)
+
+// BroadcastError ...
+/**
+ * The error of a broadcast that the orderer answered with a status other
+ * than SUCCESS.
+ */
+type BroadcastError struct {
+	Status common.Status
+}
+
+func (e *BroadcastError) Error() string {
+	return fmt.Sprintf("broadcast response is not success : %v", e.Status)
+}
+
+// Code ...
+/**
+ * Returns the gRPC code of the status, for retry policies: Unavailable if
+ * the orderer can't take transactions for now, e.g. during a leader
+ * election, else Unknown.
+ */
+func (e *BroadcastError) Code() codes.Code {
+	if e.Status == common.Status_SERVICE_UNAVAILABLE {
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
+// BroadcastOutcome ...
+/**
+ * The outcome of sending a transaction to the orderers.
+ */
+type BroadcastOutcome struct {
+	// Strategy is the name of the strategy that chose the orderers
+	Strategy string
+	// Orderer is the URL of the orderer that accepted the transaction,
+	// empty if none did
+	Orderer string
+	// Status is SUCCESS if an orderer accepted the transaction, else the
+	// status of the last orderer that responded, UNKNOWN if none did
+	Status common.Status
+	// Responses are those of the orderers the transaction was sent to, in
+	// the order of the strategy
+	Responses []*TransactionResponse
+}
+
+// BroadcastStrategy ...
+/**
+ * A BroadcastStrategy chooses the orderers that transactions are sent to.
+ * Name identifies the strategy in the broadcast outcome.
+ * Orderers returns the orderers to send to, among orderers ordered by URL.
+ * If Failover is true, the orderers are tried in turn until one accepts
+ * the transaction, else the transaction is sent to all of them at once.
+ */
+type BroadcastStrategy interface {
+	Name() string
+	Orderers(orderers []Orderer) []Orderer
+	Failover() bool
+}
+
+// Names of the broadcast strategies
+const (
+	BroadcastToAll     = "all"
+	RoundRobinFailover = "round-robin-failover"
+	PriorityFailover   = "priority-failover"
+)
+
+type broadcastToAllStrategy struct{}
+
+// NewBroadcastToAllStrategy ...
+/**
+ * Returns the default BroadcastStrategy, which sends transactions to all
+ * orderers at once. The broadcast fails if all orderers fail.
+ */
+func NewBroadcastToAllStrategy() BroadcastStrategy {
+	return &broadcastToAllStrategy{}
+}
+
+func (s *broadcastToAllStrategy) Name() string {
+	return BroadcastToAll
+}
+
+func (s *broadcastToAllStrategy) Orderers(orderers []Orderer) []Orderer {
+	return orderers
+}
+
+func (s *broadcastToAllStrategy) Failover() bool {
+	return false
+}
+
+type roundRobinFailoverStrategy struct {
+	mtx  sync.Mutex
+	next int
+}
+
+// NewRoundRobinFailoverStrategy ...
+/**
+ * Returns a BroadcastStrategy that sends each transaction to one orderer,
+ * starting with the next orderer at each transaction, and fails over to
+ * the following ones on error.
+ */
+func NewRoundRobinFailoverStrategy() BroadcastStrategy {
+	return &roundRobinFailoverStrategy{}
+}
+
+func (s *roundRobinFailoverStrategy) Name() string {
+	return RoundRobinFailover
+}
+
+func (s *roundRobinFailoverStrategy) Orderers(orderers []Orderer) []Orderer {
+	s.mtx.Lock()
+	next := s.next
+	s.next++
+	s.mtx.Unlock()
+
+	var ordered []Orderer
+	for i := range orderers {
+		ordered = append(ordered, orderers[(next+i)%len(orderers)])
+	}
+	return ordered
+}
+
+func (s *roundRobinFailoverStrategy) Failover() bool {
+	return true
+}
+
+type priorityFailoverStrategy struct {
+	priorities map[string]int
+}
+
+// NewPriorityFailoverStrategy ...
+/**
+ * Returns a BroadcastStrategy that sends each transaction to one orderer,
+ * in the order of urls, and fails over to the next ones on error. Orderers
+ * that aren't listed are tried last.
+ * @param {[]string} urls The orderer URLs, highest priority first
+ */
+func NewPriorityFailoverStrategy(urls ...string) BroadcastStrategy {
+	priorities := make(map[string]int)
+	for i, url := range urls {
+		if _, ok := priorities[url]; !ok {
+			priorities[url] = i
+		}
+	}
+	return &priorityFailoverStrategy{priorities: priorities}
+}
+
+func (s *priorityFailoverStrategy) Name() string {
+	return PriorityFailover
+}
+
+func (s *priorityFailoverStrategy) Orderers(orderers []Orderer) []Orderer {
+	ordered := append([]Orderer{}, orderers...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, iok := s.priorities[ordered[i].GetURL()]
+		pj, jok := s.priorities[ordered[j].GetURL()]
+		return iok && (!jok || pi < pj)
+	})
+	return ordered
+}
+
+func (s *priorityFailoverStrategy) Failover() bool {
+	return true
+}
+
+// getBroadcastStatus returns the status of a broadcast that returned err
+func getBroadcastStatus(err error) common.Status {
+	if err == nil {
+		return common.Status_SUCCESS
+	}
+	if broadcastErr, ok := err.(*BroadcastError); ok {
+		return broadcastErr.Status
+	}
+	return common.Status_UNKNOWN
+}
+
+// isFailoverStatus returns whether a broadcast that failed with status
+// should be sent to another orderer. Transactions rejected as invalid
+// would be rejected by the other orderers too.
+func isFailoverStatus(status common.Status) bool {
+	switch status {
+	case common.Status_BAD_REQUEST, common.Status_FORBIDDEN, common.Status_REQUEST_ENTITY_TOO_LARGE:
+		return false
+	}
+	return true
+}
+
+// isRetryableBroadcastError returns whether policy retries a broadcast
+// that failed with err
+func isRetryableBroadcastError(policy *retry.Policy, err error) bool {
+	if broadcastErr, ok := err.(*BroadcastError); ok {
+		return policy.IsRetryable(grpc.Errorf(broadcastErr.Code(), "%s", broadcastErr))
+	}
+	return policy.IsRetryable(err)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/protos/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/hyperledger/fabric-sdk-go/retry"
+)
+
+func TestBroadcastFailover(t *testing.T) {
+	testChain := setupBroadcastTestChain(t)
+	down := &mockOrderer{MockURL: "orderer1", MockError: grpc.Errorf(codes.Unavailable, "connection refused")}
+	testChain.AddOrderer(down)
+	testChain.AddOrderer(&mockOrderer{MockURL: "orderer2"})
+	testChain.AddOrderer(&mockOrderer{MockURL: "orderer3"})
+	testChain.SetBroadcastStrategy(NewRoundRobinFailoverStrategy())
+
+	outcome, err := testChain.SendSignedTransaction(&common.Envelope{})
+	if err != nil {
+		t.Fatalf("SendSignedTransaction return error: %s", err)
+	}
+	if outcome.Strategy != RoundRobinFailover || outcome.Orderer != "orderer2" || outcome.Status != common.Status_SUCCESS {
+		t.Fatalf("The transaction should fail over to orderer2, got %v", outcome)
+	}
+	if len(outcome.Responses) != 2 || outcome.Responses[0].Err == nil || outcome.Responses[0].Status != common.Status_UNKNOWN {
+		t.Fatalf("The outcome should hold the failed and the successful broadcast, got %v", outcome.Responses)
+	}
+	for _, expected := range []string{"orderer2", "orderer3"} {
+		outcome, _ = testChain.SendSignedTransaction(&common.Envelope{})
+		if outcome.Orderer != expected || len(outcome.Responses) != 1 {
+			t.Fatalf("The transaction should be sent to %s only, got %v", expected, outcome.Responses)
+		}
+	}
+
+	// rejected transactions aren't sent to another orderer
+	testChain.AddOrderer(&mockOrderer{MockURL: "orderer4", MockError: &BroadcastError{Status: common.Status_BAD_REQUEST}})
+	testChain.SetBroadcastStrategy(NewPriorityFailoverStrategy("orderer4", "orderer1"))
+	outcome, err = testChain.SendSignedTransaction(&common.Envelope{})
+	if err == nil || outcome == nil {
+		t.Fatalf("A rejected transaction should fail")
+	}
+	if outcome.Status != common.Status_BAD_REQUEST || outcome.Orderer != "" || len(outcome.Responses) != 1 {
+		t.Fatalf("The outcome should carry the BAD_REQUEST status, got %v", outcome)
+	}
+
+	down.MockError = &BroadcastError{Status: common.Status_SERVICE_UNAVAILABLE}
+	testChain.RemoveOrderer(&mockOrderer{MockURL: "orderer4"})
+	testChain.SetBroadcastStrategy(NewPriorityFailoverStrategy("orderer3", "orderer1"))
+	outcome, _ = testChain.SendSignedTransaction(&common.Envelope{})
+	if outcome.Orderer != "orderer3" || len(outcome.Responses) != 1 {
+		t.Fatalf("The transaction should be sent to the first orderer, got %v", outcome.Responses)
+	}
+	testChain.SetBroadcastStrategy(NewPriorityFailoverStrategy("orderer1"))
+	outcome, _ = testChain.SendSignedTransaction(&common.Envelope{})
+	if outcome.Orderer != "orderer2" || outcome.Responses[0].Status != common.Status_SERVICE_UNAVAILABLE {
+		t.Fatalf("The transaction should fail over to the unlisted orderers, got %v", outcome.Responses)
+	}
+}
+
+func TestBroadcastToAll(t *testing.T) {
+	testChain := setupBroadcastTestChain(t)
+	if testChain.GetBroadcastStrategy().Name() != BroadcastToAll {
+		t.Fatalf("Transactions should be sent to all orderers by default")
+	}
+	testChain.AddOrderer(&mockOrderer{MockURL: "orderer1", MockError: &BroadcastError{Status: common.Status_FORBIDDEN}})
+	testChain.AddOrderer(&mockOrderer{MockURL: "orderer2"})
+
+	outcome, err := testChain.SendSignedTransaction(&common.Envelope{})
+	if err != nil {
+		t.Fatalf("The broadcast should succeed if an orderer accepts the transaction: %s", err)
+	}
+	if len(outcome.Responses) != 2 || outcome.Orderer != "orderer2" || outcome.Responses[0].Status != common.Status_FORBIDDEN {
+		t.Fatalf("The outcome should hold the responses of both orderers, got %v", outcome.Responses)
+	}
+
+	testChain.RemoveOrderer(&mockOrderer{MockURL: "orderer2"})
+	testChain.AddOrderer(&mockOrderer{MockURL: "orderer2", MockError: grpc.Errorf(codes.Unavailable, "connection refused")})
+	outcome, err = testChain.SendSignedTransaction(&common.Envelope{})
+	if err == nil || err.Error() != "Broadcast failed: Received error from all configured orderers" {
+		t.Fatalf("The broadcast should fail if all orderers fail, got %v", err)
+	}
+	if outcome.Status != common.Status_FORBIDDEN {
+		t.Fatalf("The outcome should carry the status of the orderer that responded, got %v", outcome.Status)
+	}
+}
+
+func TestBroadcastRetry(t *testing.T) {
+	policy := retry.DefaultPolicy()
+	if !isRetryableBroadcastError(policy, &BroadcastError{Status: common.Status_SERVICE_UNAVAILABLE}) {
+		t.Fatalf("SERVICE_UNAVAILABLE should be retryable")
+	}
+	if isRetryableBroadcastError(policy, &BroadcastError{Status: common.Status_BAD_REQUEST}) {
+		t.Fatalf("BAD_REQUEST shouldn't be retryable")
+	}
+	if !isRetryableBroadcastError(policy, grpc.Errorf(codes.Unavailable, "connection refused")) {
+		t.Fatalf("Unavailable errors should be retryable")
+	}
+}
+
+func setupBroadcastTestChain(t *testing.T) Chain {
+	client := NewClient()
+	client.SetRetryPolicy(retry.NoRetry())
+	testChain, err := NewChain("testChain", client)
+	if err != nil {
+		t.Fatalf("NewChain return error: %s", err)
+	}
+	return testChain
+}
@@ -21,10 +21,13 @@ package fabricsdk
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/hyperledger/fabric/bccsp"
 	"github.com/hyperledger/fabric/core/crypto/primitives"
 	msp "github.com/hyperledger/fabric/msp"
 	"github.com/hyperledger/fabric/protos/common"
@@ -34,10 +37,19 @@ import (
 	"github.com/op/go-logging"
 
 	config "github.com/hyperledger/fabric-sdk-go/config"
+	"github.com/hyperledger/fabric-sdk-go/retry"
 )
 
 var logger = logging.MustGetLogger("fabric_sdk_go")
 
+// tcertSignerExpiry is how long the TCert identity of a proposal is kept
+// for its transaction. Proposals that are only queried, or never turned
+// into a transaction, are forgotten after it.
+const tcertSignerExpiry = 10 * time.Minute
+
+// queryChaincode is the system chaincode answering ledger queries
+const queryChaincode = "qscc"
+
 // Chain ...
 /**
  * The “Chain” object captures settings for a channel, which is created by
@@ -52,6 +64,8 @@ type Chain interface {
 	IsSecurityEnabled() bool
 	GetTCertBatchSize() int
 	SetTCertBatchSize(batchSize int)
+	IsTCertEnabled() bool
+	SetTCertEnabled(enabled bool)
 	AddPeer(peer Peer)
 	RemovePeer(peer Peer)
 	GetPeers() []Peer
@@ -61,24 +75,56 @@ type Chain interface {
 	InitializeChain() bool
 	UpdateChain() bool
 	IsReadonly() bool
-	QueryInfo()
-	QueryBlock(blockNumber int)
+	QueryInfo() (*common.BlockchainInfo, error)
+	QueryBlock(blockNumber int) (*common.Block, error)
 	QueryTransaction(transactionID int)
 	CreateTransactionProposal(chaincodeName string, chainID string, args []string, sign bool, transientData map[string][]byte) (*pb.SignedProposal, *pb.Proposal, string, error)
+	CreateTransactionProposalAsUser(user User, chaincodeName string, chainID string, args []string, sign bool, transientData map[string][]byte) (*pb.SignedProposal, *pb.Proposal, string, error)
+	CreateChaincodeProposal(user User, request *ChaincodeInvokeRequest) (*pb.SignedProposal, *pb.Proposal, string, error)
 	SendTransactionProposal(signedProposal *pb.SignedProposal, retry int) (map[string]*TransactionProposalResponse, error)
+	SendTransactionProposalWithPolicy(signedProposal *pb.SignedProposal, policy *retry.Policy) (map[string]*TransactionProposalResponse, error)
+	SetEndorserSelector(selector EndorserSelector)
+	GetEndorserSelector() EndorserSelector
+	GetEndorserHealth() map[string]EndorserHealth
 	CreateInvocationTransaction(chaincodeName string, chainID string, args []string, transientData map[string][]byte) (*common.Envelope, string, error)
+	CreateInvocationTransactionAsUser(user User, chaincodeName string, chainID string, args []string, transientData map[string][]byte) (*common.Envelope, string, error)
+	CreateChaincodeInvocationTransaction(user User, request *ChaincodeInvokeRequest) (*common.Envelope, string, error)
 	SendInvocationTransaction(envelope *common.Envelope) error
 	CreateTransaction(proposal *pb.Proposal, resps []*pb.ProposalResponse) (*pb.Transaction, error)
-	SendTransaction(proposal *pb.Proposal, tx *pb.Transaction) (map[string]*TransactionResponse, error)
+	SendTransaction(proposal *pb.Proposal, tx *pb.Transaction) (*BroadcastOutcome, error)
+	SendTransactionAsUser(user User, proposal *pb.Proposal, tx *pb.Transaction) (*BroadcastOutcome, error)
+	CreateUnsignedTransactionProposal(user User, chaincodeName string, chainID string, args []string, transientData map[string][]byte) (*UnsignedProposal, error)
+	CreateUnsignedChaincodeProposal(user User, request *ChaincodeInvokeRequest) (*UnsignedProposal, error)
+	SignTransactionProposal(unsignedProposal *UnsignedProposal, signature []byte) (*pb.SignedProposal, error)
+	CreateUnsignedTransaction(proposal *pb.Proposal, tx *pb.Transaction) (*UnsignedTransaction, error)
+	SignTransaction(unsignedTransaction *UnsignedTransaction, signature []byte) (*common.Envelope, error)
+	SendSignedTransaction(envelope *common.Envelope) (*BroadcastOutcome, error)
+	SendSignedTransactionWithPolicy(envelope *common.Envelope, policy *retry.Policy) (*BroadcastOutcome, error)
+	SetBroadcastStrategy(strategy BroadcastStrategy)
+	GetBroadcastStrategy() BroadcastStrategy
 }
 
 type chain struct {
 	name            string // Name of the chain is only meaningful to the client
 	securityEnabled bool   // Security enabled flag
 	peers           map[string]Peer
-	tcertBatchSize  int // The number of tcerts to get in each batch
+	tcertBatchSize  int  // The number of tcerts to get in each batch
+	tcertEnabled    bool // Sign proposals with tcerts when security is enabled
 	orderers        map[string]Orderer
 	clientContext   Client
+	tcertMtx        sync.Mutex
+	tcertPools      map[string]*TCertPool // TCert pools by user name
+	// identities of the proposals signed with a tcert, by transaction ID,
+	// until their transaction is created or they expire
+	tcertSigners map[string]*tcertSigner
+	endorserMtx  sync.Mutex
+	// strategy choosing the peers that proposals are sent to
+	endorserSelector EndorserSelector
+	// health of the peers that proposals were sent to, by URL
+	endorserHealth map[string]*EndorserHealth
+	ordererMtx     sync.Mutex
+	// strategy choosing the orderers that transactions are sent to
+	broadcastStrategy BroadcastStrategy
 }
 
 // TransactionProposalResponse ...
@@ -89,6 +135,12 @@ type TransactionProposalResponse struct {
 	Endorser         string
 	ProposalResponse *pb.ProposalResponse
 	Err              error
+	// Attempts is the number of times the proposal was sent to the endorser
+	Attempts int
+	// MspID is the MSP ID of the endorser
+	MspID string
+	// Selector is the name of the strategy that selected the endorser
+	Selector string
 }
 
 // TransactionResponse ...
@@ -98,6 +150,53 @@ type TransactionProposalResponse struct {
 type TransactionResponse struct {
 	Orderer string
 	Err     error
+	// Attempts is the number of times the transaction was sent to the orderer
+	Attempts int
+	// Status is the status of the orderer's broadcast response, UNKNOWN
+	// if it didn't respond
+	Status common.Status
+}
+
+// ChaincodeInvokeRequest ...
+/**
+ * The ChaincodeInvokeRequest holds the chaincode call of a transaction proposal.
+ */
+type ChaincodeInvokeRequest struct {
+	ChainID          string
+	ChaincodeName    string
+	ChaincodeVersion string
+	// ChaincodeType defaults to GOLANG, see ParseChaincodeType
+	ChaincodeType pb.ChaincodeSpec_Type
+	// Fcn is the function to call, passed to the chaincode before Args.
+	// If empty, Args are passed as is.
+	Fcn           string
+	Args          [][]byte
+	TransientData map[string][]byte
+}
+
+// UnsignedProposal ...
+/**
+ * The UnsignedProposal is a transaction proposal waiting for the signature
+ * of its creator, which may be produced on another host.
+ * The Digest is the hash of the ProposalBytes that must be signed.
+ */
+type UnsignedProposal struct {
+	Proposal      *pb.Proposal
+	ProposalBytes []byte
+	TxID          string
+	Digest        []byte
+}
+
+// UnsignedTransaction ...
+/**
+ * The UnsignedTransaction is a transaction payload waiting for the signature
+ * of the creator of its proposal, which may be produced on another host.
+ * The Digest is the hash of the PayloadBytes that must be signed.
+ */
+type UnsignedTransaction struct {
+	PayloadBytes []byte
+	TxID         string
+	Digest       []byte
 }
 
 // NewChain ...
@@ -117,7 +216,10 @@ func NewChain(name string, client Client) (Chain, error) {
 	p := make(map[string]Peer)
 	o := make(map[string]Orderer)
 	c := &chain{name: name, securityEnabled: config.IsSecurityEnabled(), peers: p,
-		tcertBatchSize: config.TcertBatchSize(), orderers: o, clientContext: client}
+		tcertBatchSize: config.TcertBatchSize(), tcertEnabled: config.IsTcertEnabled(), orderers: o,
+		clientContext: client, tcertPools: make(map[string]*TCertPool),
+		tcertSigners: make(map[string]*tcertSigner), endorserSelector: NewAllEndorserSelector(),
+		endorserHealth: make(map[string]*EndorserHealth), broadcastStrategy: NewBroadcastToAllStrategy()}
 	logger.Infof("Constructed Chain instance: %v", c)
 
 	return c, nil
@@ -145,15 +247,47 @@ func (c *chain) IsSecurityEnabled() bool {
  * Get the tcert batch size.
  */
 func (c *chain) GetTCertBatchSize() int {
+	c.tcertMtx.Lock()
+	defer c.tcertMtx.Unlock()
 	return c.tcertBatchSize
 }
 
 // SetTCertBatchSize ...
 /**
- * Set the tcert batch size.
+ * Set the tcert batch size. It applies to the next batches fetched
+ * for the chain's TCert pools.
  */
 func (c *chain) SetTCertBatchSize(batchSize int) {
+	c.tcertMtx.Lock()
+	defer c.tcertMtx.Unlock()
 	c.tcertBatchSize = batchSize
+	for _, pool := range c.tcertPools {
+		if err := pool.SetBatchSize(batchSize); err != nil {
+			logger.Warningf("Could not set the TCert batch size: %s", err)
+		}
+	}
+}
+
+// IsTCertEnabled ...
+/**
+ * Determine if proposals are signed with TCerts. Each proposal is then
+ * signed with a fresh TCert of the user, taken from a per-user pool.
+ * This requires security to be enabled and the user to have a TCertFetcher.
+ */
+func (c *chain) IsTCertEnabled() bool {
+	c.tcertMtx.Lock()
+	defer c.tcertMtx.Unlock()
+	return c.tcertEnabled
+}
+
+// SetTCertEnabled ...
+/**
+ * Enable or disable signing proposals with TCerts.
+ */
+func (c *chain) SetTCertEnabled(enabled bool) {
+	c.tcertMtx.Lock()
+	defer c.tcertMtx.Unlock()
+	c.tcertEnabled = enabled
 }
 
 // AddPeer ...
@@ -173,6 +307,9 @@ func (c *chain) AddPeer(peer Peer) {
  */
 func (c *chain) RemovePeer(peer Peer) {
 	delete(c.peers, peer.GetURL())
+	c.endorserMtx.Lock()
+	delete(c.endorserHealth, peer.GetURL())
+	c.endorserMtx.Unlock()
 }
 
 // GetPeers ...
@@ -261,21 +398,40 @@ func (c *chain) IsReadonly() bool {
 // QueryInfo ...
 /**
  * Queries for various useful information on the state of the Chain
- * (height, known peers).
- * @returns {object} With height, currently the only useful info.
+ * (height, current block hash) from the ledger of one of its peers.
+ * @returns {BlockchainInfo} With height, currently the only useful info.
  */
-func (c *chain) QueryInfo() {
-	//to do
+func (c *chain) QueryInfo() (*common.BlockchainInfo, error) {
+	payload, err := c.queryLedger("GetChainInfo")
+	if err != nil {
+		return nil, err
+	}
+	info := &common.BlockchainInfo{}
+	if err := proto.Unmarshal(payload, info); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the chain info: %v", err)
+	}
+	return info, nil
 }
 
 // QueryBlock ...
 /**
- * Queries the ledger for Block by block number.
+ * Queries the ledger of one of the chain's peers for Block by block number.
  * @param {int} blockNumber The number which is the ID of the Block.
- * @returns {object} Object containing the block.
+ * @returns {Block} The block.
  */
-func (c *chain) QueryBlock(blockNumber int) {
-	//to do
+func (c *chain) QueryBlock(blockNumber int) (*common.Block, error) {
+	if blockNumber < 0 {
+		return nil, fmt.Errorf("Invalid block number %d", blockNumber)
+	}
+	payload, err := c.queryLedger("GetBlockByNumber", strconv.Itoa(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+	block := &common.Block{}
+	if err := proto.Unmarshal(payload, block); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal block %d: %v", blockNumber, err)
+	}
+	return block, nil
 }
 
 // QueryTransaction ...
@@ -297,47 +453,86 @@ func (c *chain) QueryTransaction(transactionID int) {
 func (c *chain) CreateTransactionProposal(chaincodeName string, chainID string,
 	args []string, sign bool, transientData map[string][]byte) (*pb.SignedProposal,
 	*pb.Proposal, string, error) {
+	return c.CreateTransactionProposalAsUser(nil, chaincodeName, chainID, args, sign, transientData)
+}
 
-	argsArray := make([][]byte, len(args))
-	for i, arg := range args {
-		argsArray[i] = []byte(arg)
-	}
-	ccis := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{
-		Type: pb.ChaincodeSpec_GOLANG, ChaincodeId: &pb.ChaincodeID{Name: chaincodeName},
-		Input: &pb.ChaincodeInput{Args: argsArray}}}
+// CreateTransactionProposalAsUser ...
+/**
+ * Create a proposal for transaction signed by the given user instead of the
+ * client's user context.
+ * @param {User} user the signing identity, nil for the client's user context
+ */
+func (c *chain) CreateTransactionProposalAsUser(user User, chaincodeName string, chainID string,
+	args []string, sign bool, transientData map[string][]byte) (*pb.SignedProposal,
+	*pb.Proposal, string, error) {
+	return c.CreateChaincodeProposal(user, newChaincodeInvokeRequest(chaincodeName, chainID, args, transientData))
+}
 
-	user, err := c.clientContext.GetUserContext("")
+// CreateChaincodeProposal ...
+/**
+ * Create a proposal for the chaincode call of request, signed by the given user.
+ * A proposal signed with a TCert must be turned into a transaction within
+ * ten minutes for the transaction to be signed with the same TCert.
+ * @param {User} user the signing identity, nil for the client's user context
+ * @param {ChaincodeInvokeRequest} request the chaincode, function and arguments to call
+ */
+func (c *chain) CreateChaincodeProposal(user User, request *ChaincodeInvokeRequest) (*pb.SignedProposal,
+	*pb.Proposal, string, error) {
+	user, err := c.getSigningUser(user)
 	if err != nil {
-		return nil, nil, "", fmt.Errorf("GetUserContext return error: %s", err)
+		return nil, nil, "", err
 	}
 
-	creatorID, err := getSerializedIdentity(user.GetEnrollmentCertificate())
+	signer, tcert, err := c.getProposalSigner(user)
 	if err != nil {
 		return nil, nil, "", err
 	}
-	// create a proposal from a ChaincodeInvocationSpec
-	proposal, txID, err := protos_utils.CreateChaincodeProposalWithTransient(common.HeaderType_ENDORSER_TRANSACTION, chainID, ccis, creatorID, transientData)
+	creatorID, err := signer.Serialize()
 	if err != nil {
-		return nil, nil, "", fmt.Errorf("Could not create chaincode proposal, err %s", err)
+		return nil, nil, "", fmt.Errorf("Could not serialize the signer identity: %s", err)
 	}
-
-	proposalBytes, err := protos_utils.GetBytesProposal(proposal)
+	proposal, proposalBytes, txID, err := createProposal(creatorID, request)
 	if err != nil {
 		return nil, nil, "", err
 	}
 
-	signature, err := c.signObjectWithKey(proposalBytes, user.GetPrivateKey(),
-		&bccsp.SHAOpts{}, nil)
+	signature, err := c.signObject(proposalBytes, signer)
 	if err != nil {
 		return nil, nil, "", err
 	}
+	if tcert {
+		// the transaction must be signed by the proposal's creator
+		c.addTCertSigner(txID, signer)
+	}
 	signedProposal := &pb.SignedProposal{ProposalBytes: proposalBytes, Signature: signature}
 	return signedProposal, proposal, txID, nil
 }
 
 // SendTransactionProposal ...
 // Send  the created proposal to peer for endorsement.
+// Failed calls are retried with the client's retry policy, retry overrides
+// its number of retries if positive.
 func (c *chain) SendTransactionProposal(signedProposal *pb.SignedProposal, retry int) (map[string]*TransactionProposalResponse, error) {
+	policy := c.clientContext.GetRetryPolicy()
+	if retry > 0 {
+		policy = policy.WithAttempts(retry + 1)
+	}
+	return c.SendTransactionProposalWithPolicy(signedProposal, policy)
+}
+
+// SendTransactionProposalWithPolicy ...
+/**
+ * Send the created proposal to peer for endorsement, retrying failed
+ * calls with the given policy. Only transient errors are retried, endorser
+ * responses with an error status aren't.
+ * The proposal is sent to the peers chosen by the endorser selector, see
+ * SetEndorserSelector; the responses are those of the chosen peers.
+ * @param {retry.Policy} policy nil for the client's retry policy
+ */
+func (c *chain) SendTransactionProposalWithPolicy(signedProposal *pb.SignedProposal, policy *retry.Policy) (map[string]*TransactionProposalResponse, error) {
+	if policy == nil {
+		policy = c.clientContext.GetRetryPolicy()
+	}
 	if c.peers == nil || len(c.peers) == 0 {
 		return nil, fmt.Errorf("peers is nil")
 	}
@@ -345,29 +540,51 @@ func (c *chain) SendTransactionProposal(signedProposal *pb.SignedProposal, retry
 		return nil, fmt.Errorf("signedProposal is nil")
 	}
 
+	selector := c.GetEndorserSelector()
+	endorsers, err := selector.Select(c.getPeersByURL(), c.GetEndorserHealth())
+	if err != nil {
+		return nil, fmt.Errorf("Could not select endorsers with the %s strategy: %v", selector.Name(), err)
+	}
+	if len(endorsers) == 0 {
+		return nil, fmt.Errorf("The %s strategy selected no endorsers", selector.Name())
+	}
+	logger.Debugf("Selected %d of %d peers with the %s strategy\n", len(endorsers), len(c.peers), selector.Name())
+
 	var responseMtx sync.Mutex
 	transactionProposalResponseMap := make(map[string]*TransactionProposalResponse)
 	var wg sync.WaitGroup
 
-	for _, p := range c.peers {
+	for _, p := range endorsers {
 		wg.Add(1)
 		go func(peer Peer) {
 			defer wg.Done()
-			var err error
 			var proposalResponse *pb.ProposalResponse
 			var transactionProposalResponse *TransactionProposalResponse
+			var latency time.Duration
 			logger.Debugf("Send ProposalRequest to peer :%s\n", peer.GetURL())
-			if proposalResponse, err = peer.SendProposal(signedProposal); err != nil {
+			attempts, err := policy.Do(func() error {
+				var sendErr error
+				start := time.Now()
+				proposalResponse, sendErr = peer.SendProposal(signedProposal)
+				latency = time.Since(start)
+				return sendErr
+			})
+			c.updateEndorserHealth(peer.GetURL(), latency, err)
+			if err != nil {
 				logger.Debugf("Receive Error Response :%v\n", proposalResponse)
-				transactionProposalResponse = &TransactionProposalResponse{peer.GetURL(), nil, fmt.Errorf("Error calling endorser '%s':  %s", peer.GetURL(), err)}
+				transactionProposalResponse = &TransactionProposalResponse{Endorser: peer.GetURL(),
+					Err: fmt.Errorf("Error calling endorser '%s':  %s", peer.GetURL(), err), Attempts: attempts}
 			} else {
 				prp1, _ := protos_utils.GetProposalResponsePayload(proposalResponse.Payload)
 				act1, _ := protos_utils.GetChaincodeAction(prp1.Extension)
 				logger.Debugf("%s ProposalResponsePayload Extension ChaincodeAction Results\n%s\n", peer.GetURL(), string(act1.Results))
 
 				logger.Debugf("Receive Proposal ChaincodeActionResponse :%v\n", proposalResponse)
-				transactionProposalResponse = &TransactionProposalResponse{peer.GetURL(), proposalResponse, nil}
+				transactionProposalResponse = &TransactionProposalResponse{Endorser: peer.GetURL(),
+					ProposalResponse: proposalResponse, Attempts: attempts}
 			}
+			transactionProposalResponse.MspID = peer.GetMspID()
+			transactionProposalResponse.Selector = selector.Name()
 
 			responseMtx.Lock()
 			transactionProposalResponseMap[transactionProposalResponse.Endorser] = transactionProposalResponse
@@ -378,6 +595,85 @@ func (c *chain) SendTransactionProposal(signedProposal *pb.SignedProposal, retry
 	return transactionProposalResponseMap, nil
 }
 
+// SetEndorserSelector ...
+/**
+ * Set the strategy that chooses the peers transaction proposals are sent to.
+ * @param {EndorserSelector} selector The strategy, all peers if nil
+ */
+func (c *chain) SetEndorserSelector(selector EndorserSelector) {
+	if selector == nil {
+		selector = NewAllEndorserSelector()
+	}
+	c.endorserMtx.Lock()
+	defer c.endorserMtx.Unlock()
+	c.endorserSelector = selector
+}
+
+// GetEndorserSelector ...
+/**
+ * Get the strategy that chooses the peers transaction proposals are sent to.
+ * @returns {EndorserSelector} The endorser selection strategy
+ */
+func (c *chain) GetEndorserSelector() EndorserSelector {
+	c.endorserMtx.Lock()
+	defer c.endorserMtx.Unlock()
+	return c.endorserSelector
+}
+
+// GetEndorserHealth ...
+/**
+ * Get the health of the peers that transaction proposals were sent to.
+ * @returns {map[string]EndorserHealth} The health of the peers by URL
+ */
+func (c *chain) GetEndorserHealth() map[string]EndorserHealth {
+	c.endorserMtx.Lock()
+	defer c.endorserMtx.Unlock()
+	health := make(map[string]EndorserHealth)
+	for url, h := range c.endorserHealth {
+		endorserHealth := *h
+		endorserHealth.Healthy = h.Failures == 0 || time.Since(h.LastFailure) >= endorserRecheckInterval
+		health[url] = endorserHealth
+	}
+	return health
+}
+
+// updateEndorserHealth records the outcome of a proposal sent to the peer
+// of url: the error if it failed, else the latency of its response
+func (c *chain) updateEndorserHealth(url string, latency time.Duration, err error) {
+	c.endorserMtx.Lock()
+	defer c.endorserMtx.Unlock()
+	health, ok := c.endorserHealth[url]
+	if !ok {
+		health = &EndorserHealth{}
+		c.endorserHealth[url] = health
+	}
+	if err != nil {
+		health.Failures++
+		health.LastFailure = time.Now()
+		return
+	}
+	health.Failures = 0
+	if health.Latency == 0 {
+		health.Latency = latency
+	} else {
+		health.Latency += time.Duration(latencySampleWeight * float64(latency-health.Latency))
+	}
+}
+
+// getPeersByURL returns the peers of the chain ordered by URL
+func (c *chain) getPeersByURL() []Peer {
+	var urls []string
+	for url := range c.peers {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	peers := make([]Peer, len(urls))
+	for i, url := range urls {
+		peers[i] = c.peers[url]
+	}
+	return peers
+}
+
 // CreateInvocationTransaction creates an invocation tranasaction that is broadcast
 // to the ordering service. Its payload contains a signed proposal which is
 // forwarded to the endorser server on the node to invoke chaincode
@@ -385,20 +681,32 @@ func (c *chain) SendTransactionProposal(signedProposal *pb.SignedProposal, retry
 // returns: transac envelope, error
 func (c *chain) CreateInvocationTransaction(chaincodeName string, chainID string,
 	args []string, transientData map[string][]byte) (*common.Envelope, string, error) {
+	return c.CreateInvocationTransactionAsUser(nil, chaincodeName, chainID, args, transientData)
+}
+
+// CreateInvocationTransactionAsUser creates an invocation transaction signed by
+// the given user, or by the client's user context if user is nil
+func (c *chain) CreateInvocationTransactionAsUser(user User, chaincodeName string, chainID string,
+	args []string, transientData map[string][]byte) (*common.Envelope, string, error) {
+	return c.CreateChaincodeInvocationTransaction(user, newChaincodeInvokeRequest(chaincodeName, chainID, args, transientData))
+}
+
+// CreateChaincodeInvocationTransaction creates an invocation transaction of the
+// chaincode call of request, signed by the given user or by the client's user
+// context if user is nil
+func (c *chain) CreateChaincodeInvocationTransaction(user User, request *ChaincodeInvokeRequest) (*common.Envelope, string, error) {
 	// Get user info and creator id
-	user, err := c.clientContext.GetUserContext("")
+	user, err := c.getSigningUser(user)
 	if err != nil {
-		return nil, "", fmt.Errorf("GetUserContext returned error: %s", err)
+		return nil, "", err
 	}
 
-	creatorID, err := getSerializedIdentity(user.GetEnrollmentCertificate())
+	// Create and marshal signed transaction proposal
+	signedProposal, _, txID, err := c.CreateChaincodeProposal(user, request)
 	if err != nil {
 		return nil, "", err
 	}
-
-	// Create and marshal signed transaction proposal
-	signedProposal, _, txID, err := c.CreateTransactionProposal(chaincodeName,
-		chainID, args, true, transientData)
+	signer, err := c.getTransactionSigner(user, txID)
 	if err != nil {
 		return nil, "", err
 	}
@@ -413,6 +721,10 @@ func (c *chain) CreateInvocationTransaction(chaincodeName string, chainID string
 		return nil, "", err
 	}
 
+	creatorID, err := signer.Serialize()
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not serialize the signer identity: %s", err)
+	}
 	signatureHeader := &common.SignatureHeader{Nonce: nonce, Creator: creatorID}
 	signatureHeaderBytes, err := proto.Marshal(signatureHeader)
 	if err != nil {
@@ -422,7 +734,7 @@ func (c *chain) CreateInvocationTransaction(chaincodeName string, chainID string
 	// TODO: Change this header type once protobufs are merged into fabric
 	channelHeader := &common.ChannelHeader{Type: 6,
 		TxId:      txID,
-		ChannelId: chainID}
+		ChannelId: request.ChainID}
 	channelHeaderBytes, err := proto.Marshal(channelHeader)
 	if err != nil {
 		return nil, "", err
@@ -441,8 +753,7 @@ func (c *chain) CreateInvocationTransaction(chaincodeName string, chainID string
 	}
 
 	// Sign payload
-	signature, err := c.signObjectWithKey(payloadBytes,
-		user.GetPrivateKey(), &bccsp.SHAOpts{}, nil)
+	signature, err := c.signObject(payloadBytes, signer)
 	if err != nil {
 		return nil, "", err
 	}
@@ -461,22 +772,8 @@ func (c *chain) CreateInvocationTransaction(chaincodeName string, chainID string
 // arguments: tranasaction
 // returns: error
 func (c *chain) SendInvocationTransaction(envelope *common.Envelope) error {
-	var failureCount int
-	transactionResponseMap, err := c.broadcastEnvelope(envelope)
-	if err != nil {
-		return err
-	}
-	for URL, resp := range transactionResponseMap {
-		if resp.Err != nil {
-			logger.Warningf("Could not broadcast to orderer: %s", URL)
-			failureCount++
-		}
-	}
-	// If all orderers returned error, the operation failed
-	if failureCount == len(transactionResponseMap) {
-		return fmt.Errorf("Broadcast failed: Received error from all configured orderers")
-	}
-	return nil
+	_, err := c.broadcastEnvelope(envelope, c.clientContext.GetRetryPolicy())
+	return err
 }
 
 // CreateTransaction ...
@@ -573,8 +870,21 @@ func (c *chain) CreateTransaction(proposal *pb.Proposal, resps []*pb.ProposalRes
  * 2-)The method implementation should also maintain a persistent connection with the Chain’s event source Peer as part of the
  * internal event hub mechanism in order to support the fabric events “BLOCK”, “CHAINCODE” and “TRANSACTION”.
  * These events should cause the method to emit “complete” or “error” events to the application.
+ *
+ * The transaction is sent to the orderers chosen by the broadcast strategy, see SetBroadcastStrategy.
+ * An error is returned if no orderer accepted it, with the outcome if it was sent.
+ */
+func (c *chain) SendTransaction(proposal *pb.Proposal, tx *pb.Transaction) (*BroadcastOutcome, error) {
+	return c.SendTransactionAsUser(nil, proposal, tx)
+}
+
+// SendTransactionAsUser ...
+/**
+ * Send a transaction to the chain’s orderer service, signed by the given user
+ * instead of the client's user context. The user should be the creator of the proposal.
+ * @param {User} user the signing identity, nil for the client's user context
  */
-func (c *chain) SendTransaction(proposal *pb.Proposal, tx *pb.Transaction) (map[string]*TransactionResponse, error) {
+func (c *chain) SendTransactionAsUser(user User, proposal *pb.Proposal, tx *pb.Transaction) (*BroadcastOutcome, error) {
 	if c.orderers == nil || len(c.orderers) == 0 {
 		return nil, fmt.Errorf("orderers is nil")
 	}
@@ -584,104 +894,589 @@ func (c *chain) SendTransaction(proposal *pb.Proposal, tx *pb.Transaction) (map[
 	if tx == nil {
 		return nil, fmt.Errorf("Transaction is nil")
 	}
-	// the original header
-	hdr, err := protos_utils.GetHeader(proposal.Header)
-	if err != nil {
-		return nil, fmt.Errorf("Could not unmarshal the proposal header")
-	}
-	// serialize the tx
-	txBytes, err := protos_utils.GetBytesTransaction(tx)
+	paylBytes, txID, err := createTransactionPayload(proposal, tx)
 	if err != nil {
 		return nil, err
 	}
 
-	// create the payload
-	payl := &common.Payload{Header: hdr, Data: txBytes}
-	paylBytes, err := protos_utils.GetBytesPayload(payl)
+	//Get user info
+	user, err = c.getSigningUser(user)
 	if err != nil {
 		return nil, err
 	}
-
-	//Get user info
-	user, err := c.clientContext.GetUserContext("")
+	signer, err := c.getTransactionSigner(user, txID)
 	if err != nil {
-		return nil, fmt.Errorf("GetUserContext return error: %s\n", err)
+		return nil, err
 	}
 
 	// sign payload
-	signature, err := c.signObjectWithKey(paylBytes, user.GetPrivateKey(),
-		&bccsp.SHAOpts{}, nil)
+	signature, err := c.signObject(paylBytes, signer)
 	if err != nil {
 		return nil, err
 	}
 	// here's the envelope
 	envelope := &common.Envelope{Payload: paylBytes, Signature: signature}
 
-	transactionResponseMap, err := c.broadcastEnvelope(envelope)
+	return c.broadcastEnvelope(envelope, c.clientContext.GetRetryPolicy())
+}
+
+// CreateUnsignedTransactionProposal ...
+/**
+ * Create a transaction proposal to be signed outside of the SDK, e.g. on an
+ * offline host holding the creator's key. The digest of the returned
+ * proposal is signed there and the signature attached with SignTransactionProposal.
+ * The proposal is created by the user's enrollment certificate, TCerts aren't used.
+ * @param {User} user the creator, nil for the client's user context. Its key isn't needed.
+ */
+func (c *chain) CreateUnsignedTransactionProposal(user User, chaincodeName string, chainID string,
+	args []string, transientData map[string][]byte) (*UnsignedProposal, error) {
+	return c.CreateUnsignedChaincodeProposal(user, newChaincodeInvokeRequest(chaincodeName, chainID, args, transientData))
+}
+
+// CreateUnsignedChaincodeProposal ...
+/**
+ * Create a proposal for the chaincode call of request, to be signed outside
+ * of the SDK as with CreateUnsignedTransactionProposal.
+ */
+func (c *chain) CreateUnsignedChaincodeProposal(user User, request *ChaincodeInvokeRequest) (*UnsignedProposal, error) {
+	user, err := c.getSigningUser(user)
+	if err != nil {
+		return nil, err
+	}
+	creatorID, err := getSerializedIdentity(user)
+	if err != nil {
+		return nil, err
+	}
+	proposal, proposalBytes, txID, err := createProposal(creatorID, request)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := c.hashObject(proposalBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &UnsignedProposal{Proposal: proposal, ProposalBytes: proposalBytes, TxID: txID, Digest: digest}, nil
+}
+
+// SignTransactionProposal ...
+/**
+ * Attach the creator's signature of the digest of an unsigned proposal.
+ * The returned proposal can be sent with SendTransactionProposal.
+ * @param {UnsignedProposal} unsignedProposal created by CreateUnsignedTransactionProposal
+ * @param {[]byte} signature of unsignedProposal.Digest
+ */
+func (c *chain) SignTransactionProposal(unsignedProposal *UnsignedProposal, signature []byte) (*pb.SignedProposal, error) {
+	if unsignedProposal == nil || unsignedProposal.Proposal == nil || len(unsignedProposal.ProposalBytes) == 0 {
+		return nil, fmt.Errorf("unsignedProposal is empty")
+	}
+	if len(signature) == 0 {
+		return nil, fmt.Errorf("signature is empty")
+	}
+	hdr, err := protos_utils.GetHeader(unsignedProposal.Proposal.Header)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the proposal header")
+	}
+	signature, err = toLowSForHeader(hdr, signature)
 	if err != nil {
 		return nil, err
 	}
+	return &pb.SignedProposal{ProposalBytes: unsignedProposal.ProposalBytes, Signature: signature}, nil
+}
 
-	return transactionResponseMap, nil
+// CreateUnsignedTransaction ...
+/**
+ * Create the payload of a transaction to be signed outside of the SDK by the
+ * creator of its proposal. The digest of the returned transaction is signed
+ * there and the signature attached with SignTransaction.
+ * @param {pb.Proposal} proposal the endorsed proposal
+ * @param {pb.Transaction} tx created by CreateTransaction
+ */
+func (c *chain) CreateUnsignedTransaction(proposal *pb.Proposal, tx *pb.Transaction) (*UnsignedTransaction, error) {
+	if proposal == nil {
+		return nil, fmt.Errorf("proposal is nil")
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("Transaction is nil")
+	}
+	payloadBytes, txID, err := createTransactionPayload(proposal, tx)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := c.hashObject(payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &UnsignedTransaction{PayloadBytes: payloadBytes, TxID: txID, Digest: digest}, nil
 }
 
-//broadcastEnvelope will send the given envelope to each orderer
-func (c *chain) broadcastEnvelope(envelope *common.Envelope) (map[string]*TransactionResponse, error) {
+// SignTransaction ...
+/**
+ * Attach the creator's signature of the digest of an unsigned transaction.
+ * The returned envelope can be sent with SendSignedTransaction.
+ * @param {UnsignedTransaction} unsignedTransaction created by CreateUnsignedTransaction
+ * @param {[]byte} signature of unsignedTransaction.Digest
+ */
+func (c *chain) SignTransaction(unsignedTransaction *UnsignedTransaction, signature []byte) (*common.Envelope, error) {
+	if unsignedTransaction == nil || len(unsignedTransaction.PayloadBytes) == 0 {
+		return nil, fmt.Errorf("unsignedTransaction is empty")
+	}
+	if len(signature) == 0 {
+		return nil, fmt.Errorf("signature is empty")
+	}
+	payload, err := protos_utils.GetPayload(&common.Envelope{Payload: unsignedTransaction.PayloadBytes})
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the transaction payload")
+	}
+	signature, err = toLowSForHeader(payload.Header, signature)
+	if err != nil {
+		return nil, err
+	}
+	return &common.Envelope{Payload: unsignedTransaction.PayloadBytes, Signature: signature}, nil
+}
+
+// toLowSForHeader returns the low-S form of an ECDSA signature of the
+// creator of a header
+func toLowSForHeader(hdr *common.Header, signature []byte) ([]byte, error) {
+	if hdr == nil {
+		return nil, fmt.Errorf("header is nil")
+	}
+	signatureHeader, err := protos_utils.GetSignatureHeader(hdr.SignatureHeader)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the signature header")
+	}
+	return toLowS(signatureHeader.Creator, signature)
+}
+
+// SendSignedTransaction ...
+/**
+ * Send a signed transaction envelope to the chain’s orderer service, as SendTransaction does.
+ */
+func (c *chain) SendSignedTransaction(envelope *common.Envelope) (*BroadcastOutcome, error) {
+	if envelope == nil {
+		return nil, fmt.Errorf("envelope is nil")
+	}
+	return c.broadcastEnvelope(envelope, c.clientContext.GetRetryPolicy())
+}
+
+// SendSignedTransactionWithPolicy ...
+/**
+ * Send a signed transaction envelope as SendSignedTransaction, retrying
+ * failed broadcasts with the given policy.
+ * @param {retry.Policy} policy nil for the client's retry policy
+ */
+func (c *chain) SendSignedTransactionWithPolicy(envelope *common.Envelope, policy *retry.Policy) (*BroadcastOutcome, error) {
+	if envelope == nil {
+		return nil, fmt.Errorf("envelope is nil")
+	}
+	if policy == nil {
+		policy = c.clientContext.GetRetryPolicy()
+	}
+	return c.broadcastEnvelope(envelope, policy)
+}
+
+// SetBroadcastStrategy ...
+/**
+ * Set the strategy that chooses the orderers transactions are sent to.
+ * @param {BroadcastStrategy} strategy The strategy, all orderers at once if nil
+ */
+func (c *chain) SetBroadcastStrategy(strategy BroadcastStrategy) {
+	if strategy == nil {
+		strategy = NewBroadcastToAllStrategy()
+	}
+	c.ordererMtx.Lock()
+	defer c.ordererMtx.Unlock()
+	c.broadcastStrategy = strategy
+}
+
+// GetBroadcastStrategy ...
+/**
+ * Get the strategy that chooses the orderers transactions are sent to.
+ * @returns {BroadcastStrategy} The broadcast strategy
+ */
+func (c *chain) GetBroadcastStrategy() BroadcastStrategy {
+	c.ordererMtx.Lock()
+	defer c.ordererMtx.Unlock()
+	return c.broadcastStrategy
+}
+
+// newChaincodeInvokeRequest returns the request of string arguments
+func newChaincodeInvokeRequest(chaincodeName string, chainID string,
+	args []string, transientData map[string][]byte) *ChaincodeInvokeRequest {
+	argsArray := make([][]byte, len(args))
+	for i, arg := range args {
+		argsArray[i] = []byte(arg)
+	}
+	return &ChaincodeInvokeRequest{ChainID: chainID, ChaincodeName: chaincodeName,
+		Args: argsArray, TransientData: transientData}
+}
+
+// queryLedger calls fcn of the query system chaincode for the chain and
+// returns the payload of the first successful peer response
+func (c *chain) queryLedger(fcn string, args ...string) ([]byte, error) {
+	request := newChaincodeInvokeRequest(queryChaincode, "", append([]string{fcn, c.name}, args...), nil)
+	signedProposal, _, _, err := c.CreateChaincodeProposal(nil, request)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := c.SendTransactionProposal(signedProposal, 0)
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for url, resp := range responses {
+		if resp.Err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", url, resp.Err))
+			continue
+		}
+		response := resp.ProposalResponse.GetResponse()
+		if response == nil {
+			errs = append(errs, fmt.Sprintf("%s: no response", url))
+			continue
+		}
+		if response.Status != 200 {
+			errs = append(errs, fmt.Sprintf("%s: %s failed: %s", url, fcn, response.Message))
+			continue
+		}
+		return response.Payload, nil
+	}
+	sort.Strings(errs)
+	return nil, fmt.Errorf("Ledger query %s failed on all peers: %s", fcn, strings.Join(errs, "; "))
+}
+
+// createProposal creates a chaincode invocation proposal of creatorID and
+// returns it with its bytes and transaction ID
+func createProposal(creatorID []byte, request *ChaincodeInvokeRequest) (*pb.Proposal, []byte, string, error) {
+	if request == nil {
+		return nil, nil, "", fmt.Errorf("request is nil")
+	}
+	if request.ChaincodeName == "" {
+		return nil, nil, "", fmt.Errorf("Missing chaincode name")
+	}
+	args := request.Args
+	if request.Fcn != "" {
+		args = append([][]byte{[]byte(request.Fcn)}, request.Args...)
+	}
+	spec, err := NewChaincodeSpec(request.ChaincodeName, request.ChaincodeVersion, request.ChaincodeType, args)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	ccis := &pb.ChaincodeInvocationSpec{ChaincodeSpec: spec}
+
+	// create a proposal from a ChaincodeInvocationSpec
+	proposal, txID, err := protos_utils.CreateChaincodeProposalWithTransient(common.HeaderType_ENDORSER_TRANSACTION, request.ChainID, ccis, creatorID, request.TransientData)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("Could not create chaincode proposal, err %s", err)
+	}
+
+	proposalBytes, err := protos_utils.GetBytesProposal(proposal)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return proposal, proposalBytes, txID, nil
+}
+
+// NewChaincodeSpec ...
+/**
+ * Returns the spec of a chaincode call, as used by invocation and query
+ * proposals (see CreateChaincodeProposal).
+ * @param {string} name of the chaincode
+ * @param {string} version of the chaincode, may be empty for invocations
+ * @param {pb.ChaincodeSpec_Type} ccType the chaincode language, UNDEFINED for GOLANG
+ * @param {[][]byte} args the function name and arguments
+ */
+func NewChaincodeSpec(name string, version string, ccType pb.ChaincodeSpec_Type, args [][]byte) (*pb.ChaincodeSpec, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Missing chaincode name")
+	}
+	if ccType == pb.ChaincodeSpec_UNDEFINED {
+		ccType = pb.ChaincodeSpec_GOLANG
+	}
+	if _, ok := pb.ChaincodeSpec_Type_name[int32(ccType)]; !ok {
+		return nil, fmt.Errorf("Unsupported chaincode type %d", ccType)
+	}
+	return &pb.ChaincodeSpec{Type: ccType, ChaincodeId: &pb.ChaincodeID{Name: name, Version: version},
+		Input: &pb.ChaincodeInput{Args: args}}, nil
+}
+
+// ParseChaincodeType ...
+/**
+ * Returns the chaincode type of a language name: GOLANG, NODE, CAR or
+ * JAVA, in any case. An empty name is GOLANG.
+ */
+func ParseChaincodeType(name string) (pb.ChaincodeSpec_Type, error) {
+	if name == "" {
+		return pb.ChaincodeSpec_GOLANG, nil
+	}
+	value, ok := pb.ChaincodeSpec_Type_value[strings.ToUpper(name)]
+	if !ok || value == int32(pb.ChaincodeSpec_UNDEFINED) {
+		return pb.ChaincodeSpec_UNDEFINED, fmt.Errorf("Unsupported chaincode type %s", name)
+	}
+	return pb.ChaincodeSpec_Type(value), nil
+}
+
+// createTransactionPayload returns the payload bytes of the transaction of
+// proposal and its transaction ID
+func createTransactionPayload(proposal *pb.Proposal, tx *pb.Transaction) ([]byte, string, error) {
+	// the original header
+	hdr, err := protos_utils.GetHeader(proposal.Header)
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not unmarshal the proposal header")
+	}
+	channelHeader, err := protos_utils.UnmarshalChannelHeader(hdr.ChannelHeader)
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not unmarshal the proposal channel header")
+	}
+	// serialize the tx
+	txBytes, err := protos_utils.GetBytesTransaction(tx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// create the payload
+	payl := &common.Payload{Header: hdr, Data: txBytes}
+	paylBytes, err := protos_utils.GetBytesPayload(payl)
+	if err != nil {
+		return nil, "", err
+	}
+	return paylBytes, channelHeader.TxId, nil
+}
+
+//broadcastEnvelope will send the given envelope to the orderers of the
+// broadcast strategy with the retry policy
+func (c *chain) broadcastEnvelope(envelope *common.Envelope, policy *retry.Policy) (*BroadcastOutcome, error) {
 	// Check if orderers are defined
 	if c.orderers == nil || len(c.orderers) == 0 {
 		return nil, fmt.Errorf("orderers not set")
 	}
+	strategy := c.GetBroadcastStrategy()
+	orderers := strategy.Orderers(c.getOrderersByURL())
+	if len(orderers) == 0 {
+		return nil, fmt.Errorf("The %s strategy selected no orderers", strategy.Name())
+	}
+	outcome := &BroadcastOutcome{Strategy: strategy.Name(), Status: common.Status_UNKNOWN}
+
+	if strategy.Failover() {
+		for _, orderer := range orderers {
+			transactionResponse := c.sendBroadcast(orderer, envelope, policy)
+			outcome.Responses = append(outcome.Responses, transactionResponse)
+			if transactionResponse.Err == nil || !isFailoverStatus(transactionResponse.Status) {
+				break
+			}
+			logger.Warningf("Could not broadcast to orderer %s, failing over: %v", orderer.GetURL(), transactionResponse.Err)
+		}
+	} else {
+		outcome.Responses = make([]*TransactionResponse, len(orderers))
+		var wg sync.WaitGroup
+		for i, o := range orderers {
+			wg.Add(1)
+			go func(i int, orderer Orderer) {
+				defer wg.Done()
+				outcome.Responses[i] = c.sendBroadcast(orderer, envelope, policy)
+				if outcome.Responses[i].Err != nil {
+					logger.Warningf("Could not broadcast to orderer: %s", orderer.GetURL())
+				}
+			}(i, o)
+		}
+		wg.Wait()
+	}
 
-	var responseMtx sync.Mutex
-	transactionResponseMap := make(map[string]*TransactionResponse)
-	var wg sync.WaitGroup
+	for _, transactionResponse := range outcome.Responses {
+		if transactionResponse.Err == nil {
+			outcome.Orderer = transactionResponse.Orderer
+			outcome.Status = common.Status_SUCCESS
+			return outcome, nil
+		}
+		if transactionResponse.Status != common.Status_UNKNOWN {
+			outcome.Status = transactionResponse.Status
+		}
+	}
+	if len(outcome.Responses) == len(orderers) {
+		return outcome, fmt.Errorf("Broadcast failed: Received error from all configured orderers")
+	}
+	return outcome, fmt.Errorf("Broadcast failed: %v", outcome.Responses[len(outcome.Responses)-1].Err)
+}
 
-	for _, o := range c.orderers {
-		wg.Add(1)
-		go func(orderer Orderer) {
-			defer wg.Done()
-			var transactionResponse *TransactionResponse
+// sendBroadcast sends the envelope to orderer with the retry policy
+func (c *chain) sendBroadcast(orderer Orderer, envelope *common.Envelope, policy *retry.Policy) *TransactionResponse {
+	logger.Debugf("Broadcasting envelope to orderer :%s\n", orderer.GetURL())
+	attempts, err := policy.DoWith(func() error {
+		return orderer.SendBroadcast(envelope)
+	}, func(err error) bool {
+		return isRetryableBroadcastError(policy, err)
+	})
+	if err != nil {
+		logger.Debugf("Receive Error Response from orderer :%v\n", err)
+		return &TransactionResponse{Orderer: orderer.GetURL(), Status: getBroadcastStatus(err),
+			Err: fmt.Errorf("Error calling orderer '%s':  %s", orderer.GetURL(), err), Attempts: attempts}
+	}
+	logger.Debugf("Receive Success Response from orderer\n")
+	return &TransactionResponse{Orderer: orderer.GetURL(), Status: common.Status_SUCCESS, Attempts: attempts}
+}
 
-			logger.Debugf("Broadcasting envelope to orderer :%s\n", orderer.GetURL())
-			if err := orderer.SendBroadcast(envelope); err != nil {
-				logger.Debugf("Receive Error Response from orderer :%v\n", err)
-				transactionResponse = &TransactionResponse{orderer.GetURL(),
-					fmt.Errorf("Error calling orderer '%s':  %s", orderer.GetURL(), err)}
-			} else {
-				logger.Debugf("Receive Success Response from orderer\n")
-				transactionResponse = &TransactionResponse{orderer.GetURL(), nil}
-			}
+// getOrderersByURL returns the orderers of the chain ordered by URL
+func (c *chain) getOrderersByURL() []Orderer {
+	var urls []string
+	for url := range c.orderers {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	orderers := make([]Orderer, len(urls))
+	for i, url := range urls {
+		orderers[i] = c.orderers[url]
+	}
+	return orderers
+}
 
-			responseMtx.Lock()
-			transactionResponseMap[transactionResponse.Orderer] = transactionResponse
-			responseMtx.Unlock()
-		}(o)
+// getSigningUser returns user, or the client's user context if user is nil
+func (c *chain) getSigningUser(user User) (User, error) {
+	if user != nil {
+		return user, nil
 	}
-	wg.Wait()
+	user, err := c.clientContext.GetUserContext("")
+	if err != nil {
+		return nil, fmt.Errorf("GetUserContext return error: %s", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("No user context set and no user given")
+	}
+	return user, nil
+}
+
+// getProposalSigner returns the identity a proposal of user is signed
+// with: a fresh TCert of the user if TCerts are enabled, else the ECert.
+// The second return value is true for a TCert.
+func (c *chain) getProposalSigner(user User) (Signer, bool, error) {
+	if !c.IsSecurityEnabled() || !c.IsTCertEnabled() {
+		signer, err := c.getUserSigner(user)
+		return signer, false, err
+	}
+
+	pool, err := c.getTCertPool(user)
+	if err != nil {
+		return nil, false, err
+	}
+	tcert, err := pool.GetTCert()
+	if err != nil {
+		return nil, false, fmt.Errorf("Could not get a TCert for user %s: %s", user.GetName(), err)
+	}
+	creatorID, err := serializeIdentity(user, tcert.Certificate)
+	if err != nil {
+		return nil, false, err
+	}
+	signer, err := NewBCCSPSigner(c.clientContext.GetCryptoSuite(), tcert.PrivateKey, creatorID)
+	if err != nil {
+		return nil, false, err
+	}
+	return signer, true, nil
+}
+
+// getTransactionSigner returns the identity that signed the proposal of the
+// transaction txID, which also signs the transaction
+func (c *chain) getTransactionSigner(user User, txID string) (Signer, error) {
+	c.tcertMtx.Lock()
+	entry, ok := c.tcertSigners[txID]
+	delete(c.tcertSigners, txID)
+	c.tcertMtx.Unlock()
+	if ok {
+		return entry.signer, nil
+	}
+	return c.getUserSigner(user)
+}
 
-	return transactionResponseMap, nil
+// tcertSigner is the TCert identity that signed a proposal
+type tcertSigner struct {
+	signer  Signer
+	created time.Time
 }
 
-// signObjectWithKey will sign the given object with the given key,
-// hashOpts and signerOpts
-func (c *chain) signObjectWithKey(object []byte, key bccsp.Key,
-	hashOpts bccsp.HashOpts, signerOpts bccsp.SignerOpts) ([]byte, error) {
-	cryptoSuite := c.clientContext.GetCryptoSuite()
-	digest, err := cryptoSuite.Hash(object, hashOpts)
+// addTCertSigner keeps the identity that signed the proposal of the
+// transaction txID, and drops those older than tcertSignerExpiry
+func (c *chain) addTCertSigner(txID string, signer Signer) {
+	c.tcertMtx.Lock()
+	defer c.tcertMtx.Unlock()
+	now := time.Now()
+	for id, entry := range c.tcertSigners {
+		if now.Sub(entry.created) > tcertSignerExpiry {
+			delete(c.tcertSigners, id)
+		}
+	}
+	c.tcertSigners[txID] = &tcertSigner{signer: signer, created: now}
+}
+
+// getUserSigner returns the signer of user's ECert: the user's Signer if
+// set, else one for the user's private key in the client's crypto suite
+func (c *chain) getUserSigner(user User) (Signer, error) {
+	if signer := user.GetSigner(); signer != nil {
+		return signer, nil
+	}
+	creatorID, err := getSerializedIdentity(user)
 	if err != nil {
 		return nil, err
 	}
-	signature, err := cryptoSuite.Sign(key, digest, signerOpts)
+	return NewBCCSPSigner(c.clientContext.GetCryptoSuite(), user.GetPrivateKey(), creatorID)
+}
+
+// getTCertPool returns the TCert pool of user, creating it on first use.
+// The pool is replaced when user is another instance of a known user name,
+// e.g. after re-enrollment.
+func (c *chain) getTCertPool(user User) (*TCertPool, error) {
+	c.tcertMtx.Lock()
+	defer c.tcertMtx.Unlock()
+	pool, ok := c.tcertPools[user.GetName()]
+	if ok && pool.GetUser() == user {
+		return pool, nil
+	}
+	pool, err := NewTCertPool(user, c.tcertBatchSize, nil)
 	if err != nil {
 		return nil, err
 	}
+	c.tcertPools[user.GetName()] = pool
+	return pool, nil
+}
 
-	return signature, nil
+// hashObject returns the digest of the given object that is signed, with
+// the configured hash algorithm
+func (c *chain) hashObject(object []byte) ([]byte, error) {
+	hashOpts, _, err := getHashOpts()
+	if err != nil {
+		return nil, err
+	}
+	return c.clientContext.GetCryptoSuite().Hash(object, hashOpts)
 }
 
-func getSerializedIdentity(userCertificate []byte) ([]byte, error) {
-	serializedIdentity := &msp.SerializedIdentity{Mspid: config.GetMspID(),
-		IdBytes: userCertificate}
+// signObject will hash the given object with the client's crypto suite
+// and sign the digest with signer
+func (c *chain) signObject(object []byte, signer Signer) ([]byte, error) {
+	digest, err := c.hashObject(object)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(digest)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := signer.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return toLowS(identity, signature)
+}
+
+// getSerializedIdentity returns the identity of user, attributed to the
+// user's MSP or to the configured MSP if the user has none
+func getSerializedIdentity(user User) ([]byte, error) {
+	return serializeIdentity(user, user.GetEnrollmentCertificate())
+}
+
+// serializeIdentity returns the identity of a certificate of user
+func serializeIdentity(user User, cert []byte) ([]byte, error) {
+	mspID := user.GetMspID()
+	if mspID == "" {
+		mspID = config.GetMspID()
+	}
+	serializedIdentity := &msp.SerializedIdentity{Mspid: mspID,
+		IdBytes: cert}
 	creatorID, err := proto.Marshal(serializedIdentity)
 	if err != nil {
 		return nil, fmt.Errorf("Could not Marshal serializedIdentity, err %s", err)
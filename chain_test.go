@@ -20,19 +20,28 @@ limitations under the License.
 package fabricsdk
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"testing"
+	"time"
 
 	"google.golang.org/grpc"
 
 	"github.com/golang/protobuf/proto"
 	config "github.com/hyperledger/fabric-sdk-go/config"
 	mocks "github.com/hyperledger/fabric-sdk-go/mocks"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	msp "github.com/hyperledger/fabric/msp"
 	"github.com/hyperledger/fabric/protos/common"
 	cb "github.com/hyperledger/fabric/protos/common"
 	protoOrderer "github.com/hyperledger/fabric/protos/orderer"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	protos_utils "github.com/hyperledger/fabric/protos/utils"
+	"google.golang.org/grpc/codes"
+
+	"github.com/hyperledger/fabric-sdk-go/retry"
 )
 
 var testPayload = &cb.Envelope{
@@ -131,6 +140,429 @@ func TestCreateInvocationTransaction(t *testing.T) {
 	}
 }
 
+func TestCreateTransactionProposalAsUser(t *testing.T) {
+	chain, err := setupTestChain()
+	if err != nil {
+		t.Fatalf("Failed to create chain: %s", err)
+	}
+	otherUser := NewUser("other")
+	otherUser.SetEnrollmentCertificate([]byte("other cert"))
+	otherUser.SetMspID("Org2MSP")
+
+	_, proposal, _, err := chain.CreateTransactionProposalAsUser(otherUser, "testChaincode",
+		"testChain", []string{"test"}, true, nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposalAsUser return error: %s", err)
+	}
+	if creator := getProposalCreator(t, proposal); string(creator.IdBytes) != "other cert" || creator.Mspid != "Org2MSP" {
+		t.Fatalf("Proposal creator should be the given user, got %s of %s", creator.IdBytes, creator.Mspid)
+	}
+
+	_, proposal, _, err = chain.CreateTransactionProposal("testChaincode", "testChain", []string{"test"}, true, nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposal return error: %s", err)
+	}
+	if creator := getProposalCreator(t, proposal); len(creator.IdBytes) != 0 || creator.Mspid != config.GetMspID() {
+		t.Fatalf("Proposal creator should be the user context of the configured MSP, got %s of %s", creator.IdBytes, creator.Mspid)
+	}
+
+	noUserChain, err := NewChain("testChain", NewClient())
+	if err != nil {
+		t.Fatalf("NewChain return error: %s", err)
+	}
+	if _, _, _, err := noUserChain.CreateTransactionProposal("testChaincode", "testChain", nil, true, nil); err == nil {
+		t.Fatalf("CreateTransactionProposal without user should return error")
+	}
+}
+
+func TestCreateChaincodeProposal(t *testing.T) {
+	chain, err := setupTestChain()
+	if err != nil {
+		t.Fatalf("Failed to create chain: %s", err)
+	}
+	otherUser := NewUser("other")
+	otherUser.SetEnrollmentCertificate([]byte("other cert"))
+
+	request := &ChaincodeInvokeRequest{ChainID: "testChain", ChaincodeName: "testChaincode",
+		ChaincodeVersion: "v1", Fcn: "invoke", Args: [][]byte{{0x00, 0xff}, []byte("b")}}
+	_, proposal, _, err := chain.CreateChaincodeProposal(otherUser, request)
+	if err != nil {
+		t.Fatalf("CreateChaincodeProposal return error: %s", err)
+	}
+	ccis, err := protos_utils.GetChaincodeInvocationSpec(proposal)
+	if err != nil {
+		t.Fatalf("GetChaincodeInvocationSpec return error: %s", err)
+	}
+	spec := ccis.ChaincodeSpec
+	if spec.Type != pb.ChaincodeSpec_GOLANG || spec.ChaincodeId.Name != "testChaincode" || spec.ChaincodeId.Version != "v1" {
+		t.Fatalf("Proposal has the wrong chaincode: %v", spec)
+	}
+	args := spec.Input.Args
+	if len(args) != 3 || string(args[0]) != "invoke" || !bytes.Equal(args[1], []byte{0x00, 0xff}) || string(args[2]) != "b" {
+		t.Fatalf("Proposal should pass the function and binary arguments, got %v", args)
+	}
+
+	// string arguments are passed as is
+	_, proposal, _, err = chain.CreateTransactionProposalAsUser(otherUser, "testChaincode", "testChain",
+		[]string{"invoke", "a"}, true, nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposalAsUser return error: %s", err)
+	}
+	ccis, _ = protos_utils.GetChaincodeInvocationSpec(proposal)
+	if args := ccis.ChaincodeSpec.Input.Args; len(args) != 2 || string(args[0]) != "invoke" || string(args[1]) != "a" {
+		t.Fatalf("Proposal should pass the string arguments, got %v", args)
+	}
+
+	// other chaincode languages
+	request.ChaincodeType = pb.ChaincodeSpec_JAVA
+	_, proposal, _, err = chain.CreateChaincodeProposal(otherUser, request)
+	if err != nil {
+		t.Fatalf("CreateChaincodeProposal return error: %s", err)
+	}
+	if ccis, _ = protos_utils.GetChaincodeInvocationSpec(proposal); ccis.ChaincodeSpec.Type != pb.ChaincodeSpec_JAVA {
+		t.Fatalf("Proposal should be for JAVA chaincode, got %s", ccis.ChaincodeSpec.Type)
+	}
+	request.ChaincodeType = pb.ChaincodeSpec_Type(42)
+	if _, _, _, err := chain.CreateChaincodeProposal(otherUser, request); err == nil {
+		t.Fatalf("CreateChaincodeProposal should fail for an unknown chaincode type")
+	}
+
+	if _, _, _, err := chain.CreateChaincodeProposal(otherUser, nil); err == nil {
+		t.Fatalf("CreateChaincodeProposal should fail without request")
+	}
+	if _, _, _, err := chain.CreateChaincodeProposal(otherUser, &ChaincodeInvokeRequest{ChainID: "testChain"}); err == nil {
+		t.Fatalf("CreateChaincodeProposal should fail without chaincode name")
+	}
+}
+
+func TestParseChaincodeType(t *testing.T) {
+	types := map[string]pb.ChaincodeSpec_Type{"": pb.ChaincodeSpec_GOLANG, "golang": pb.ChaincodeSpec_GOLANG,
+		"node": pb.ChaincodeSpec_NODE, "CAR": pb.ChaincodeSpec_CAR, "Java": pb.ChaincodeSpec_JAVA}
+	for name, expected := range types {
+		if ccType, err := ParseChaincodeType(name); err != nil || ccType != expected {
+			t.Fatalf("ParseChaincodeType(%s) should return %s, got %s: %v", name, expected, ccType, err)
+		}
+	}
+	for _, name := range []string{"undefined", "python"} {
+		if _, err := ParseChaincodeType(name); err == nil {
+			t.Fatalf("ParseChaincodeType(%s) should fail", name)
+		}
+	}
+}
+
+func TestCreateTransactionProposalWithTCert(t *testing.T) {
+	user, fetcher := newTestTCertUser(t, "tcertUser")
+	cryptoSuite := bccspFactory.GetDefault()
+	client := NewClient()
+	client.SetCryptoSuite(cryptoSuite)
+	client.SetUserContext(user, true)
+	testChain, err := NewChain("testChain", client)
+	if err != nil {
+		t.Fatalf("NewChain return error: %s", err)
+	}
+	testChain.(*chain).securityEnabled = true
+	testChain.SetTCertBatchSize(2)
+	testChain.SetTCertEnabled(true)
+
+	signedProposal, proposal, _, err := testChain.CreateTransactionProposal("testChaincode",
+		"testChain", []string{"test"}, true, nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposal return error: %s", err)
+	}
+	creator := getProposalCreator(t, proposal)
+	key, ok := fetcher.keys[string(creator.IdBytes)]
+	if !ok {
+		t.Fatalf("Proposal creator should be a TCert, got %s", creator.IdBytes)
+	}
+	verifyTestSignature(t, key, signedProposal.ProposalBytes, signedProposal.Signature)
+
+	// the transaction is signed with the TCert of its proposal
+	envelope, _, err := testChain.CreateInvocationTransaction("testChaincode", "testChain", []string{"test"}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvocationTransaction return error: %s", err)
+	}
+	payload := &cb.Payload{}
+	if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+		t.Fatalf("Invalid payload")
+	}
+	signatureHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(payload.Header.SignatureHeader, signatureHeader); err != nil {
+		t.Fatalf("Error unmarshalling signature header: %s", err)
+	}
+	txCreator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(signatureHeader.Creator, txCreator); err != nil {
+		t.Fatalf("Error unmarshalling creator: %s", err)
+	}
+	if string(txCreator.IdBytes) == string(creator.IdBytes) {
+		t.Fatalf("Each proposal should be signed with a fresh TCert")
+	}
+	txKey, ok := fetcher.keys[string(txCreator.IdBytes)]
+	if !ok {
+		t.Fatalf("Transaction creator should be a TCert, got %s", txCreator.IdBytes)
+	}
+	verifyTestSignature(t, txKey, envelope.Payload, envelope.Signature)
+	if batches := fetcher.getBatches(); batches[0] != 2 {
+		t.Fatalf("TCerts should be fetched with the chain's batch size, got %v", batches)
+	}
+
+	// without security, proposals are signed with the ECert
+	testChain.(*chain).securityEnabled = false
+	_, proposal, _, err = testChain.CreateTransactionProposal("testChaincode", "testChain", []string{"test"}, true, nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposal return error: %s", err)
+	}
+	if creator := getProposalCreator(t, proposal); string(creator.IdBytes) != "ecert" {
+		t.Fatalf("Proposal creator should be the ECert, got %s", creator.IdBytes)
+	}
+}
+
+func TestTCertSignerExpiry(t *testing.T) {
+	testChain, err := NewChain("testChain", NewClient())
+	if err != nil {
+		t.Fatalf("NewChain return error: %s", err)
+	}
+	c := testChain.(*chain)
+	c.addTCertSigner("old", &failingSigner{})
+	c.tcertSigners["old"].created = time.Now().Add(-tcertSignerExpiry - time.Second)
+	c.addTCertSigner("new", &failingSigner{})
+	if _, ok := c.tcertSigners["old"]; ok || len(c.tcertSigners) != 1 {
+		t.Fatalf("Expired TCert signers should be dropped, got %v", c.tcertSigners)
+	}
+}
+
+func TestCreateTransactionProposalWithSigner(t *testing.T) {
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %s", err)
+	}
+	cryptoSuite := bccspFactory.GetDefault()
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error: %s", err)
+	}
+	// the user's key is held by another process
+	user := NewUser("signerUser")
+	user.SetEnrollmentCertificate([]byte("ecert"))
+	identity, err := serializeIdentity(user, []byte("ecert"))
+	if err != nil {
+		t.Fatalf("serializeIdentity return error: %s", err)
+	}
+	keySigner, _ := NewBCCSPSigner(cryptoSuite, key, identity)
+	address, stop := startTestSigner(t, keySigner)
+	defer stop()
+	signer, err := NewSocketSigner("unix", address, testSignerSecret, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewSocketSigner return error: %s", err)
+	}
+	user.SetSigner(signer)
+
+	client := NewClient()
+	client.SetCryptoSuite(cryptoSuite)
+	client.SetUserContext(user, true)
+	testChain, err := NewChain("testChain", client)
+	if err != nil {
+		t.Fatalf("NewChain return error: %s", err)
+	}
+	signedProposal, proposal, _, err := testChain.CreateTransactionProposal("testChaincode",
+		"testChain", []string{"test"}, true, nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposal return error: %s", err)
+	}
+	if creator := getProposalCreator(t, proposal); string(creator.IdBytes) != "ecert" {
+		t.Fatalf("Proposal creator should be the signer's identity, got %s", creator.IdBytes)
+	}
+	verifyTestSignature(t, key, signedProposal.ProposalBytes, signedProposal.Signature)
+
+	envelope, _, err := testChain.CreateInvocationTransaction("testChaincode", "testChain", []string{"test"}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvocationTransaction return error: %s", err)
+	}
+	verifyTestSignature(t, key, envelope.Payload, envelope.Signature)
+
+	// signing errors are returned
+	user.SetSigner(&failingSigner{})
+	if _, _, _, err := testChain.CreateTransactionProposal("testChaincode", "testChain", nil, true, nil); err == nil {
+		t.Fatalf("CreateTransactionProposal should fail when the signer fails")
+	}
+}
+
+func TestOfflineTransactionSigning(t *testing.T) {
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %s", err)
+	}
+	cryptoSuite := bccspFactory.GetDefault()
+	// the key is held on another host
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error: %s", err)
+	}
+	user := NewUser("offlineUser")
+	user.SetEnrollmentCertificate([]byte("ecert"))
+	client := NewClient()
+	client.SetCryptoSuite(cryptoSuite)
+	client.SetUserContext(user, true)
+	testChain, err := NewChain("testChain", client)
+	if err != nil {
+		t.Fatalf("NewChain return error: %s", err)
+	}
+	testChain.AddOrderer(&mockOrderer{MockURL: "orderer"})
+
+	unsignedProposal, err := testChain.CreateUnsignedTransactionProposal(nil, "testChaincode",
+		"testChain", []string{"test"}, nil)
+	if err != nil {
+		t.Fatalf("CreateUnsignedTransactionProposal return error: %s", err)
+	}
+	if creator := getProposalCreator(t, unsignedProposal.Proposal); string(creator.IdBytes) != "ecert" {
+		t.Fatalf("Proposal creator should be the user, got %s", creator.IdBytes)
+	}
+	if _, err := testChain.SignTransactionProposal(unsignedProposal, nil); err == nil {
+		t.Fatalf("SignTransactionProposal should fail without signature")
+	}
+	signature, err := cryptoSuite.Sign(key, unsignedProposal.Digest, nil)
+	if err != nil {
+		t.Fatalf("Sign return error: %s", err)
+	}
+	signedProposal, err := testChain.SignTransactionProposal(unsignedProposal, signature)
+	if err != nil {
+		t.Fatalf("SignTransactionProposal return error: %s", err)
+	}
+	verifyTestSignature(t, key, signedProposal.ProposalBytes, signedProposal.Signature)
+
+	unsignedTransaction, err := testChain.CreateUnsignedTransaction(unsignedProposal.Proposal, &pb.Transaction{})
+	if err != nil {
+		t.Fatalf("CreateUnsignedTransaction return error: %s", err)
+	}
+	if unsignedTransaction.TxID != unsignedProposal.TxID {
+		t.Fatalf("Transaction ID should be the proposal's, got %s", unsignedTransaction.TxID)
+	}
+	signature, err = cryptoSuite.Sign(key, unsignedTransaction.Digest, nil)
+	if err != nil {
+		t.Fatalf("Sign return error: %s", err)
+	}
+	envelope, err := testChain.SignTransaction(unsignedTransaction, signature)
+	if err != nil {
+		t.Fatalf("SignTransaction return error: %s", err)
+	}
+	verifyTestSignature(t, key, envelope.Payload, envelope.Signature)
+	outcome, err := testChain.SendSignedTransaction(envelope)
+	if err != nil || outcome.Orderer != "orderer" || outcome.Status != common.Status_SUCCESS {
+		t.Fatalf("SendSignedTransaction should broadcast the envelope: %v", err)
+	}
+
+	if _, err := testChain.CreateUnsignedTransaction(nil, &pb.Transaction{}); err == nil {
+		t.Fatalf("CreateUnsignedTransaction should fail without proposal")
+	}
+}
+
+// flakyPeer fails its first proposals
+type flakyPeer struct {
+	mockPeer
+	failures int
+	err      error
+	calls    int
+}
+
+func (p *flakyPeer) SendProposal(signedProposal *pb.SignedProposal) (*pb.ProposalResponse, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return nil, p.err
+	}
+	return p.mockPeer.SendProposal(signedProposal)
+}
+
+// flakyOrderer fails its first broadcasts
+type flakyOrderer struct {
+	mockOrderer
+	failures int
+	err      error
+	calls    int
+}
+
+func (o *flakyOrderer) SendBroadcast(envelope *common.Envelope) error {
+	o.calls++
+	if o.calls <= o.failures {
+		return o.err
+	}
+	return nil
+}
+
+func TestSendWithRetryPolicy(t *testing.T) {
+	client := NewClient()
+	client.SetRetryPolicy(&retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond,
+		BackoffFactor: 2, RetryableCodes: retry.DefaultRetryableCodes})
+	testChain, err := NewChain("testChain", client)
+	if err != nil {
+		t.Fatalf("NewChain return error: %s", err)
+	}
+	restarting := &flakyPeer{mockPeer: mockPeer{MockURL: "restarting"}, failures: 2,
+		err: grpc.Errorf(codes.Unavailable, "connection refused")}
+	failing := &flakyPeer{mockPeer: mockPeer{MockURL: "failing"}, failures: 10,
+		err: grpc.Errorf(codes.Unknown, "chaincode error")}
+	testChain.AddPeer(restarting)
+	testChain.AddPeer(failing)
+
+	responses, err := testChain.SendTransactionProposal(&pb.SignedProposal{}, 0)
+	if err != nil {
+		t.Fatalf("SendTransactionProposal return error: %s", err)
+	}
+	if resp := responses["restarting"]; resp.Err != nil || resp.Attempts != 3 {
+		t.Fatalf("Proposal to a restarting peer should succeed on the third attempt, got %d attempts: %v", resp.Attempts, resp.Err)
+	}
+	if resp := responses["failing"]; resp.Err == nil || resp.Attempts != 1 {
+		t.Fatalf("Chaincode errors shouldn't be retried, got %d attempts", resp.Attempts)
+	}
+
+	// the retry parameter overrides the client's policy
+	restarting.calls = 0
+	responses, _ = testChain.SendTransactionProposal(&pb.SignedProposal{}, 1)
+	if resp := responses["restarting"]; resp.Err == nil || resp.Attempts != 2 {
+		t.Fatalf("Proposal should be retried once, got %d attempts", resp.Attempts)
+	}
+	restarting.calls = 0
+	responses, _ = testChain.SendTransactionProposalWithPolicy(&pb.SignedProposal{}, retry.NoRetry())
+	if resp := responses["restarting"]; resp.Err == nil || resp.Attempts != 1 {
+		t.Fatalf("Proposal shouldn't be retried, got %d attempts", resp.Attempts)
+	}
+
+	orderer := &flakyOrderer{mockOrderer: mockOrderer{MockURL: "orderer"}, failures: 1,
+		err: &BroadcastError{Status: common.Status_SERVICE_UNAVAILABLE}}
+	testChain.AddOrderer(orderer)
+	outcome, err := testChain.SendSignedTransaction(&common.Envelope{})
+	if err != nil {
+		t.Fatalf("SendSignedTransaction return error: %s", err)
+	}
+	if resp := outcome.Responses[0]; resp.Err != nil || resp.Attempts != 2 {
+		t.Fatalf("Broadcast should succeed on the second attempt, got %d attempts: %v", resp.Attempts, resp.Err)
+	}
+}
+
+func verifyTestSignature(t *testing.T, key bccsp.Key, object []byte, signature []byte) {
+	cryptoSuite := bccspFactory.GetDefault()
+	digest, err := cryptoSuite.Hash(object, &bccsp.SHAOpts{})
+	if err != nil {
+		t.Fatalf("Hash return error: %s", err)
+	}
+	valid, err := cryptoSuite.Verify(key, signature, digest, nil)
+	if err != nil || !valid {
+		t.Fatalf("Signature should be valid for the key: %v", err)
+	}
+}
+
+func getProposalCreator(t *testing.T, proposal *pb.Proposal) *msp.SerializedIdentity {
+	header := &common.Header{}
+	if err := proto.Unmarshal(proposal.Header, header); err != nil {
+		t.Fatalf("Error unmarshalling header: %s", err)
+	}
+	signatureHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(header.SignatureHeader, signatureHeader); err != nil {
+		t.Fatalf("Error unmarshalling signature header: %s", err)
+	}
+	creator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(signatureHeader.Creator, creator); err != nil {
+		t.Fatalf("Error unmarshalling creator: %s", err)
+	}
+	return creator
+}
+
 func TestSendInvocationTransaction(t *testing.T) {
 	config.GetFabricClientViper().Set("client.tls.enabled", false)
 	startMockServer(t)
@@ -228,7 +660,7 @@ func setupMassiveTestChain(numberOfPeers int, numberOfOrderers int) (Chain, erro
 	}
 
 	for i := 0; i < numberOfPeers; i++ {
-		peer := mockPeer{fmt.Sprintf("MockPeer%d", i), fmt.Sprintf("http://mock%d.peers.r.us", i), []string{}, nil}
+		peer := mockPeer{fmt.Sprintf("MockPeer%d", i), fmt.Sprintf("http://mock%d.peers.r.us", i), []string{}, nil, ""}
 		chain.AddPeer(&peer)
 	}
 
@@ -22,8 +22,10 @@ package fabricsdk
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
+	"github.com/hyperledger/fabric-sdk-go/retry"
 	"github.com/hyperledger/fabric/bccsp"
 )
 
@@ -54,13 +56,25 @@ type Client interface {
 	GetCryptoSuite() bccsp.BCCSP
 	SetUserContext(user User, skipPersistence bool) error
 	GetUserContext(name string) (User, error)
+	AddUser(user User, skipPersistence bool) error
+	ReplaceUser(user User, skipPersistence bool) error
+	RemoveUser(name string)
+	SetRetryPolicy(policy *retry.Policy)
+	GetRetryPolicy() *retry.Policy
 }
 
 type client struct {
 	chains      map[string]Chain
 	cryptoSuite bccsp.BCCSP
 	stateStore  kvs.KeyValueStore
+	// Protects userContext and users
+	userMtx     sync.RWMutex
 	userContext User
+	// users loaded or added by name
+	users map[string]User
+	// retry policy of network calls, from config if not set
+	retryMtx    sync.Mutex
+	retryPolicy *retry.Policy
 }
 
 // NewClient ...
@@ -69,7 +83,8 @@ type client struct {
  */
 func NewClient() Client {
 	chains := make(map[string]Chain)
-	c := &client{chains: chains, cryptoSuite: nil, stateStore: nil, userContext: nil}
+	c := &client{chains: chains, cryptoSuite: nil, stateStore: nil, userContext: nil,
+		users: make(map[string]User)}
 	return c
 }
 
@@ -163,29 +178,19 @@ func (c *client) GetCryptoSuite() bccsp.BCCSP {
  * in a persistence cache if the “state store” has been set on the Client instance. If no state store has been set,
  * this cache will not be established and the application is responsible for setting the user context again when the application
  * crashed and is recovered.
+ * The user is also added to the client's users, see AddUser.
  */
 func (c *client) SetUserContext(user User, skipPersistence bool) error {
-	if user == nil {
-		return fmt.Errorf("user is nil")
-	}
-
-	if user.GetName() == "" {
-		return fmt.Errorf("user name is empty")
+	if err := validateUser(user); err != nil {
+		return err
 	}
+	c.userMtx.Lock()
 	c.userContext = user
+	c.users[user.GetName()] = user
+	c.userMtx.Unlock()
+
 	if !skipPersistence {
-		if c.stateStore == nil {
-			return fmt.Errorf("stateStore is nil")
-		}
-		userJSON := &UserJSON{PrivateKeySKI: user.GetPrivateKey().SKI(), EnrollmentCertificate: user.GetEnrollmentCertificate()}
-		data, err := json.Marshal(userJSON)
-		if err != nil {
-			return fmt.Errorf("Marshal json return error: %v", err)
-		}
-		err = c.stateStore.SetValue(user.GetName(), data)
-		if err != nil {
-			return fmt.Errorf("stateStore SetValue return error: %v", err)
-		}
+		return c.saveUser(user)
 	}
 	return nil
 
@@ -198,13 +203,20 @@ func (c *client) SetUserContext(user User, skipPersistence bool) error {
  * This function attempts to load the user by name from the local storage (via the KeyValueStore interface).
  * The loaded user object must represent an enrolled user with a valid enrollment certificate signed by a trusted CA
  * (such as the COP server).
+ * An empty name returns the user set with SetUserContext. Users loaded by name are cached, and the first one
+ * loaded becomes the user context if none was set.
  */
 func (c *client) GetUserContext(name string) (User, error) {
-	if c.userContext != nil {
-		return c.userContext, nil
-	}
+	c.userMtx.RLock()
+	userContext := c.userContext
+	user, ok := c.users[name]
+	c.userMtx.RUnlock()
+
 	if name == "" {
-		return nil, nil
+		return userContext, nil
+	}
+	if ok {
+		return user, nil
 	}
 	if c.stateStore == nil {
 		return nil, nil
@@ -212,23 +224,162 @@ func (c *client) GetUserContext(name string) (User, error) {
 	if c.cryptoSuite == nil {
 		return nil, fmt.Errorf("cryptoSuite is nil")
 	}
-	value, err := c.stateStore.GetValue(name)
+	user, err := c.loadUser(name)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	c.userMtx.Lock()
+	defer c.userMtx.Unlock()
+	if cached, ok := c.users[name]; ok {
+		// loaded concurrently
+		return cached, nil
+	}
+	c.users[name] = user
+	if c.userContext == nil {
+		c.userContext = user
+	}
+	return user, nil
+
+}
+
+// AddUser ...
+/*
+ * Adds a user to the users of this client instance without making it the user context, so that it can be passed
+ * as the signing identity of individual chain operations. Unless skipPersistence is true the user is saved in the
+ * state store, from which GetUserContext loads it by name later on.
+ */
+func (c *client) AddUser(user User, skipPersistence bool) error {
+	if err := validateUser(user); err != nil {
+		return err
+	}
+	c.userMtx.Lock()
+	c.users[user.GetName()] = user
+	c.userMtx.Unlock()
+
+	if !skipPersistence {
+		return c.saveUser(user)
+	}
+	return nil
+}
+
+// ReplaceUser ...
+/*
+ * Replaces the user of the same name with new credentials, e.g. after re-enrollment. Unless skipPersistence is true
+ * the user is saved in the state store first; then the cached user and, if it is the one replaced, the user context
+ * are swapped together, so that concurrent callers see either the old or the new credentials.
+ */
+func (c *client) ReplaceUser(user User, skipPersistence bool) error {
+	if err := validateUser(user); err != nil {
+		return err
+	}
+	if !skipPersistence {
+		if err := c.saveUser(user); err != nil {
+			return err
+		}
+	}
+	c.userMtx.Lock()
+	defer c.userMtx.Unlock()
+	c.users[user.GetName()] = user
+	if c.userContext != nil && c.userContext.GetName() == user.GetName() {
+		c.userContext = user
+	}
+	return nil
+}
+
+// RemoveUser ...
+/*
+ * Removes a user from the users cached by this client instance. The user is not deleted from the state store.
+ * If the user is the user context, the client no longer has a user context.
+ */
+func (c *client) RemoveUser(name string) {
+	c.userMtx.Lock()
+	defer c.userMtx.Unlock()
+	delete(c.users, name)
+	if c.userContext != nil && c.userContext.GetName() == name {
+		c.userContext = nil
+	}
+}
+
+// SetRetryPolicy ...
+/*
+ * Set the retry policy of the proposals, broadcasts and event hub connects
+ * of this client's chains. Calls may override it.
+ * @param {retry.Policy} policy nil for the policy of the config
+ */
+func (c *client) SetRetryPolicy(policy *retry.Policy) {
+	c.retryMtx.Lock()
+	defer c.retryMtx.Unlock()
+	c.retryPolicy = policy
+}
+
+// GetRetryPolicy ...
+/*
+ * Get the retry policy set with SetRetryPolicy, or the policy of the
+ * client.retry config.
+ */
+func (c *client) GetRetryPolicy() *retry.Policy {
+	c.retryMtx.Lock()
+	defer c.retryMtx.Unlock()
+	if c.retryPolicy == nil {
+		return retry.PolicyFromConfig()
+	}
+	return c.retryPolicy
+}
+
+func validateUser(user User) error {
+	if user == nil {
+		return fmt.Errorf("user is nil")
+	}
+	if user.GetName() == "" {
+		return fmt.Errorf("user name is empty")
+	}
+	return nil
+}
+
+// saveUser saves the user in the state store
+func (c *client) saveUser(user User) error {
+	if c.stateStore == nil {
+		return fmt.Errorf("stateStore is nil")
+	}
+	if user.GetPrivateKey() == nil {
+		return fmt.Errorf("User %s has no private key in the crypto suite and can't be saved", user.GetName())
+	}
+	userJSON := &UserJSON{MspID: user.GetMspID(), PrivateKeySKI: user.GetPrivateKey().SKI(),
+		EnrollmentCertificate: user.GetEnrollmentCertificate()}
+	data, err := json.Marshal(userJSON)
+	if err != nil {
+		return fmt.Errorf("Marshal json return error: %v", err)
+	}
+	err = c.stateStore.SetValue(user.GetName(), data)
 	if err != nil {
+		return fmt.Errorf("stateStore SetValue return error: %v", err)
+	}
+	return nil
+}
+
+// loadUser loads the user from the state store, it returns nil if the
+// user was not saved
+func (c *client) loadUser(name string) (User, error) {
+	value, err := c.stateStore.GetValue(name)
+	if kvs.IsKeyNotFound(err) {
 		return nil, nil
 	}
+	if err != nil {
+		return nil, fmt.Errorf("stateStore GetValue return error: %v", err)
+	}
 	var userJSON UserJSON
 	err = json.Unmarshal(value, &userJSON)
 	if err != nil {
 		return nil, fmt.Errorf("stateStore GetValue return error: %v", err)
 	}
 	user := NewUser(name)
+	user.SetMspID(userJSON.MspID)
 	user.SetEnrollmentCertificate(userJSON.EnrollmentCertificate)
 	key, err := c.cryptoSuite.GetKey(userJSON.PrivateKeySKI)
 	if err != nil {
 		return nil, fmt.Errorf("cryptoSuite GetKey return error: %v", err)
 	}
 	user.SetPrivateKey(key)
-	c.userContext = user
-	return c.userContext, nil
-
+	return user, nil
 }
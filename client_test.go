@@ -124,3 +124,61 @@ func TestClientMethods(t *testing.T) {
 	}
 
 }
+
+func TestClientUsers(t *testing.T) {
+	client := NewClient()
+	defaultUser := NewUser("defaultUser")
+	if err := client.SetUserContext(defaultUser, true); err != nil {
+		t.Fatalf("client.SetUserContext return error[%s]", err)
+	}
+	otherUser := NewUser("otherUser")
+	if err := client.AddUser(otherUser, true); err != nil {
+		t.Fatalf("client.AddUser return error[%s]", err)
+	}
+	if err := client.AddUser(nil, true); err == nil {
+		t.Fatalf("client.AddUser didn't return error")
+	}
+
+	user, err := client.GetUserContext("otherUser")
+	if err != nil || user != otherUser {
+		t.Fatalf("client.GetUserContext didn't return the named user")
+	}
+	user, err = client.GetUserContext("")
+	if err != nil || user != defaultUser {
+		t.Fatalf("client.AddUser should not change the user context")
+	}
+	user, err = client.GetUserContext("defaultUser")
+	if err != nil || user != defaultUser {
+		t.Fatalf("client.GetUserContext didn't return the user context by name")
+	}
+
+	renewedUser := NewUser("defaultUser")
+	if err := client.ReplaceUser(renewedUser, true); err != nil {
+		t.Fatalf("client.ReplaceUser return error[%s]", err)
+	}
+	user, err = client.GetUserContext("")
+	if err != nil || user != renewedUser {
+		t.Fatalf("client.ReplaceUser should replace the user context")
+	}
+	user, err = client.GetUserContext("defaultUser")
+	if err != nil || user != renewedUser {
+		t.Fatalf("client.ReplaceUser should replace the cached user")
+	}
+	if err := client.ReplaceUser(NewUser("otherUser"), false); err == nil {
+		t.Fatalf("client.ReplaceUser should fail to persist without state store")
+	}
+	if user, _ := client.GetUserContext("otherUser"); user != otherUser {
+		t.Fatalf("client.ReplaceUser should not replace the user when persistence fails")
+	}
+
+	client.RemoveUser("otherUser")
+	user, err = client.GetUserContext("otherUser")
+	if err != nil || user != nil {
+		t.Fatalf("client.GetUserContext should not return a removed user")
+	}
+	client.RemoveUser("defaultUser")
+	user, err = client.GetUserContext("")
+	if err != nil || user != nil {
+		t.Fatalf("removing the user context should clear it")
+	}
+}
@@ -26,6 +26,8 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
@@ -37,6 +39,8 @@ type PeerConfig struct {
 	Port      string
 	EventHost string
 	EventPort string
+	// MspID is the MSP ID of the peer's organization, optional
+	MspID string
 }
 
 var myViper = viper.New()
@@ -96,20 +100,24 @@ func GetPeersConfig() []PeerConfig {
 		var port int
 		var eventHost string
 		var eventPort int
+		var mspID string
 
 		if ok {
 			host, _ = mm["host"].(string)
 			port, _ = mm["port"].(int)
 			eventHost, _ = mm["event_host"].(string)
 			eventPort, _ = mm["event_port"].(int)
+			mspID, _ = mm["msp_id"].(string)
 		} else {
 			mm1 := value.(map[interface{}]interface{})
 			host, _ = mm1["host"].(string)
 			port, _ = mm1["port"].(int)
 			eventHost, _ = mm1["event_host"].(string)
 			eventPort, _ = mm1["event_port"].(int)
+			mspID, _ = mm1["msp_id"].(string)
 		}
-		p := PeerConfig{Host: host, Port: strconv.Itoa(port), EventHost: eventHost, EventPort: strconv.Itoa(eventPort)}
+		p := PeerConfig{Host: host, Port: strconv.Itoa(port), EventHost: eventHost, EventPort: strconv.Itoa(eventPort),
+			MspID: mspID}
 		if p.Host == "" {
 			panic(fmt.Sprintf("host key not exist or empty for %s", key))
 		}
@@ -161,6 +169,12 @@ func TcertBatchSize() int {
 	return myViper.GetInt("client.tcert.batch.size")
 }
 
+// IsTcertEnabled returns true if proposals are signed with TCerts
+// instead of the enrollment certificate, when security is enabled
+func IsTcertEnabled() bool {
+	return myViper.GetBool("client.tcert.enabled")
+}
+
 // GetSecurityAlgorithm ...
 func GetSecurityAlgorithm() string {
 	return myViper.GetString("client.security.hashAlgorithm")
@@ -172,6 +186,83 @@ func GetSecurityLevel() int {
 
 }
 
+// GetSecurityProvider returns the provider of the crypto suite, SW or PKCS11
+func GetSecurityProvider() string {
+	provider := myViper.GetString("client.security.provider")
+	if provider == "" {
+		return "SW"
+	}
+	return strings.ToUpper(provider)
+}
+
+// GetSecurityProviderLibPath returns the path of the PKCS#11 library
+func GetSecurityProviderLibPath() string {
+	return myViper.GetString("client.security.pkcs11.library")
+}
+
+// GetSecurityProviderLabel returns the label of the PKCS#11 token, which
+// selects its slot
+func GetSecurityProviderLabel() string {
+	return myViper.GetString("client.security.pkcs11.label")
+}
+
+// GetSecurityProviderPin returns the PIN of the PKCS#11 token, read from
+// the environment variable named by client.security.pkcs11.pinEnv or from
+// the file client.security.pkcs11.pinFile. The PIN isn't kept in the config.
+func GetSecurityProviderPin() (string, error) {
+	pinEnv := myViper.GetString("client.security.pkcs11.pinEnv")
+	pinFile := myViper.GetString("client.security.pkcs11.pinFile")
+	if pinEnv != "" && pinFile != "" {
+		return "", fmt.Errorf("Only one of client.security.pkcs11.pinEnv and pinFile can be set")
+	}
+	if pinEnv != "" {
+		pin := os.Getenv(pinEnv)
+		if pin == "" {
+			return "", fmt.Errorf("Environment variable %s of the PKCS11 PIN is not set", pinEnv)
+		}
+		return pin, nil
+	}
+	if pinFile != "" {
+		data, err := ioutil.ReadFile(pinFile)
+		if err != nil {
+			return "", fmt.Errorf("Could not read the PKCS11 PIN file: %v", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", fmt.Errorf("The PKCS11 PIN is not configured, set client.security.pkcs11.pinEnv or pinFile")
+}
+
+// IsSecurityProviderSoftVerify returns true if signatures are verified in
+// software instead of the PKCS#11 token
+func IsSecurityProviderSoftVerify() bool {
+	return myViper.GetBool("client.security.pkcs11.softVerify")
+}
+
+// GetRetryAttempts returns the maximum number of attempts of network calls
+func GetRetryAttempts() int {
+	return myViper.GetInt("client.retry.attempts")
+}
+
+// GetRetryInitialBackoff returns the wait before the first retry
+func GetRetryInitialBackoff() time.Duration {
+	return myViper.GetDuration("client.retry.initialBackoff")
+}
+
+// GetRetryMaxBackoff returns the longest wait between retries
+func GetRetryMaxBackoff() time.Duration {
+	return myViper.GetDuration("client.retry.maxBackoff")
+}
+
+// GetRetryBackoffFactor returns the factor the wait grows by after each retry
+func GetRetryBackoffFactor() float64 {
+	return myViper.GetFloat64("client.retry.backoffFactor")
+}
+
+// GetRetryJitter returns the fraction of the wait that is randomized
+func GetRetryJitter() float64 {
+	return myViper.GetFloat64("client.retry.jitter")
+}
+
 // GetOrdererHost ...
 func GetOrdererHost() string {
 	return myViper.GetString("client.orderer.host")
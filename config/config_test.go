@@ -21,6 +21,7 @@ package config
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -78,6 +79,39 @@ func TestMultipleVipers(t *testing.T) {
 	}
 }
 
+func TestGetSecurityProviderPin(t *testing.T) {
+	defer myViper.Set("client.security.pkcs11.pinEnv", nil)
+	defer myViper.Set("client.security.pkcs11.pinFile", nil)
+
+	myViper.Set("client.security.pkcs11.pinEnv", "TEST_PKCS11_PIN")
+	os.Setenv("TEST_PKCS11_PIN", "1234")
+	defer os.Unsetenv("TEST_PKCS11_PIN")
+	if pin, err := GetSecurityProviderPin(); err != nil || pin != "1234" {
+		t.Fatalf("PIN should be read from the environment, got %s: %v", pin, err)
+	}
+
+	pinFile, err := ioutil.TempFile("", "pin")
+	if err != nil {
+		t.Fatalf("TempFile return error: %v", err)
+	}
+	defer os.Remove(pinFile.Name())
+	pinFile.WriteString("5678\n")
+	pinFile.Close()
+	myViper.Set("client.security.pkcs11.pinFile", pinFile.Name())
+	if _, err := GetSecurityProviderPin(); err == nil {
+		t.Fatalf("GetSecurityProviderPin should fail when both pinEnv and pinFile are set")
+	}
+	myViper.Set("client.security.pkcs11.pinEnv", "")
+	if pin, err := GetSecurityProviderPin(); err != nil || pin != "5678" {
+		t.Fatalf("PIN should be read from the file, got %s: %v", pin, err)
+	}
+
+	myViper.Set("client.security.pkcs11.pinFile", "")
+	if _, err := GetSecurityProviderPin(); err == nil {
+		t.Fatalf("GetSecurityProviderPin should fail without PIN")
+	}
+}
+
 func TestMain(m *testing.M) {
 	err := InitConfig("../integration_test/test_resources/config/config_test.yaml")
 	if err != nil {
@@ -0,0 +1,148 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+
+	config "github.com/hyperledger/fabric-sdk-go/config"
+)
+
+var (
+	cryptoSuitesMtx sync.Mutex
+	// crypto suites created from config, by provider options. The PKCS#11
+	// provider keeps a single session pool per process, so its suite is shared.
+	cryptoSuites = make(map[string]bccsp.BCCSP)
+)
+
+// NewClientFromConfig ...
+/**
+ * Returns a Client instance whose crypto suite is created from the
+ * client.security config, see NewCryptoSuiteFromConfig.
+ */
+func NewClientFromConfig() (Client, error) {
+	cryptoSuite, err := NewCryptoSuiteFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	client := NewClient()
+	client.SetCryptoSuite(cryptoSuite)
+	return client, nil
+}
+
+// NewCryptoSuiteFromConfig ...
+/**
+ * Returns the crypto suite configured in client.security:
+ * provider SW (the default) or PKCS11, hashAlgorithm and level.
+ * The PKCS11 provider uses the token labelled pkcs11.label of the library
+ * pkcs11.library, logged in with the PIN of pkcs11.pinEnv or pkcs11.pinFile.
+ * Keys are kept in client.keystore.path, or in memory if it isn't set.
+ */
+func NewCryptoSuiteFromConfig() (bccsp.BCCSP, error) {
+	opts, err := getFactoryOpts()
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := getFactoryOptsKey(opts)
+
+	cryptoSuitesMtx.Lock()
+	defer cryptoSuitesMtx.Unlock()
+	if cryptoSuite, ok := cryptoSuites[cacheKey]; ok {
+		return cryptoSuite, nil
+	}
+	var factory bccspFactory.BCCSPFactory
+	switch opts.ProviderName {
+	case bccspFactory.SoftwareBasedFactoryName:
+		factory = &bccspFactory.SWFactory{}
+	case bccspFactory.PKCS11BasedFactoryName:
+		factory = &bccspFactory.PKCS11Factory{}
+	}
+	cryptoSuite, err := factory.Get(opts)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create %s crypto suite: %v", opts.ProviderName, err)
+	}
+	cryptoSuites[cacheKey] = cryptoSuite
+	return cryptoSuite, nil
+}
+
+// getFactoryOpts returns the bccsp factory options of the config
+func getFactoryOpts() (*bccspFactory.FactoryOpts, error) {
+	hashFamily := strings.ToUpper(config.GetSecurityAlgorithm())
+	if hashFamily == "" {
+		hashFamily = "SHA2"
+	}
+	secLevel := config.GetSecurityLevel()
+	if secLevel == 0 {
+		secLevel = 256
+	}
+	// the signing hash must be supported too
+	if _, _, err := getHashOpts(); err != nil {
+		return nil, err
+	}
+	keyStorePath := config.GetKeyStorePath()
+
+	swOpts := &bccspFactory.SwOpts{HashFamily: hashFamily, SecLevel: secLevel, Ephemeral: keyStorePath == ""}
+	if keyStorePath != "" {
+		swOpts.FileKeystore = &bccspFactory.FileKeystoreOpts{KeyStorePath: keyStorePath}
+	}
+	opts := &bccspFactory.FactoryOpts{ProviderName: config.GetSecurityProvider(), SwOpts: swOpts}
+
+	switch opts.ProviderName {
+	case bccspFactory.SoftwareBasedFactoryName:
+		return opts, nil
+	case bccspFactory.PKCS11BasedFactoryName:
+		library := config.GetSecurityProviderLibPath()
+		if library == "" {
+			return nil, fmt.Errorf("client.security.pkcs11.library is not set")
+		}
+		label := config.GetSecurityProviderLabel()
+		if label == "" {
+			return nil, fmt.Errorf("client.security.pkcs11.label is not set")
+		}
+		pin, err := config.GetSecurityProviderPin()
+		if err != nil {
+			return nil, err
+		}
+		opts.Pkcs11Opts = &bccspFactory.PKCS11Opts{HashFamily: hashFamily, SecLevel: secLevel,
+			Ephemeral: keyStorePath == "", Library: library, Label: label, Pin: pin,
+			SoftVerify: config.IsSecurityProviderSoftVerify()}
+		if keyStorePath != "" {
+			opts.Pkcs11Opts.FileKeystore = &bccspFactory.FileKeystoreOpts{KeyStorePath: keyStorePath}
+		}
+		return opts, nil
+	}
+	return nil, fmt.Errorf("Unsupported security provider %s, must be SW or PKCS11", opts.ProviderName)
+}
+
+// getFactoryOptsKey identifies the crypto suite of opts, without its PIN
+func getFactoryOptsKey(opts *bccspFactory.FactoryOpts) string {
+	key := fmt.Sprintf("%s/%s/%d/%s", opts.ProviderName, opts.SwOpts.HashFamily,
+		opts.SwOpts.SecLevel, config.GetKeyStorePath())
+	if opts.Pkcs11Opts != nil {
+		key = fmt.Sprintf("%s/%s/%s/%t", key, opts.Pkcs11Opts.Library,
+			opts.Pkcs11Opts.Label, opts.Pkcs11Opts.SoftVerify)
+	}
+	return key
+}
@@ -0,0 +1,84 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/bccsp"
+
+	config "github.com/hyperledger/fabric-sdk-go/config"
+)
+
+func TestNewCryptoSuiteFromConfig(t *testing.T) {
+	viper := config.GetFabricClientViper()
+	defer viper.Set("client.security.provider", nil)
+	defer viper.Set("client.security.hashAlgorithm", nil)
+	defer viper.Set("client.security.level", nil)
+	defer viper.Set("client.security.pkcs11.library", nil)
+
+	client, err := NewClientFromConfig()
+	if err != nil {
+		t.Fatalf("NewClientFromConfig return error: %s", err)
+	}
+	cryptoSuite := client.GetCryptoSuite()
+	if cryptoSuite == nil {
+		t.Fatalf("Client should have a crypto suite")
+	}
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error: %s", err)
+	}
+	digest, _ := cryptoSuite.Hash([]byte("test"), &bccsp.SHAOpts{})
+	signature, err := cryptoSuite.Sign(key, digest, nil)
+	if err != nil {
+		t.Fatalf("Sign return error: %s", err)
+	}
+	if valid, err := cryptoSuite.Verify(key, signature, digest, nil); err != nil || !valid {
+		t.Fatalf("Signature should be valid: %v", err)
+	}
+	if other, _ := NewCryptoSuiteFromConfig(); other != cryptoSuite {
+		t.Fatalf("The crypto suite of a config should be shared")
+	}
+
+	viper.Set("client.security.hashAlgorithm", "SHA3")
+	viper.Set("client.security.level", 384)
+	if other, err := NewCryptoSuiteFromConfig(); err != nil || other == cryptoSuite {
+		t.Fatalf("Another crypto suite should be created for SHA3 384: %v", err)
+	}
+	viper.Set("client.security.level", 512)
+	if _, err := NewCryptoSuiteFromConfig(); err == nil {
+		t.Fatalf("NewCryptoSuiteFromConfig should fail for an unsupported level")
+	}
+	viper.Set("client.security.level", 256)
+
+	viper.Set("client.security.provider", "PKCS11")
+	if _, err := NewCryptoSuiteFromConfig(); err == nil {
+		t.Fatalf("NewCryptoSuiteFromConfig should fail without PKCS11 library")
+	}
+	viper.Set("client.security.pkcs11.library", "/nonexistent/libpkcs11.so")
+	if _, err := NewCryptoSuiteFromConfig(); err == nil {
+		t.Fatalf("NewCryptoSuiteFromConfig should fail without PKCS11 label")
+	}
+	viper.Set("client.security.provider", "HSM")
+	if _, err := NewCryptoSuiteFromConfig(); err == nil {
+		t.Fatalf("NewCryptoSuiteFromConfig should fail for an unknown provider")
+	}
+}
@@ -0,0 +1,464 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
+)
+
+const (
+	// endorserRecheckInterval is how long an endorser whose last proposal
+	// failed is considered unhealthy, before it is tried again
+	endorserRecheckInterval = 30 * time.Second
+	// latencySampleWeight is the weight of each response time in the
+	// moving average latency of an endorser
+	latencySampleWeight = 0.3
+)
+
+// EndorserHealth ...
+/**
+ * The health of an endorser, as seen from the proposals sent to it.
+ */
+type EndorserHealth struct {
+	// Healthy is false after a proposal failed, for endorserRecheckInterval
+	Healthy bool
+	// Latency is the moving average of the response times, 0 until it responded
+	Latency time.Duration
+	// Failures is the number of consecutive proposals that got no response
+	Failures    int
+	LastFailure time.Time
+}
+
+// EndorserSelector ...
+/**
+ * An EndorserSelector is a strategy choosing the peers of a chain that
+ * transaction proposals are sent to.
+ * Name identifies the strategy in the proposal responses.
+ * Select returns the endorsers among peers, which are ordered by URL,
+ * given the health of the peers by URL. Peers without health haven't
+ * been sent a proposal yet and are healthy.
+ */
+type EndorserSelector interface {
+	Name() string
+	Select(peers []Peer, health map[string]EndorserHealth) ([]Peer, error)
+}
+
+// Names of the endorser selection strategies
+const (
+	AllEndorsers             = "all"
+	PolicyEndorsers          = "policy"
+	RandomEndorsers          = "random"
+	RoundRobinEndorsers      = "round-robin"
+	LatencyWeightedEndorsers = "latency-weighted"
+)
+
+type allEndorserSelector struct{}
+
+// NewAllEndorserSelector ...
+/**
+ * Returns the default EndorserSelector, which selects all peers.
+ */
+func NewAllEndorserSelector() EndorserSelector {
+	return &allEndorserSelector{}
+}
+
+func (s *allEndorserSelector) Name() string {
+	return AllEndorsers
+}
+
+func (s *allEndorserSelector) Select(peers []Peer, health map[string]EndorserHealth) ([]Peer, error) {
+	return peers, nil
+}
+
+type randomEndorserSelector struct {
+	count int
+}
+
+// NewRandomEndorserSelector ...
+/**
+ * Returns an EndorserSelector of count random healthy peers. Unhealthy
+ * peers are selected only if there aren't enough healthy ones.
+ * @param {int} count The number of endorsers
+ */
+func NewRandomEndorserSelector(count int) (EndorserSelector, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	return &randomEndorserSelector{count: count}, nil
+}
+
+func (s *randomEndorserSelector) Name() string {
+	return RandomEndorsers
+}
+
+func (s *randomEndorserSelector) Select(peers []Peer, health map[string]EndorserHealth) ([]Peer, error) {
+	healthy, unhealthy := splitByHealth(peers, health)
+	shuffle(healthy)
+	shuffle(unhealthy)
+	return firstPeers(append(healthy, unhealthy...), s.count), nil
+}
+
+type roundRobinEndorserSelector struct {
+	count int
+	mtx   sync.Mutex
+	next  int
+}
+
+// NewRoundRobinEndorserSelector ...
+/**
+ * Returns an EndorserSelector of count healthy peers, starting with the
+ * next peer at each proposal. Unhealthy peers are selected only if there
+ * aren't enough healthy ones.
+ * @param {int} count The number of endorsers
+ */
+func NewRoundRobinEndorserSelector(count int) (EndorserSelector, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	return &roundRobinEndorserSelector{count: count}, nil
+}
+
+func (s *roundRobinEndorserSelector) Name() string {
+	return RoundRobinEndorsers
+}
+
+func (s *roundRobinEndorserSelector) Select(peers []Peer, health map[string]EndorserHealth) ([]Peer, error) {
+	healthy, unhealthy := splitByHealth(peers, health)
+	s.mtx.Lock()
+	next := s.next
+	s.next++
+	s.mtx.Unlock()
+
+	var selected []Peer
+	for i := range healthy {
+		selected = append(selected, healthy[(next+i)%len(healthy)])
+	}
+	return firstPeers(append(selected, unhealthy...), s.count), nil
+}
+
+type latencyWeightedEndorserSelector struct {
+	count int
+}
+
+// NewLatencyWeightedEndorserSelector ...
+/**
+ * Returns an EndorserSelector of count random healthy peers, where the
+ * chance of a peer is inversely proportional to its latency. Peers that
+ * haven't responded yet get the chance of the fastest peer. Unhealthy
+ * peers are selected only if there aren't enough healthy ones, fastest first.
+ * @param {int} count The number of endorsers
+ */
+func NewLatencyWeightedEndorserSelector(count int) (EndorserSelector, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	return &latencyWeightedEndorserSelector{count: count}, nil
+}
+
+func (s *latencyWeightedEndorserSelector) Name() string {
+	return LatencyWeightedEndorsers
+}
+
+func (s *latencyWeightedEndorserSelector) Select(peers []Peer, health map[string]EndorserHealth) ([]Peer, error) {
+	healthy, unhealthy := splitByHealth(peers, health)
+
+	weights := make([]float64, len(healthy))
+	maxWeight := 0.0
+	for i, peer := range healthy {
+		if latency := health[peer.GetURL()].Latency; latency > 0 {
+			weights[i] = 1 / latency.Seconds()
+			if weights[i] > maxWeight {
+				maxWeight = weights[i]
+			}
+		}
+	}
+	if maxWeight == 0 {
+		maxWeight = 1
+	}
+	for i := range weights {
+		if weights[i] == 0 {
+			weights[i] = maxWeight
+		}
+	}
+
+	var selected []Peer
+	for len(selected) < s.count && len(healthy) > 0 {
+		total := 0.0
+		for _, weight := range weights {
+			total += weight
+		}
+		i := 0
+		for r := rand.Float64() * total; i < len(weights)-1; i++ {
+			if r -= weights[i]; r < 0 {
+				break
+			}
+		}
+		selected = append(selected, healthy[i])
+		healthy = append(healthy[:i], healthy[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+	sortByLatency(unhealthy, health)
+	return firstPeers(append(selected, unhealthy...), s.count), nil
+}
+
+type policyEndorserSelector struct {
+	// the alternative numbers of endorsers by MSP ID that satisfy the
+	// policy, smallest first
+	requirements []mspCounts
+}
+
+// NewPolicyEndorserSelector ...
+/**
+ * Returns an EndorserSelector of the smallest set of peers that satisfies
+ * an endorsement policy, preferring healthy and fast peers.
+ * Policy principals must be MSP roles, they are matched by the MSP ID of
+ * the peers (see Peer.SetMspID). As when policies are evaluated, a peer
+ * satisfies at most one principal.
+ * @param {common.SignaturePolicyEnvelope} policy The endorsement policy
+ */
+func NewPolicyEndorserSelector(policy *common.SignaturePolicyEnvelope) (EndorserSelector, error) {
+	if policy.GetPolicy() == nil {
+		return nil, fmt.Errorf("policy is nil")
+	}
+	mspIDs := make([]string, len(policy.Identities))
+	for i, principal := range policy.Identities {
+		if principal.PrincipalClassification != common.MSPPrincipal_ROLE {
+			return nil, fmt.Errorf("Unsupported principal classification %s, endorsers are selected by MSP ID",
+				principal.PrincipalClassification)
+		}
+		role := &common.MSPRole{}
+		if err := proto.Unmarshal(principal.Principal, role); err != nil {
+			return nil, fmt.Errorf("Invalid MSP role principal: %v", err)
+		}
+		mspIDs[i] = role.MspIdentifier
+	}
+	requirements, err := getPolicyRequirements(policy.Policy, mspIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(requirements) == 0 {
+		return nil, fmt.Errorf("The endorsement policy can't be satisfied")
+	}
+	sort.Sort(bySize(requirements))
+	return &policyEndorserSelector{requirements: requirements}, nil
+}
+
+func (s *policyEndorserSelector) Name() string {
+	return PolicyEndorsers
+}
+
+func (s *policyEndorserSelector) Select(peers []Peer, health map[string]EndorserHealth) ([]Peer, error) {
+	healthyByMsp := make(map[string][]Peer)
+	allByMsp := make(map[string][]Peer)
+	for _, peer := range peers {
+		allByMsp[peer.GetMspID()] = append(allByMsp[peer.GetMspID()], peer)
+	}
+	for mspID, mspPeers := range allByMsp {
+		healthy, unhealthy := splitByHealth(mspPeers, health)
+		sortByLatency(healthy, health)
+		sortByLatency(unhealthy, health)
+		healthyByMsp[mspID] = healthy
+		allByMsp[mspID] = append(healthy, unhealthy...)
+	}
+
+	for _, byMsp := range []map[string][]Peer{healthyByMsp, allByMsp} {
+		for _, requirement := range s.requirements {
+			if selected := requirement.selectFrom(byMsp); selected != nil {
+				return selected, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("The peers can't satisfy the endorsement policy")
+}
+
+// mspCounts is a number of endorsers by MSP ID
+type mspCounts map[string]int
+
+func (m mspCounts) size() int {
+	size := 0
+	for _, count := range m {
+		size += count
+	}
+	return size
+}
+
+func (m mspCounts) key() string {
+	var keys []string
+	for mspID, count := range m {
+		keys = append(keys, fmt.Sprintf("%s:%d", mspID, count))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func (m mspCounts) plus(other mspCounts) mspCounts {
+	sum := make(mspCounts)
+	for mspID, count := range m {
+		sum[mspID] += count
+	}
+	for mspID, count := range other {
+		sum[mspID] += count
+	}
+	return sum
+}
+
+// covers returns whether m requires at least the endorsers of other
+func (m mspCounts) covers(other mspCounts) bool {
+	for mspID, count := range other {
+		if m[mspID] < count {
+			return false
+		}
+	}
+	return true
+}
+
+// selectFrom returns the first peers of each MSP that m requires, nil if
+// there aren't enough
+func (m mspCounts) selectFrom(peersByMsp map[string][]Peer) []Peer {
+	var mspIDs []string
+	for mspID := range m {
+		mspIDs = append(mspIDs, mspID)
+	}
+	sort.Strings(mspIDs)
+	selected := []Peer{}
+	for _, mspID := range mspIDs {
+		if len(peersByMsp[mspID]) < m[mspID] {
+			return nil
+		}
+		selected = append(selected, peersByMsp[mspID][:m[mspID]]...)
+	}
+	return selected
+}
+
+type bySize []mspCounts
+
+func (s bySize) Len() int      { return len(s) }
+func (s bySize) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySize) Less(i, j int) bool {
+	if s[i].size() != s[j].size() {
+		return s[i].size() < s[j].size()
+	}
+	return s[i].key() < s[j].key()
+}
+
+// getPolicyRequirements returns the alternative numbers of endorsers by
+// MSP ID that satisfy policy, leaving out those requiring more endorsers
+// than another alternative
+func getPolicyRequirements(policy *common.SignaturePolicy, mspIDs []string) ([]mspCounts, error) {
+	switch rule := policy.GetType().(type) {
+	case *common.SignaturePolicy_SignedBy:
+		if rule.SignedBy < 0 || int(rule.SignedBy) >= len(mspIDs) {
+			return nil, fmt.Errorf("Policy identity %d is out of range", rule.SignedBy)
+		}
+		return []mspCounts{{mspIDs[rule.SignedBy]: 1}}, nil
+	case *common.SignaturePolicy_NOutOf_:
+		var rules [][]mspCounts
+		for _, subPolicy := range rule.NOutOf.GetPolicies() {
+			requirements, err := getPolicyRequirements(subPolicy, mspIDs)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, requirements)
+		}
+		var requirements []mspCounts
+		var choose func(start int, left int, sum mspCounts)
+		choose = func(start int, left int, sum mspCounts) {
+			if left <= 0 {
+				requirements = append(requirements, sum)
+				return
+			}
+			for i := start; i <= len(rules)-left; i++ {
+				for _, requirement := range rules[i] {
+					choose(i+1, left-1, sum.plus(requirement))
+				}
+			}
+		}
+		choose(0, int(rule.NOutOf.N), mspCounts{})
+		return minimalRequirements(requirements), nil
+	}
+	return nil, fmt.Errorf("Unsupported signature policy type %T", policy.GetType())
+}
+
+// minimalRequirements removes the duplicate requirements and those which
+// cover another one
+func minimalRequirements(requirements []mspCounts) []mspCounts {
+	var minimal []mspCounts
+	for i, requirement := range requirements {
+		covering := false
+		for j, other := range requirements {
+			if i == j || !requirement.covers(other) {
+				continue
+			}
+			// of identical requirements, keep the first one
+			if !other.covers(requirement) || j < i {
+				covering = true
+				break
+			}
+		}
+		if !covering {
+			minimal = append(minimal, requirement)
+		}
+	}
+	return minimal
+}
+
+// splitByHealth returns the healthy and unhealthy peers, in order
+func splitByHealth(peers []Peer, health map[string]EndorserHealth) ([]Peer, []Peer) {
+	var healthy, unhealthy []Peer
+	for _, peer := range peers {
+		if h, ok := health[peer.GetURL()]; ok && !h.Healthy {
+			unhealthy = append(unhealthy, peer)
+		} else {
+			healthy = append(healthy, peer)
+		}
+	}
+	return healthy, unhealthy
+}
+
+// sortByLatency sorts peers fastest first, then those without latency
+func sortByLatency(peers []Peer, health map[string]EndorserHealth) {
+	sort.SliceStable(peers, func(i, j int) bool {
+		li := health[peers[i].GetURL()].Latency
+		lj := health[peers[j].GetURL()].Latency
+		return li > 0 && (lj == 0 || li < lj)
+	})
+}
+
+func shuffle(peers []Peer) {
+	for i := len(peers) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		peers[i], peers[j] = peers[j], peers[i]
+	}
+}
+
+func firstPeers(peers []Peer, count int) []Peer {
+	if len(peers) > count {
+		return peers[:count]
+	}
+	return peers
+}
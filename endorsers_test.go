@@ -0,0 +1,224 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/hyperledger/fabric-sdk-go/retry"
+)
+
+func TestPolicyEndorserSelector(t *testing.T) {
+	peers := []Peer{&mockPeer{MockURL: "org1peer1", MockMspID: "Org1MSP"},
+		&mockPeer{MockURL: "org1peer2", MockMspID: "Org1MSP"},
+		&mockPeer{MockURL: "org2peer1", MockMspID: "Org2MSP"},
+		&mockPeer{MockURL: "org3peer1", MockMspID: "Org3MSP"}}
+	health := map[string]EndorserHealth{"org1peer1": {Healthy: true, Latency: time.Second},
+		"org1peer2": {Healthy: true, Latency: time.Millisecond}}
+
+	// Org1 and either Org2 or Org3
+	policy := newTestPolicy(nOutOf(2, signedBy(0), nOutOf(1, signedBy(1), signedBy(2))),
+		"Org1MSP", "Org2MSP", "Org3MSP")
+	selector, err := NewPolicyEndorserSelector(policy)
+	if err != nil {
+		t.Fatalf("NewPolicyEndorserSelector return error: %v", err)
+	}
+	if selector.Name() != PolicyEndorsers {
+		t.Fatalf("Unexpected selector name %s", selector.Name())
+	}
+	endorsers, err := selector.Select(peers, health)
+	if err != nil {
+		t.Fatalf("Select return error: %v", err)
+	}
+	if urls := getURLs(endorsers); urls != "org1peer2,org2peer1" {
+		t.Fatalf("Expected the fastest Org1 peer and the Org2 peer, got %s", urls)
+	}
+	health["org2peer1"] = EndorserHealth{Healthy: false, Failures: 1}
+	endorsers, _ = selector.Select(peers, health)
+	if urls := getURLs(endorsers); urls != "org1peer2,org3peer1" {
+		t.Fatalf("Expected the Org3 peer instead of the unhealthy Org2 peer, got %s", urls)
+	}
+
+	// a peer satisfies a single principal
+	selector, _ = NewPolicyEndorserSelector(newTestPolicy(nOutOf(2, signedBy(0), signedBy(0)), "Org1MSP"))
+	endorsers, _ = selector.Select(peers, health)
+	if urls := getURLs(endorsers); urls != "org1peer1,org1peer2" {
+		t.Fatalf("Expected both Org1 peers, got %s", urls)
+	}
+	selector, _ = NewPolicyEndorserSelector(newTestPolicy(nOutOf(3, signedBy(0), signedBy(0), signedBy(0)), "Org1MSP"))
+	if _, err := selector.Select(peers, health); err == nil {
+		t.Fatalf("Select should fail when the peers can't satisfy the policy")
+	}
+
+	// unhealthy peers are selected when the healthy ones can't satisfy the policy
+	selector, _ = NewPolicyEndorserSelector(newTestPolicy(signedBy(0), "Org2MSP"))
+	endorsers, _ = selector.Select(peers, health)
+	if urls := getURLs(endorsers); urls != "org2peer1" {
+		t.Fatalf("Expected the unhealthy Org2 peer, got %s", urls)
+	}
+
+	if _, err := NewPolicyEndorserSelector(newTestPolicy(nOutOf(2, signedBy(0)), "Org1MSP")); err == nil {
+		t.Fatalf("NewPolicyEndorserSelector should fail for a policy that can't be satisfied")
+	}
+	if _, err := NewPolicyEndorserSelector(newTestPolicy(signedBy(1), "Org1MSP")); err == nil {
+		t.Fatalf("NewPolicyEndorserSelector should fail for an unknown identity")
+	}
+	identityPolicy := newTestPolicy(signedBy(0), "Org1MSP")
+	identityPolicy.Identities[0].PrincipalClassification = common.MSPPrincipal_IDENTITY
+	if _, err := NewPolicyEndorserSelector(identityPolicy); err == nil {
+		t.Fatalf("NewPolicyEndorserSelector should fail for identity principals")
+	}
+}
+
+func TestEndorserSelectors(t *testing.T) {
+	peers := []Peer{&mockPeer{MockURL: "peer1"}, &mockPeer{MockURL: "peer2"}, &mockPeer{MockURL: "peer3"}}
+	health := map[string]EndorserHealth{"peer1": {Healthy: true, Latency: time.Second},
+		"peer2": {Healthy: false, Failures: 1}, "peer3": {Healthy: true, Latency: time.Millisecond}}
+
+	if _, err := NewRoundRobinEndorserSelector(0); err == nil {
+		t.Fatalf("Selectors should require a positive count")
+	}
+	roundRobin, _ := NewRoundRobinEndorserSelector(1)
+	for _, expected := range []string{"peer1", "peer3", "peer1"} {
+		endorsers, _ := roundRobin.Select(peers, health)
+		if urls := getURLs(endorsers); urls != expected {
+			t.Fatalf("Expected round-robin endorser %s, got %s", expected, urls)
+		}
+	}
+
+	random, _ := NewRandomEndorserSelector(2)
+	for i := 0; i < 10; i++ {
+		endorsers, _ := random.Select(peers, health)
+		if urls := getURLs(endorsers); urls != "peer1,peer3" {
+			t.Fatalf("Expected the healthy peers, got %s", urls)
+		}
+	}
+	random, _ = NewRandomEndorserSelector(3)
+	if endorsers, _ := random.Select(peers, health); len(endorsers) != 3 {
+		t.Fatalf("Unhealthy peers should complete the selection")
+	}
+
+	latencyWeighted, _ := NewLatencyWeightedEndorserSelector(1)
+	fastest := 0
+	for i := 0; i < 100; i++ {
+		endorsers, _ := latencyWeighted.Select(peers, health)
+		if urls := getURLs(endorsers); urls == "peer3" {
+			fastest++
+		} else if urls != "peer1" {
+			t.Fatalf("Expected a healthy peer, got %s", urls)
+		}
+	}
+	if fastest < 90 {
+		t.Fatalf("The fastest peer should be selected most of the time, got %d of 100", fastest)
+	}
+
+	if endorsers, _ := NewAllEndorserSelector().Select(peers, health); len(endorsers) != 3 {
+		t.Fatalf("All peers should be selected")
+	}
+}
+
+func TestSendTransactionProposalToSelectedEndorsers(t *testing.T) {
+	client := NewClient()
+	client.SetRetryPolicy(retry.NoRetry())
+	testChain, err := NewChain("testChain", client)
+	if err != nil {
+		t.Fatalf("NewChain return error: %s", err)
+	}
+	failing := &flakyPeer{mockPeer: mockPeer{MockURL: "peer1", MockMspID: "Org1MSP"}, failures: 1,
+		err: grpc.Errorf(codes.Unavailable, "connection refused")}
+	testChain.AddPeer(failing)
+	testChain.AddPeer(&mockPeer{MockURL: "peer2", MockMspID: "Org1MSP"})
+	testChain.AddPeer(&mockPeer{MockURL: "peer3", MockMspID: "Org2MSP"})
+
+	if testChain.GetEndorserSelector().Name() != AllEndorsers {
+		t.Fatalf("Proposals should be sent to all peers by default")
+	}
+	selector, _ := NewRoundRobinEndorserSelector(1)
+	testChain.SetEndorserSelector(selector)
+
+	responses, err := testChain.SendTransactionProposal(&pb.SignedProposal{}, 0)
+	if err != nil {
+		t.Fatalf("SendTransactionProposal return error: %s", err)
+	}
+	resp := responses["peer1"]
+	if len(responses) != 1 || resp == nil || resp.Err == nil {
+		t.Fatalf("The proposal should be sent to the failing peer only, got %v", responses)
+	}
+	if resp.MspID != "Org1MSP" || resp.Selector != RoundRobinEndorsers {
+		t.Fatalf("The response should show the endorser's MSP and the selector, got %s and %s", resp.MspID, resp.Selector)
+	}
+	if health := testChain.GetEndorserHealth()["peer1"]; health.Healthy || health.Failures != 1 {
+		t.Fatalf("The failing peer should be unhealthy, got %v", health)
+	}
+
+	// the unhealthy peer is skipped
+	for _, expected := range []string{"peer3", "peer2"} {
+		responses, _ = testChain.SendTransactionProposal(&pb.SignedProposal{}, 0)
+		if resp := responses[expected]; len(responses) != 1 || resp == nil || resp.Err != nil {
+			t.Fatalf("The proposal should be sent to %s, got %v", expected, responses)
+		}
+	}
+	if health := testChain.GetEndorserHealth()["peer2"]; !health.Healthy || health.Latency <= 0 {
+		t.Fatalf("The peer should be healthy with a latency, got %v", health)
+	}
+
+	testChain.SetEndorserSelector(nil)
+	if responses, _ = testChain.SendTransactionProposal(&pb.SignedProposal{}, 0); len(responses) != 3 {
+		t.Fatalf("The proposal should be sent to all peers, got %v", responses)
+	}
+}
+
+func newTestPolicy(policy *common.SignaturePolicy, mspIDs ...string) *common.SignaturePolicyEnvelope {
+	envelope := &common.SignaturePolicyEnvelope{Policy: policy}
+	for _, mspID := range mspIDs {
+		role, _ := proto.Marshal(&common.MSPRole{MspIdentifier: mspID, Role: common.MSPRole_MEMBER})
+		envelope.Identities = append(envelope.Identities,
+			&common.MSPPrincipal{PrincipalClassification: common.MSPPrincipal_ROLE, Principal: role})
+	}
+	return envelope
+}
+
+func signedBy(index int32) *common.SignaturePolicy {
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: index}}
+}
+
+func nOutOf(n int32, policies ...*common.SignaturePolicy) *common.SignaturePolicy {
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_NOutOf_{
+		NOutOf: &common.SignaturePolicy_NOutOf{N: n, Policies: policies}}}
+}
+
+// getURLs returns the sorted URLs of peers
+func getURLs(peers []Peer) string {
+	var urls []string
+	for _, peer := range peers {
+		urls = append(urls, peer.GetURL())
+	}
+	sort.Strings(urls)
+	return strings.Join(urls, ",")
+}
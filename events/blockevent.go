@@ -0,0 +1,171 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+)
+
+// BlockEvent ...
+/**
+ * The BlockEvent is passed to block event registrants. It holds the
+ * block received from the event source along with a summary of
+ * every transaction in the block.
+ */
+type BlockEvent struct {
+	// block number
+	Number uint64
+	// channel the block belongs to
+	ChannelID string
+	// the full block, nil for filtered registrations
+	Block *common.Block
+	// transaction summaries, in the order they appear in the block
+	Transactions []*TransactionSummary
+}
+
+// TransactionSummary ...
+/**
+ * The TransactionSummary holds the decoded details of a single
+ * transaction in a block.
+ */
+type TransactionSummary struct {
+	// transaction id
+	TxID string
+	// channel the transaction was submitted on
+	ChannelID string
+	// validation code set by the committing peer
+	ValidationCode pb.TxValidationCode
+	// chaincode events emitted by the transaction
+	ChaincodeEvents []*pb.ChaincodeEvent
+}
+
+// newBlockEvent decodes the transactions of block into a BlockEvent
+func newBlockEvent(block *common.Block) *BlockEvent {
+	blockEvent := &BlockEvent{Block: block}
+	if block.Header != nil {
+		blockEvent.Number = block.Header.Number
+	}
+	if block.Data == nil {
+		return blockEvent
+	}
+
+	txFilter := getTxValidationFlags(block)
+	for i, data := range block.Data.Data {
+		summary, err := getTransactionSummary(data)
+		if err != nil {
+			// keep a summary so that Transactions lines up with block.Data.Data
+			logger.Warningf("Could not decode transaction %d of block %d: %s", i, blockEvent.Number, err)
+			summary = &TransactionSummary{}
+		}
+		if i < len(txFilter) {
+			summary.ValidationCode = pb.TxValidationCode(txFilter[i])
+		}
+		blockEvent.Transactions = append(blockEvent.Transactions, summary)
+		if blockEvent.ChannelID == "" {
+			blockEvent.ChannelID = summary.ChannelID
+		}
+	}
+	return blockEvent
+}
+
+// filtered returns a copy of the BlockEvent without the block and
+// without chaincode event payloads
+func (e *BlockEvent) filtered() *BlockEvent {
+	filteredEvent := &BlockEvent{Number: e.Number, ChannelID: e.ChannelID}
+	for _, tx := range e.Transactions {
+		filteredTx := &TransactionSummary{TxID: tx.TxID, ChannelID: tx.ChannelID,
+			ValidationCode: tx.ValidationCode}
+		for _, ccEvent := range tx.ChaincodeEvents {
+			filteredTx.ChaincodeEvents = append(filteredTx.ChaincodeEvents, &pb.ChaincodeEvent{
+				ChaincodeId: ccEvent.ChaincodeId, TxId: ccEvent.TxId, EventName: ccEvent.EventName})
+		}
+		filteredEvent.Transactions = append(filteredEvent.Transactions, filteredTx)
+	}
+	return filteredEvent
+}
+
+// getTxValidationFlags returns the validation code of each transaction
+// in the block, one byte per transaction
+func getTxValidationFlags(block *common.Block) []byte {
+	if block.Metadata == nil || len(block.Metadata.Metadata) <= int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		return nil
+	}
+	return block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+}
+
+// getTransactionSummary decodes an envelope from the block's data
+func getTransactionSummary(data []byte) (*TransactionSummary, error) {
+	env, err := utils.GetEnvelopeFromBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := utils.GetPayload(env)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Header == nil {
+		return nil, fmt.Errorf("payload header is nil")
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+		return nil, err
+	}
+
+	summary := &TransactionSummary{TxID: channelHeader.TxId, ChannelID: channelHeader.ChannelId}
+	if common.HeaderType(channelHeader.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return summary, nil
+	}
+
+	ccEvents, err := getChaincodeEvents(payload.Data)
+	if err != nil {
+		logger.Warningf("Could not decode chaincode events of transaction %s: %s", summary.TxID, err)
+	}
+	summary.ChaincodeEvents = ccEvents
+	return summary, nil
+}
+
+// getChaincodeEvents decodes the chaincode events of an endorser transaction
+func getChaincodeEvents(txBytes []byte) ([]*pb.ChaincodeEvent, error) {
+	tx, err := utils.GetTransaction(txBytes)
+	if err != nil {
+		return nil, err
+	}
+	var ccEvents []*pb.ChaincodeEvent
+	for _, action := range tx.Actions {
+		_, ccAction, err := utils.GetPayloads(action)
+		if err != nil {
+			return ccEvents, err
+		}
+		if ccAction == nil || len(ccAction.Events) == 0 {
+			continue
+		}
+		ccEvent, err := utils.GetChaincodeEvents(ccAction.Events)
+		if err != nil {
+			return ccEvents, err
+		}
+		ccEvents = append(ccEvents, ccEvent)
+	}
+	return ccEvents, nil
+}
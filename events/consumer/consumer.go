@@ -29,6 +29,7 @@ import (
 	ehpb "github.com/hyperledger/fabric/protos/peer"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 )
 
@@ -219,7 +220,8 @@ func (ec *eventsClient) processEvents() error {
 func (ec *eventsClient) Start() error {
 	conn, err := newEventsClientConnectionWithAddress(ec.peerAddress)
 	if err != nil {
-		return fmt.Errorf("Could not create client conn to %s", ec.peerAddress)
+		// connection failures are transient, see retry.DefaultRetryableCodes
+		return grpc.Errorf(codes.Unavailable, "Could not create client conn to %s: %v", ec.peerAddress, err)
 	}
 
 	ies, err := ec.adapter.GetInterestedEvents()
@@ -234,7 +236,7 @@ func (ec *eventsClient) Start() error {
 	serverClient := ehpb.NewEventsClient(conn)
 	ec.stream, err = serverClient.Chat(context.Background())
 	if err != nil {
-		return fmt.Errorf("Could not create client conn to %s", ec.peerAddress)
+		return grpc.Errorf(codes.Unavailable, "Could not create client conn to %s: %v", ec.peerAddress, err)
 	}
 
 	if err = ec.register(ies); err != nil {
@@ -0,0 +1,458 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
+	common "github.com/hyperledger/fabric/protos/common"
+)
+
+const checkpointKeyPrefix = "subscription."
+
+// DurableSubscription ...
+/**
+ * The DurableSubscription delivers every transaction of every block to a
+ * handler across restarts. The position of the last transaction processed
+ * by the handler is saved as a checkpoint in a KeyValueStore under the
+ * subscription name. On start, blocks after the checkpoint are replayed
+ * from a BlockSource before live events from the EventHub are processed.
+ * A TransactionalEventHandler saves the checkpoint along with its own
+ * writes, so every transaction is processed exactly once. A
+ * DurableEventHandler has the checkpoint saved after it returns: if the
+ * process stops in between, the transaction is delivered again.
+ */
+type DurableSubscription interface {
+	GetName() string
+	SetChannelID(channelID string)
+	SetStartBlock(number uint64)
+	GetCheckpoint() (*Checkpoint, error)
+	Start() error
+	Stop()
+	Err() error
+}
+
+// DurableEventHandler ...
+/**
+ * Processes a single transaction of a block. Returning nil acknowledges
+ * the transaction and advances the checkpoint. Returning an error stops
+ * the subscription without advancing the checkpoint, so the transaction
+ * is delivered again once the subscription is restarted. The handler may
+ * be called again for a transaction it acknowledged, see DurableSubscription.
+ */
+type DurableEventHandler func(blockEvent *BlockEvent, txIndex int) error
+
+// TransactionalEventHandler ...
+/**
+ * Processes a single transaction of a block, and saves the checkpoint
+ * update in the subscription's store in the same atomic write as its own
+ * results, e.g. with SQLKeyValueStore.SetValueInTx in the transaction
+ * holding its own writes. Returning nil acknowledges that both were
+ * committed. Returning an error stops the subscription, the transaction
+ * is delivered again once the subscription is restarted unless the
+ * checkpoint update was committed.
+ */
+type TransactionalEventHandler func(blockEvent *BlockEvent, txIndex int, update *CheckpointUpdate) error
+
+// CheckpointUpdate ...
+/**
+ * The checkpoint of a processed transaction, and the key and value that
+ * save it in the subscription's store.
+ */
+type CheckpointUpdate struct {
+	Checkpoint *Checkpoint
+	Key        string
+	Value      []byte
+}
+
+// BlockSource ...
+/**
+ * The BlockSource is used by durable subscriptions to replay blocks
+ * missed while the subscription was not running, for example through
+ * a ledger query or an orderer Deliver stream. fabricsdk.ChainBlockSource
+ * reads them from the ledger of a chain's peers.
+ */
+type BlockSource interface {
+	GetBlockHeight() (uint64, error)
+	GetBlock(number uint64) (*common.Block, error)
+}
+
+// Checkpoint ...
+/**
+ * The Checkpoint holds the position of the last transaction processed
+ * by a durable subscription.
+ */
+type Checkpoint struct {
+	BlockNumber uint64
+	TxIndex     int
+}
+
+type durableSubscription struct {
+	name       string
+	eventHub   EventHub
+	store      kvs.KeyValueStore
+	source     BlockSource
+	handler    DurableEventHandler
+	txHandler  TransactionalEventHandler
+	channelID  string
+	startBlock uint64
+
+	// Protects pending, running and err
+	mtx     sync.Mutex
+	pending []*common.Block
+	running bool
+	err     error
+
+	// only accessed by the goroutine processing events
+	checkpoint *Checkpoint
+
+	registration *BlockCBE
+	notify       chan struct{}
+	stop         chan struct{}
+	stopOnce     *sync.Once
+	done         chan struct{}
+}
+
+// NewDurableSubscription ...
+/**
+ * @param {string} name under which the checkpoint is saved
+ * @param {EventHub} eventHub source of live block events
+ * @param {KeyValueStore} store where the checkpoint is saved
+ * @param {BlockSource} source used to replay missed blocks, may be nil
+ * in which case only live events are processed and missed blocks are
+ * skipped, see fabricsdk.NewChainBlockSource
+ * @param {DurableEventHandler} handler called for every transaction
+ */
+func NewDurableSubscription(name string, eventHub EventHub, store kvs.KeyValueStore,
+	source BlockSource, handler DurableEventHandler) (DurableSubscription, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Failed to create DurableSubscription. Missing requirement 'name' parameter.")
+	}
+	if eventHub == nil {
+		return nil, fmt.Errorf("Failed to create DurableSubscription. Missing requirement 'eventHub' parameter.")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("Failed to create DurableSubscription. Missing requirement 'store' parameter.")
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("Failed to create DurableSubscription. Missing requirement 'handler' parameter.")
+	}
+	return &durableSubscription{name: name, eventHub: eventHub, store: store,
+		source: source, handler: handler}, nil
+}
+
+// NewTransactionalDurableSubscription ...
+/**
+ * Create a DurableSubscription that processes every transaction exactly
+ * once, with a handler that saves the checkpoint along with its own writes.
+ * @param {string} name under which the checkpoint is saved
+ * @param {EventHub} eventHub source of live block events
+ * @param {KeyValueStore} store where the handler saves the checkpoint
+ * @param {BlockSource} source used to replay missed blocks, may be nil
+ * in which case only live events are processed and missed blocks are
+ * skipped, see fabricsdk.NewChainBlockSource
+ * @param {TransactionalEventHandler} handler called for every transaction
+ */
+func NewTransactionalDurableSubscription(name string, eventHub EventHub, store kvs.KeyValueStore,
+	source BlockSource, handler TransactionalEventHandler) (DurableSubscription, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("Failed to create DurableSubscription. Missing requirement 'handler' parameter.")
+	}
+	subscription, err := NewDurableSubscription(name, eventHub, store, source,
+		func(*BlockEvent, int) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	subscription.(*durableSubscription).txHandler = handler
+	return subscription, nil
+}
+
+// GetName ...
+/**
+ * Get the subscription name.
+ */
+func (s *durableSubscription) GetName() string {
+	return s.name
+}
+
+// SetChannelID ...
+/**
+ * Set the channel whose blocks are processed. Must be set when the
+ * EventHub serves several channels, since block numbers are per channel.
+ */
+func (s *durableSubscription) SetChannelID(channelID string) {
+	s.channelID = channelID
+}
+
+// SetStartBlock ...
+/**
+ * Set the block to start from when no checkpoint has been saved yet.
+ * Defaults to block 0.
+ */
+func (s *durableSubscription) SetStartBlock(number uint64) {
+	s.startBlock = number
+}
+
+// GetCheckpoint ...
+/**
+ * Get the saved checkpoint.
+ * @returns {Checkpoint} The checkpoint, or nil if none was saved yet.
+ */
+func (s *durableSubscription) GetCheckpoint() (*Checkpoint, error) {
+	value, err := s.store.GetValue(checkpointKeyPrefix + s.name)
+	if kvs.IsKeyNotFound(err) {
+		// no checkpoint saved yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("store GetValue return error: %v", err)
+	}
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(value, checkpoint); err != nil {
+		return nil, fmt.Errorf("Unmarshal checkpoint return error: %v", err)
+	}
+	return checkpoint, nil
+}
+
+// Start ...
+/**
+ * Replays the blocks after the checkpoint from the BlockSource, then starts
+ * processing live block events from the EventHub. Live events received
+ * during the replay are buffered and processed afterwards.
+ */
+func (s *durableSubscription) Start() error {
+	s.mtx.Lock()
+	if s.running {
+		s.mtx.Unlock()
+		return fmt.Errorf("Subscription %s is already started", s.name)
+	}
+	s.mtx.Unlock()
+
+	checkpoint, err := s.GetCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	s.checkpoint = checkpoint
+
+	s.mtx.Lock()
+	s.pending = nil
+	s.err = nil
+	s.running = true
+	s.notify = make(chan struct{}, 1)
+	s.stop = make(chan struct{})
+	s.stopOnce = &sync.Once{}
+	s.done = make(chan struct{})
+	s.mtx.Unlock()
+
+	s.registration = s.eventHub.RegisterBlockEventForChannel(s.channelID, s.enqueue)
+
+	if s.source != nil {
+		height, err := s.source.GetBlockHeight()
+		if err == nil && height > 0 {
+			err = s.replay(height - 1)
+		}
+		if err != nil {
+			s.eventHub.UnregisterBlockEvent(s.registration)
+			s.setStopped(err)
+			close(s.done)
+			return fmt.Errorf("Replay for subscription %s failed: %v", s.name, err)
+		}
+	}
+
+	go s.processEvents()
+	return nil
+}
+
+// Stop ...
+/**
+ * Stops processing events. Pending events are dropped and will be
+ * replayed from the checkpoint on the next start. Returns once the
+ * subscription has stopped, concurrent calls all wait for it.
+ */
+func (s *durableSubscription) Stop() {
+	s.mtx.Lock()
+	if !s.running {
+		s.mtx.Unlock()
+		return
+	}
+	stop, stopOnce, done := s.stop, s.stopOnce, s.done
+	s.mtx.Unlock()
+
+	stopOnce.Do(func() { close(stop) })
+	<-done
+}
+
+// Err ...
+/**
+ * Get the error that stopped the subscription, if any.
+ */
+func (s *durableSubscription) Err() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.err
+}
+
+// enqueue is the block callback registered with the EventHub
+func (s *durableSubscription) enqueue(blockEvent *BlockEvent) {
+	s.mtx.Lock()
+	s.pending = append(s.pending, blockEvent.Block)
+	s.mtx.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *durableSubscription) processEvents() {
+	defer close(s.done)
+	defer s.eventHub.UnregisterBlockEvent(s.registration)
+
+	for {
+		select {
+		case <-s.stop:
+			s.setStopped(nil)
+			return
+		case <-s.notify:
+		}
+
+		s.mtx.Lock()
+		blocks := s.pending
+		s.pending = nil
+		s.mtx.Unlock()
+
+		for _, block := range blocks {
+			if err := s.processLiveBlock(block); err != nil {
+				logger.Errorf("Subscription %s stopped: %v", s.name, err)
+				s.setStopped(err)
+				return
+			}
+		}
+	}
+}
+
+// processLiveBlock replays any blocks missed since the checkpoint before
+// processing block
+func (s *durableSubscription) processLiveBlock(block *common.Block) error {
+	number := block.Header.Number
+	next := s.nextBlock()
+	if number > next && s.source != nil {
+		logger.Debugf("Subscription %s replaying blocks %d to %d", s.name, next, number-1)
+		if err := s.replay(number - 1); err != nil {
+			return err
+		}
+	} else if number > next && s.checkpoint != nil {
+		logger.Warningf("Subscription %s missed blocks %d to %d", s.name, next, number-1)
+	}
+	return s.processBlock(block)
+}
+
+// replay processes the blocks after the checkpoint up to and including last
+func (s *durableSubscription) replay(last uint64) error {
+	for number := s.firstReplayBlock(); number <= last; number++ {
+		block, err := s.source.GetBlock(number)
+		if err != nil {
+			return err
+		}
+		if err := s.processBlock(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processBlock calls the handler for every transaction after the checkpoint
+func (s *durableSubscription) processBlock(block *common.Block) error {
+	if block == nil || block.Header == nil {
+		return fmt.Errorf("received block without header")
+	}
+	number := block.Header.Number
+	firstTx := 0
+	if s.checkpoint != nil {
+		if number < s.checkpoint.BlockNumber {
+			return nil
+		}
+		if number == s.checkpoint.BlockNumber {
+			firstTx = s.checkpoint.TxIndex + 1
+		}
+	} else if number < s.startBlock {
+		return nil
+	}
+
+	blockEvent := newBlockEvent(block)
+	for i := firstTx; i < len(blockEvent.Transactions); i++ {
+		update, err := s.newCheckpointUpdate(&Checkpoint{BlockNumber: number, TxIndex: i})
+		if err != nil {
+			return err
+		}
+		if s.txHandler != nil {
+			if err := s.txHandler(blockEvent, i, update); err != nil {
+				return fmt.Errorf("handler failed for transaction %d of block %d: %v", i, number, err)
+			}
+			s.checkpoint = update.Checkpoint
+			continue
+		}
+		if err := s.handler(blockEvent, i); err != nil {
+			return fmt.Errorf("handler failed for transaction %d of block %d: %v", i, number, err)
+		}
+		if err := s.store.SetValue(update.Key, update.Value); err != nil {
+			return fmt.Errorf("store SetValue return error: %v", err)
+		}
+		s.checkpoint = update.Checkpoint
+	}
+	return nil
+}
+
+func (s *durableSubscription) newCheckpointUpdate(checkpoint *Checkpoint) (*CheckpointUpdate, error) {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Marshal json return error: %v", err)
+	}
+	return &CheckpointUpdate{Checkpoint: checkpoint, Key: checkpointKeyPrefix + s.name, Value: data}, nil
+}
+
+// firstReplayBlock is the block holding the first unprocessed
+// transaction. The checkpoint block is replayed again in case it was
+// only partially processed.
+func (s *durableSubscription) firstReplayBlock() uint64 {
+	if s.checkpoint == nil {
+		return s.startBlock
+	}
+	return s.checkpoint.BlockNumber
+}
+
+// nextBlock is the first block after the checkpoint
+func (s *durableSubscription) nextBlock() uint64 {
+	if s.checkpoint == nil {
+		return s.startBlock
+	}
+	return s.checkpoint.BlockNumber + 1
+}
+
+func (s *durableSubscription) setStopped(err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.running = false
+	s.err = err
+}
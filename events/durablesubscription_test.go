@@ -0,0 +1,246 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type mockBlockSource struct {
+	blocks []*common.Block
+}
+
+func (m *mockBlockSource) GetBlockHeight() (uint64, error) {
+	return uint64(len(m.blocks)), nil
+}
+
+func (m *mockBlockSource) GetBlock(number uint64) (*common.Block, error) {
+	if number >= uint64(len(m.blocks)) {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	return m.blocks[number], nil
+}
+
+func TestDurableSubscription(t *testing.T) {
+	dir, err := ioutil.TempDir("", "durablesubscription")
+	if err != nil {
+		t.Fatalf("TempDir return error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := kvs.CreateNewFileKeyValueStore(dir)
+	if err != nil {
+		t.Fatalf("CreateNewFileKeyValueStore return error: %s", err)
+	}
+
+	source := &mockBlockSource{}
+	for i := 0; i < 3; i++ {
+		source.blocks = append(source.blocks, createTestBlock(t, uint64(i), []*testTx{
+			{txID: fmt.Sprintf("tx%d.0", i)}, {txID: fmt.Sprintf("tx%d.1", i)}}))
+	}
+
+	processed := make(chan string, 100)
+	failTxID := "tx4.1"
+	handler := func(blockEvent *BlockEvent, txIndex int) error {
+		txID := blockEvent.Transactions[txIndex].TxID
+		if txID == failTxID {
+			return fmt.Errorf("cannot process %s", txID)
+		}
+		processed <- txID
+		return nil
+	}
+
+	eventHub := NewEventHub()
+	subscription, err := NewDurableSubscription("test", eventHub, store, source, handler)
+	if err != nil {
+		t.Fatalf("NewDurableSubscription return error: %s", err)
+	}
+	if err := subscription.Start(); err != nil {
+		t.Fatalf("Start return error: %s", err)
+	}
+	expectProcessed(t, processed, "tx0.0", "tx0.1", "tx1.0", "tx1.1", "tx2.0", "tx2.1")
+
+	// live block 4 arrives before block 3, which must be replayed from the source
+	for i := 3; i < 5; i++ {
+		source.blocks = append(source.blocks, createTestBlock(t, uint64(i), []*testTx{
+			{txID: fmt.Sprintf("tx%d.0", i)}, {txID: fmt.Sprintf("tx%d.1", i)}}))
+	}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: source.blocks[4]}})
+	expectProcessed(t, processed, "tx3.0", "tx3.1", "tx4.0")
+
+	waitForStop(t, subscription)
+	checkpoint, err := subscription.GetCheckpoint()
+	if err != nil {
+		t.Fatalf("GetCheckpoint return error: %s", err)
+	}
+	if checkpoint.BlockNumber != 4 || checkpoint.TxIndex != 0 {
+		t.Fatalf("Checkpoint should not advance past failed transaction: %v", checkpoint)
+	}
+
+	// a new subscription with the same name resumes after the checkpoint
+	failTxID = ""
+	subscription, err = NewDurableSubscription("test", NewEventHub(), store, source, handler)
+	if err != nil {
+		t.Fatalf("NewDurableSubscription return error: %s", err)
+	}
+	if err := subscription.Start(); err != nil {
+		t.Fatalf("Start return error: %s", err)
+	}
+	expectProcessed(t, processed, "tx4.1")
+	select {
+	case txID := <-processed:
+		t.Fatalf("Transaction %s processed twice", txID)
+	default:
+	}
+
+	// concurrent stops all wait for the subscription to stop
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			subscription.Stop()
+		}()
+	}
+	wg.Wait()
+	if err := subscription.Start(); err != nil {
+		t.Fatalf("Start after Stop return error: %s", err)
+	}
+	subscription.Stop()
+}
+
+func TestTransactionalDurableSubscription(t *testing.T) {
+	dir, err := ioutil.TempDir("", "durablesubscription")
+	if err != nil {
+		t.Fatalf("TempDir return error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := sql.Open("sqlite3", path.Join(dir, "subscription.db"))
+	if err != nil {
+		t.Fatalf("sql.Open return error: %s", err)
+	}
+	defer db.Close()
+	store, err := kvs.CreateNewSQLKeyValueStore(db, "sqlite3", "test")
+	if err != nil {
+		t.Fatalf("CreateNewSQLKeyValueStore return error: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE results (tx_id VARCHAR(64) NOT NULL)"); err != nil {
+		t.Fatalf("CREATE TABLE return error: %s", err)
+	}
+
+	source := &mockBlockSource{}
+	for i := 0; i < 2; i++ {
+		source.blocks = append(source.blocks, createTestBlock(t, uint64(i), []*testTx{
+			{txID: fmt.Sprintf("tx%d.0", i)}, {txID: fmt.Sprintf("tx%d.1", i)}}))
+	}
+	// the handler fails after committing tx0.1, and before committing tx1.0
+	failAfterCommit, failBeforeCommit := "tx0.1", "tx1.0"
+	handler := func(blockEvent *BlockEvent, txIndex int, update *CheckpointUpdate) error {
+		txID := blockEvent.Transactions[txIndex].TxID
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO results (tx_id) VALUES (?)", txID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := store.SetValueInTx(tx, update.Key, update.Value); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if txID == failBeforeCommit {
+			tx.Rollback()
+			return fmt.Errorf("cannot commit %s", txID)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		if txID == failAfterCommit {
+			return fmt.Errorf("stopped after committing %s", txID)
+		}
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		subscription, err := NewTransactionalDurableSubscription("test", NewEventHub(), store, source, handler)
+		if err != nil {
+			t.Fatalf("NewTransactionalDurableSubscription return error: %s", err)
+		}
+		if err := subscription.Start(); err == nil {
+			subscription.Stop()
+		}
+		if i == 0 {
+			failAfterCommit = ""
+		} else {
+			failBeforeCommit = ""
+		}
+	}
+
+	rows, err := db.Query("SELECT tx_id FROM results ORDER BY tx_id")
+	if err != nil {
+		t.Fatalf("SELECT return error: %s", err)
+	}
+	defer rows.Close()
+	var results []string
+	for rows.Next() {
+		var txID string
+		rows.Scan(&txID)
+		results = append(results, txID)
+	}
+	if strings.Join(results, ",") != "tx0.0,tx0.1,tx1.0,tx1.1" {
+		t.Fatalf("Every transaction should be processed exactly once, got %v", results)
+	}
+}
+
+func expectProcessed(t *testing.T, processed chan string, txIDs ...string) {
+	for _, expected := range txIDs {
+		select {
+		case txID := <-processed:
+			if txID != expected {
+				t.Fatalf("Expected %s to be processed, got %s", expected, txID)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("Timed out waiting for %s to be processed", expected)
+		}
+	}
+}
+
+func waitForStop(t *testing.T, subscription DurableSubscription) {
+	for i := 0; i < 500; i++ {
+		if subscription.Err() != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Subscription didn't stop on handler error")
+}
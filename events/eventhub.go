@@ -22,9 +22,11 @@ package events
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	consumer "github.com/hyperledger/fabric-sdk-go/events/consumer"
+	"github.com/hyperledger/fabric-sdk-go/retry"
 	common "github.com/hyperledger/fabric/protos/common"
 	pb "github.com/hyperledger/fabric/protos/peer"
 	"github.com/hyperledger/fabric/protos/utils"
@@ -38,14 +40,26 @@ type EventHub interface {
 	SetPeerAddr(peerURL string)
 	IsConnected() bool
 	Connect() error
+	SetRetryPolicy(policy *retry.Policy)
 	SetInterestedEvents(events []*pb.Interest)
 	GetInterestedEvents() ([]*pb.Interest, error)
 	Recv(msg *pb.Event) (bool, error)
 	Disconnected(err error)
 	RegisterChaincodeEvent(ccid string, eventname string, callback func(*pb.ChaincodeEvent)) *ChainCodeCBE
+	RegisterChaincodeEventForChannel(channelID string, ccid string, eventname string, callback func(*pb.ChaincodeEvent)) *ChainCodeCBE
 	UnregisterChaincodeEvent(cbe *ChainCodeCBE)
-	RegisterTxEvent(txID string, callback func(string, error))
+	RegisterBlockEvent(callback func(*BlockEvent)) *BlockCBE
+	RegisterBlockEventForChannel(channelID string, callback func(*BlockEvent)) *BlockCBE
+	RegisterFilteredBlockEvent(callback func(*BlockEvent)) *BlockCBE
+	RegisterFilteredBlockEventForChannel(channelID string, callback func(*BlockEvent)) *BlockCBE
+	UnregisterBlockEvent(bbe *BlockCBE)
+	RegisterTxEvent(txID string, callback func(string, error)) *TxCBE
+	RegisterTxEventForChannel(channelID string, txID string, callback func(string, error)) *TxCBE
+	RegisterTxEventWithTimeout(txID string, timeout time.Duration, callback func(string, error)) *TxCBE
+	RegisterTxEventForChannelWithTimeout(channelID string, txID string, timeout time.Duration, callback func(string, error)) *TxCBE
 	UnregisterTxEvent(txID string)
+	UnregisterTxEventCBE(cbe *TxCBE)
+	GetPendingTxCount() int
 }
 
 type eventHub struct {
@@ -53,10 +67,10 @@ type eventHub struct {
 	mtx sync.RWMutex
 	// Map of clients registered for chaincode events
 	chaincodeRegistrants map[string][]*ChainCodeCBE
-	// Map of clients registered for block events
-	blockRegistrants []func(*common.Block, string, string)
+	// Array of clients registered for block events
+	blockRegistrants []*BlockCBE
 	// Map of clients registered for transactional events
-	txRegistrants map[string]func(string, error)
+	txRegistrants map[string][]*TxCBE
 	// peer addr to connect to
 	peerAddr string
 	// grpc event client interface
@@ -65,6 +79,8 @@ type eventHub struct {
 	connected bool
 	// List of events client is interested in
 	interestedEvents []*pb.Interest
+	// retry policy of Connect, from config if not set
+	retryPolicy *retry.Policy
 }
 
 // ChainCodeCBE ...
@@ -73,6 +89,8 @@ type eventHub struct {
  * event registration callbacks.
  */
 type ChainCodeCBE struct {
+	// channel id, empty to match events from any channel
+	ChannelID string
 	// chaincode id
 	CCID string
 	// event name regex filter
@@ -81,11 +99,74 @@ type ChainCodeCBE struct {
 	CallbackFunc func(*pb.ChaincodeEvent)
 }
 
+// BlockCBE ...
+/**
+ * The BlockCBE is used internal to the EventHub to hold block
+ * event registration callbacks.
+ */
+type BlockCBE struct {
+	// channel id, empty to match blocks from any channel
+	ChannelID string
+	// filtered registrations do not receive the block itself
+	Filtered bool
+	// callback function to invoke for every block
+	CallbackFunc func(*BlockEvent)
+}
+
+// TxCBE ...
+/**
+ * The TxCBE is used internal to the EventHub to hold transactional
+ * event registration callbacks.
+ */
+type TxCBE struct {
+	// channel id, empty to match transactions from any channel
+	ChannelID string
+	// transaction id
+	TxID string
+	// callback function to invoke when the transaction is committed,
+	// rejected or the registration times out
+	CallbackFunc func(string, error)
+	// fires the timeout, nil if the registration never expires
+	timer *time.Timer
+}
+
+// TxRejectedError ...
+/**
+ * The TxRejectedError is passed to transaction event registrants
+ * when the event source rejects their transaction.
+ */
+type TxRejectedError struct {
+	// transaction id of the rejected transaction
+	TxID string
+	// error message from the rejection event
+	ErrorMsg string
+}
+
+func (e *TxRejectedError) Error() string {
+	return fmt.Sprintf("Transaction %s was rejected: %s", e.TxID, e.ErrorMsg)
+}
+
+// TxTimeoutError ...
+/**
+ * The TxTimeoutError is passed to transaction event registrants
+ * when no event was received for their transaction in time.
+ */
+type TxTimeoutError struct {
+	// transaction id
+	TxID string
+	// timeout of the registration
+	Timeout time.Duration
+}
+
+func (e *TxTimeoutError) Error() string {
+	return fmt.Sprintf("Timed out after %s waiting for transaction %s", e.Timeout, e.TxID)
+}
+
 // NewEventHub ...
 func NewEventHub() EventHub {
 	chaincodeRegistrants := make(map[string][]*ChainCodeCBE)
-	blockRegistrants := make([]func(*common.Block, string, string), 0)
-	txRegistrants := make(map[string]func(string, error))
+	blockRegistrants := make([]*BlockCBE, 0)
+	txRegistrants := make(map[string][]*TxCBE)
 
 	// default interested events
 	interestedEvents := []*pb.Interest{{EventType: pb.EventType_BLOCK}, {EventType: pb.EventType_REJECTION}}
@@ -125,23 +206,52 @@ func (eventHub *eventHub) Connect() error {
 		return fmt.Errorf("eventHub.peerAddr is empty")
 	}
 
-	eventHub.mtx.Lock()
-	defer eventHub.mtx.Unlock()
+	eventHub.mtx.RLock()
+	policy := eventHub.retryPolicy
+	eventHub.mtx.RUnlock()
+	if policy == nil {
+		policy = retry.PolicyFromConfig()
+	}
 
-	eventHub.blockRegistrants = make([]func(*common.Block, string, string), 0)
-	eventHub.blockRegistrants = append(eventHub.blockRegistrants, eventHub.txCallback)
+	// the lock isn't held while connecting, registrations and events
+	// aren't blocked by the backoff between attempts
+	var eventsClient consumer.EventsClient
+	attempts, err := policy.Do(func() error {
+		eventsClient, _ = consumer.NewEventsClient(eventHub.peerAddr, 5, eventHub)
+		if err := eventsClient.Start(); err != nil {
+			eventsClient.Stop()
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error from eventsClient.Start after %d attempts (%s)", attempts, err.Error())
+	}
 
-	eventsClient, _ := consumer.NewEventsClient(eventHub.peerAddr, 5, eventHub)
-	if err := eventsClient.Start(); err != nil {
+	eventHub.mtx.Lock()
+	defer eventHub.mtx.Unlock()
+	if eventHub.connected {
+		// a concurrent Connect won, keep its client
 		eventsClient.Stop()
-		return fmt.Errorf("Error from eventsClient.Start (%s)", err.Error())
-
+		return nil
 	}
+	logger.Debugf("Connected to event source %s after %d attempts", eventHub.peerAddr, attempts)
 	eventHub.connected = true
 	eventHub.client = eventsClient
 	return nil
 }
 
+// SetRetryPolicy ...
+/**
+ * Set the retry policy of Connect.
+ * @param {retry.Policy} policy nil for the policy of the config
+ */
+func (eventHub *eventHub) SetRetryPolicy(policy *retry.Policy) {
+	eventHub.mtx.Lock()
+	defer eventHub.mtx.Unlock()
+	eventHub.retryPolicy = policy
+}
+
 //SetInterestedEvents set events that client is interested in
 func (eventHub *eventHub) SetInterestedEvents(events []*pb.Interest) {
 	eventHub.interestedEvents = events
@@ -154,27 +264,35 @@ func (eventHub *eventHub) GetInterestedEvents() ([]*pb.Interest, error) {
 
 //Recv implements consumer.EventAdapter interface for receiving events
 func (eventHub *eventHub) Recv(msg *pb.Event) (bool, error) {
-	eventHub.mtx.RLock()
-	defer eventHub.mtx.RUnlock()
-
 	switch msg.Event.(type) {
 	case *pb.Event_Block:
 		blockEvent := msg.Event.(*pb.Event_Block)
 		logger.Debugf("Recv blockEvent:%v\n", blockEvent)
-		for _, v := range eventHub.blockRegistrants {
-			v(blockEvent.Block, "", "")
+		if blockEvent.Block == nil {
+			logger.Warning("Recv blockEvent without a block")
+			return true, nil
 		}
+		eventHub.txCallback(blockEvent.Block)
+		eventHub.blockCallback(blockEvent.Block)
 		return true, nil
 	case *pb.Event_ChaincodeEvent:
 		ccEvent := msg.Event.(*pb.Event_ChaincodeEvent)
 		logger.Debugf("Recv ccEvent:%v\n", ccEvent)
 
+		eventHub.mtx.RLock()
+		defer eventHub.mtx.RUnlock()
+
 		cbeArray := eventHub.chaincodeRegistrants[ccEvent.ChaincodeEvent.ChaincodeId]
 		if len(cbeArray) <= 0 {
 			logger.Debugf("No event registration for ccid %s \n", ccEvent.ChaincodeEvent.ChaincodeId)
 		}
 
 		for _, v := range cbeArray {
+			// channel scoped registrations are served from block events,
+			// which carry the channel of the emitting transaction
+			if v.ChannelID != "" {
+				continue
+			}
 			if v.EventNameFilter == ccEvent.ChaincodeEvent.EventName {
 				callback := v.CallbackFunc
 				if callback != nil {
@@ -186,9 +304,11 @@ func (eventHub *eventHub) Recv(msg *pb.Event) (bool, error) {
 	case *pb.Event_Rejection:
 		rejectionEvent := msg.Event.(*pb.Event_Rejection)
 		logger.Debugf("Recv rejectionEvent:%v\n", rejectionEvent)
-		for _, v := range eventHub.blockRegistrants {
-			v(nil, "", rejectionEvent.Rejection.ErrorMsg)
+		if rejectionEvent.Rejection == nil {
+			logger.Warning("Recv rejectionEvent without a rejection")
+			return true, nil
 		}
+		eventHub.rejectionCallback(rejectionEvent.Rejection)
 		return true, nil
 	default:
 		return true, nil
@@ -223,6 +343,23 @@ func (eventHub *eventHub) Disconnected(err error) {
  * handle used to unregister (see unregisterChaincodeEvent)
  */
 func (eventHub *eventHub) RegisterChaincodeEvent(ccid string, eventname string, callback func(*pb.ChaincodeEvent)) *ChainCodeCBE {
+	return eventHub.RegisterChaincodeEventForChannel("", ccid, eventname, callback)
+}
+
+// RegisterChaincodeEventForChannel ...
+/**
+ * Register a callback function to receive the chaincode events of the
+ * transactions of a channel. Chaincode events don't carry their channel,
+ * so channel scoped registrations are served from block events: the
+ * EventHub registers its interest in BLOCK events if it wasn't.
+ * @param {string} channelID string channel id, empty for any channel
+ * @param {string} ccid string chaincode id
+ * @param {string} eventname string The regex string used to filter events
+ * @param {function} callback Function Callback function for filter matches
+ * @returns {object} ChainCodeCBE object that should be treated as an opaque
+ * handle used to unregister (see unregisterChaincodeEvent)
+ */
+func (eventHub *eventHub) RegisterChaincodeEventForChannel(channelID string, ccid string, eventname string, callback func(*pb.ChaincodeEvent)) *ChainCodeCBE {
 	if !eventHub.connected {
 		return nil
 	}
@@ -230,7 +367,14 @@ func (eventHub *eventHub) RegisterChaincodeEvent(ccid string, eventname string,
 	eventHub.mtx.Lock()
 	defer eventHub.mtx.Unlock()
 
-	cbe := ChainCodeCBE{CCID: ccid, EventNameFilter: eventname, CallbackFunc: callback}
+	if channelID != "" {
+		if err := eventHub.ensureBlockInterest(); err != nil {
+			logger.Warningf("Could not register interest in block events: %v", err)
+			return nil
+		}
+	}
+
+	cbe := ChainCodeCBE{ChannelID: channelID, CCID: ccid, EventNameFilter: eventname, CallbackFunc: callback}
 	cbeArray := eventHub.chaincodeRegistrants[ccid]
 	if cbeArray == nil && len(cbeArray) <= 0 {
 		cbeArray = make([]*ChainCodeCBE, 0)
@@ -263,16 +407,114 @@ func (eventHub *eventHub) UnregisterChaincodeEvent(cbe *ChainCodeCBE) {
 		return
 	}
 	for i, v := range cbeArray {
-		if v.EventNameFilter == cbe.EventNameFilter {
-
+		if v == cbe {
 			cbeArray = append(cbeArray[:i], cbeArray[i+1:]...)
-
+			break
 		}
 	}
 	if len(cbeArray) <= 0 {
 		delete(eventHub.chaincodeRegistrants, cbe.CCID)
+	} else {
+		eventHub.chaincodeRegistrants[cbe.CCID] = cbeArray
+	}
+
+}
+
+// ensureBlockInterest adds BLOCK to the interested events, registering
+// it with the connected event source. The caller holds the lock.
+func (eventHub *eventHub) ensureBlockInterest() error {
+	for _, interest := range eventHub.interestedEvents {
+		if interest.EventType == pb.EventType_BLOCK {
+			return nil
+		}
 	}
+	blockInterest := &pb.Interest{EventType: pb.EventType_BLOCK}
+	if eventHub.client != nil {
+		if err := eventHub.client.RegisterAsync([]*pb.Interest{blockInterest}); err != nil {
+			return err
+		}
+	}
+	eventHub.interestedEvents = append(eventHub.interestedEvents, blockInterest)
+	return nil
+}
+
+// RegisterBlockEvent ...
+/**
+ * Register a callback function to receive block events. The callback
+ * receives the full block along with a summary of each transaction
+ * it contains. Block registrations are kept across reconnects.
+ * @param {function} callback Function that takes a single parameter
+ * of type BlockEvent
+ * @returns {object} BlockCBE object that should be treated as an opaque
+ * handle used to unregister (see unregisterBlockEvent)
+ */
+func (eventHub *eventHub) RegisterBlockEvent(callback func(*BlockEvent)) *BlockCBE {
+	return eventHub.RegisterBlockEventForChannel("", callback)
+}
+
+// RegisterBlockEventForChannel ...
+/**
+ * Register a callback function to receive the block events of a channel,
+ * as RegisterBlockEvent.
+ * @param {string} channelID string channel id, empty for any channel
+ * @param {function} callback Function that takes a single parameter
+ * of type BlockEvent
+ */
+func (eventHub *eventHub) RegisterBlockEventForChannel(channelID string, callback func(*BlockEvent)) *BlockCBE {
+	return eventHub.registerBlockEvent(&BlockCBE{ChannelID: channelID, CallbackFunc: callback})
+}
+
+// RegisterFilteredBlockEvent ...
+/**
+ * Register a callback function to receive filtered block events. Filtered
+ * events carry the block number and transaction summaries only: the block
+ * itself and chaincode event payloads are omitted.
+ * @param {function} callback Function that takes a single parameter
+ * of type BlockEvent
+ * @returns {object} BlockCBE object that should be treated as an opaque
+ * handle used to unregister (see unregisterBlockEvent)
+ */
+func (eventHub *eventHub) RegisterFilteredBlockEvent(callback func(*BlockEvent)) *BlockCBE {
+	return eventHub.RegisterFilteredBlockEventForChannel("", callback)
+}
+
+// RegisterFilteredBlockEventForChannel ...
+/**
+ * Register a callback function to receive the filtered block events of a
+ * channel, as RegisterFilteredBlockEvent.
+ * @param {string} channelID string channel id, empty for any channel
+ * @param {function} callback Function that takes a single parameter
+ * of type BlockEvent
+ */
+func (eventHub *eventHub) RegisterFilteredBlockEventForChannel(channelID string, callback func(*BlockEvent)) *BlockCBE {
+	return eventHub.registerBlockEvent(&BlockCBE{ChannelID: channelID, Filtered: true, CallbackFunc: callback})
+}
+
+func (eventHub *eventHub) registerBlockEvent(bbe *BlockCBE) *BlockCBE {
+	eventHub.mtx.Lock()
+	defer eventHub.mtx.Unlock()
+
+	eventHub.blockRegistrants = append(eventHub.blockRegistrants, bbe)
+	return bbe
+}
+
+// UnregisterBlockEvent ...
+/**
+ * Unregister block event registration
+ * @param {object} BlockCBE handle returned from call to
+ * registerBlockEvent or registerFilteredBlockEvent.
+ */
+func (eventHub *eventHub) UnregisterBlockEvent(bbe *BlockCBE) {
+	eventHub.mtx.Lock()
+	defer eventHub.mtx.Unlock()
 
+	for i, v := range eventHub.blockRegistrants {
+		if v == bbe {
+			eventHub.blockRegistrants = append(eventHub.blockRegistrants[:i], eventHub.blockRegistrants[i+1:]...)
+			return
+		}
+	}
+	logger.Debugf("No block event registration found\n")
 }
 
 // RegisterTxEvent ...
@@ -281,27 +523,159 @@ func (eventHub *eventHub) UnregisterChaincodeEvent(cbe *ChainCodeCBE) {
  * Note: transactional event registration is primarily used by
  * the sdk to track deploy and invoke completion events. Nodejs
  * clients generally should not need to call directly.
+ * Several callbacks can be registered for the same transaction. They
+ * are removed once the transaction has been committed or rejected.
  * @param {string} txid string transaction id
- * @param {function} callback Function that takes a single parameter which
- * is a json object representation of type "message Transaction"
+ * @param {function} callback Function that takes the transaction id and
+ * an error, which is nil if the transaction was committed
+ * @returns {object} TxCBE object that should be treated as an opaque
+ * handle used to unregister (see unregisterTxEventCBE)
  */
-func (eventHub *eventHub) RegisterTxEvent(txID string, callback func(string, error)) {
+func (eventHub *eventHub) RegisterTxEvent(txID string, callback func(string, error)) *TxCBE {
+	return eventHub.RegisterTxEventForChannelWithTimeout("", txID, 0, callback)
+}
+
+// RegisterTxEventForChannel ...
+/**
+ * Register a callback function to receive the transactional events of a
+ * transaction of a channel, as RegisterTxEvent. Rejection events don't
+ * carry their channel and are passed to the registrations of any channel.
+ * @param {string} channelID string channel id, empty for any channel
+ * @param {string} txid string transaction id
+ * @param {function} callback Function that takes the transaction id and
+ * an error, which is nil if the transaction was committed
+ */
+func (eventHub *eventHub) RegisterTxEventForChannel(channelID string, txID string, callback func(string, error)) *TxCBE {
+	return eventHub.RegisterTxEventForChannelWithTimeout(channelID, txID, 0, callback)
+}
+
+// RegisterTxEventWithTimeout ...
+/**
+ * Register a callback function to receive transactional events. If no
+ * event is received for the transaction within the timeout, the
+ * registration is removed and the callback is invoked with a TxTimeoutError.
+ * @param {string} txid string transaction id
+ * @param {time.Duration} timeout for the registration, zero never expires
+ * @param {function} callback Function that takes the transaction id and
+ * an error, which is nil if the transaction was committed
+ * @returns {object} TxCBE object that should be treated as an opaque
+ * handle used to unregister (see unregisterTxEventCBE)
+ */
+func (eventHub *eventHub) RegisterTxEventWithTimeout(txID string, timeout time.Duration, callback func(string, error)) *TxCBE {
+	return eventHub.RegisterTxEventForChannelWithTimeout("", txID, timeout, callback)
+}
+
+// RegisterTxEventForChannelWithTimeout ...
+/**
+ * Register a callback function to receive the transactional events of a
+ * transaction of a channel, as RegisterTxEventWithTimeout.
+ * @param {string} channelID string channel id, empty for any channel
+ * @param {string} txid string transaction id
+ * @param {time.Duration} timeout for the registration, zero never expires
+ * @param {function} callback Function that takes the transaction id and
+ * an error, which is nil if the transaction was committed
+ */
+func (eventHub *eventHub) RegisterTxEventForChannelWithTimeout(channelID string, txID string, timeout time.Duration, callback func(string, error)) *TxCBE {
 	logger.Debugf("reg txid %s\n", txID)
 
+	cbe := &TxCBE{ChannelID: channelID, TxID: txID, CallbackFunc: callback}
+
 	eventHub.mtx.Lock()
-	eventHub.txRegistrants[txID] = callback
-	eventHub.mtx.Unlock()
+	defer eventHub.mtx.Unlock()
+
+	eventHub.txRegistrants[txID] = append(eventHub.txRegistrants[txID], cbe)
+	if timeout > 0 {
+		cbe.timer = time.AfterFunc(timeout, func() {
+			if eventHub.removeTxCBE(cbe) && cbe.CallbackFunc != nil {
+				cbe.CallbackFunc(txID, &TxTimeoutError{TxID: txID, Timeout: timeout})
+			}
+		})
+	}
+	return cbe
 }
 
 // UnregisterTxEvent ...
 /**
- * Unregister transactional event registration.
+ * Unregister all transactional event registrations for a transaction.
  * @param txid string transaction id
  */
 func (eventHub *eventHub) UnregisterTxEvent(txID string) {
+	eventHub.takeTxCBEs(txID, "")
+}
+
+// UnregisterTxEventCBE ...
+/**
+ * Unregister a single transactional event registration.
+ * @param {object} TxCBE handle returned from call to
+ * registerTxEvent or registerTxEventWithTimeout.
+ */
+func (eventHub *eventHub) UnregisterTxEventCBE(cbe *TxCBE) {
+	eventHub.removeTxCBE(cbe)
+}
+
+// GetPendingTxCount ...
+/**
+ * Get the number of transactional event registrations that are
+ * still waiting for their transaction.
+ */
+func (eventHub *eventHub) GetPendingTxCount() int {
+	eventHub.mtx.RLock()
+	defer eventHub.mtx.RUnlock()
+
+	count := 0
+	for _, cbeArray := range eventHub.txRegistrants {
+		count += len(cbeArray)
+	}
+	return count
+}
+
+// takeTxCBEs removes and returns the registrations for txID that match
+// channelID, an empty channelID matches all registrations
+func (eventHub *eventHub) takeTxCBEs(txID string, channelID string) []*TxCBE {
+	eventHub.mtx.Lock()
+	defer eventHub.mtx.Unlock()
+
+	var taken, remaining []*TxCBE
+	for _, v := range eventHub.txRegistrants[txID] {
+		if channelID != "" && v.ChannelID != "" && v.ChannelID != channelID {
+			remaining = append(remaining, v)
+			continue
+		}
+		if v.timer != nil {
+			v.timer.Stop()
+		}
+		taken = append(taken, v)
+	}
+	if len(remaining) == 0 {
+		delete(eventHub.txRegistrants, txID)
+	} else {
+		eventHub.txRegistrants[txID] = remaining
+	}
+	return taken
+}
+
+// removeTxCBE removes a single registration, returns false if it
+// was already removed
+func (eventHub *eventHub) removeTxCBE(cbe *TxCBE) bool {
 	eventHub.mtx.Lock()
-	delete(eventHub.txRegistrants, txID)
-	eventHub.mtx.Unlock()
+	defer eventHub.mtx.Unlock()
+
+	cbeArray := eventHub.txRegistrants[cbe.TxID]
+	for i, v := range cbeArray {
+		if v == cbe {
+			if v.timer != nil {
+				v.timer.Stop()
+			}
+			cbeArray = append(cbeArray[:i], cbeArray[i+1:]...)
+			if len(cbeArray) == 0 {
+				delete(eventHub.txRegistrants, cbe.TxID)
+			} else {
+				eventHub.txRegistrants[cbe.TxID] = cbeArray
+			}
+			return true
+		}
+	}
+	return false
 }
 
 /**
@@ -309,11 +683,11 @@ func (eventHub *eventHub) UnregisterTxEvent(txID string) {
  * @param {object} block json object representing block of tx
  * from the fabric
  */
-func (eventHub *eventHub) txCallback(block *common.Block, txID string, errMsg string) {
+func (eventHub *eventHub) txCallback(block *common.Block) {
 	logger.Debugf("txCallback block=%v\n", block)
-
-	eventHub.mtx.RLock()
-	defer eventHub.mtx.RUnlock()
+	if block == nil || block.Data == nil {
+		return
+	}
 
 	for _, v := range block.Data.Data {
 		if env, err := utils.GetEnvelopeFromBlock(v); err != nil {
@@ -332,12 +706,106 @@ func (eventHub *eventHub) txCallback(block *common.Block, txID string, errMsg st
 				return
 			}
 
-			callback := eventHub.txRegistrants[channelHeader.TxId]
-			if callback != nil {
-				callback(channelHeader.TxId, nil)
+			for _, cbe := range eventHub.takeTxCBEs(channelHeader.TxId, channelHeader.ChannelId) {
+				if cbe.CallbackFunc != nil {
+					cbe.CallbackFunc(channelHeader.TxId, nil)
+				}
+			}
+		}
+
+	}
+
+}
+
+/**
+ * private internal callback for processing rejection events
+ * @param {object} rejection json object representing the rejected
+ * transaction from the fabric
+ */
+func (eventHub *eventHub) rejectionCallback(rejection *pb.Rejection) {
+	txID, err := getRejectedTxID(rejection.Tx)
+	if err != nil {
+		logger.Warningf("Could not get transaction id of rejected transaction: %s", err)
+		return
+	}
+
+	// the rejected transaction does not carry its channel, so all
+	// registrations for the transaction id are notified
+	for _, cbe := range eventHub.takeTxCBEs(txID, "") {
+		if cbe.CallbackFunc != nil {
+			cbe.CallbackFunc(txID, &TxRejectedError{TxID: txID, ErrorMsg: rejection.ErrorMsg})
+		}
+	}
+}
+
+// getRejectedTxID computes the transaction id of a rejected transaction
+// from the nonce and creator in its signature header
+func getRejectedTxID(tx *pb.Transaction) (string, error) {
+	if tx == nil || len(tx.Actions) == 0 {
+		return "", fmt.Errorf("rejected transaction has no actions")
+	}
+	signatureHeader, err := utils.GetSignatureHeader(tx.Actions[0].Header)
+	if err != nil {
+		return "", err
+	}
+	return utils.ComputeProposalTxID(signatureHeader.Nonce, signatureHeader.Creator)
+}
+
+/**
+ * private internal callback for dispatching block events to
+ * block registrants
+ * @param {object} block json object representing block
+ * from the fabric
+ */
+func (eventHub *eventHub) blockCallback(block *common.Block) {
+	eventHub.mtx.RLock()
+	registrants := make([]*BlockCBE, len(eventHub.blockRegistrants))
+	copy(registrants, eventHub.blockRegistrants)
+	var ccRegistrants []*ChainCodeCBE
+	for _, cbeArray := range eventHub.chaincodeRegistrants {
+		for _, v := range cbeArray {
+			if v.ChannelID != "" {
+				ccRegistrants = append(ccRegistrants, v)
 			}
 		}
+	}
+	eventHub.mtx.RUnlock()
 
+	if len(registrants) == 0 && len(ccRegistrants) == 0 {
+		return
+	}
+
+	blockEvent := newBlockEvent(block)
+	var filteredEvent *BlockEvent
+	for _, v := range registrants {
+		if v.CallbackFunc == nil {
+			continue
+		}
+		if v.ChannelID != "" && v.ChannelID != blockEvent.ChannelID {
+			continue
+		}
+		if v.Filtered {
+			if filteredEvent == nil {
+				filteredEvent = blockEvent.filtered()
+			}
+			v.CallbackFunc(filteredEvent)
+		} else {
+			v.CallbackFunc(blockEvent)
+		}
 	}
 
+	// chaincode events of valid transactions for channel scoped registrations
+	for _, tx := range blockEvent.Transactions {
+		if tx.ValidationCode != pb.TxValidationCode_VALID {
+			continue
+		}
+		for _, ccEvent := range tx.ChaincodeEvents {
+			for _, v := range ccRegistrants {
+				if v.ChannelID == tx.ChannelID && v.CCID == ccEvent.ChaincodeId &&
+					v.EventNameFilter == ccEvent.EventName && v.CallbackFunc != nil {
+					v.CallbackFunc(ccEvent)
+				}
+			}
+		}
+	}
 }
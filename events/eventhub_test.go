@@ -0,0 +1,295 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+
+	"github.com/hyperledger/fabric-sdk-go/retry"
+)
+
+func TestConnectRetry(t *testing.T) {
+	eventHub := NewEventHub()
+	eventHub.SetPeerAddr("127.0.0.1:1")
+	eventHub.SetRetryPolicy(&retry.Policy{MaxAttempts: 2, InitialBackoff: time.Millisecond,
+		RetryableCodes: retry.DefaultRetryableCodes})
+	err := eventHub.Connect()
+	if err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Fatalf("Connect should fail after 2 attempts, got %v", err)
+	}
+	if eventHub.IsConnected() {
+		t.Fatalf("EventHub shouldn't be connected")
+	}
+
+	// only the errors retryable by the policy are retried
+	eventHub.SetInterestedEvents(nil)
+	err = eventHub.Connect()
+	if err == nil || !strings.Contains(err.Error(), "after 1 attempts") {
+		t.Fatalf("Connect without interested events shouldn't be retried, got %v", err)
+	}
+}
+
+func TestBlockEventRegistration(t *testing.T) {
+	eventHub := NewEventHub()
+
+	var fullEvent, filteredEvent *BlockEvent
+	full := eventHub.RegisterBlockEvent(func(e *BlockEvent) { fullEvent = e })
+	filtered := eventHub.RegisterFilteredBlockEvent(func(e *BlockEvent) { filteredEvent = e })
+
+	block := createTestBlock(t, 7, []*testTx{
+		{txID: "tx1", channelID: "testchannel", ccEvent: &pb.ChaincodeEvent{ChaincodeId: "cc", TxId: "tx1", EventName: "ev", Payload: []byte("payload")}},
+		{txID: "tx2", channelID: "testchannel", validationCode: pb.TxValidationCode_MVCC_READ_CONFLICT},
+	})
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+
+	if fullEvent == nil || filteredEvent == nil {
+		t.Fatalf("Block registrants were not called")
+	}
+	if fullEvent.Block != block {
+		t.Fatalf("Block registrant didn't receive the block")
+	}
+	if fullEvent.Number != 7 || filteredEvent.Number != 7 {
+		t.Fatalf("Block event has wrong block number")
+	}
+	if len(fullEvent.Transactions) != 2 {
+		t.Fatalf("Expected 2 transaction summaries, got %d", len(fullEvent.Transactions))
+	}
+	tx1 := fullEvent.Transactions[0]
+	if tx1.TxID != "tx1" || tx1.ChannelID != "testchannel" || tx1.ValidationCode != pb.TxValidationCode_VALID {
+		t.Fatalf("Wrong summary for tx1: %v", tx1)
+	}
+	if len(tx1.ChaincodeEvents) != 1 || string(tx1.ChaincodeEvents[0].Payload) != "payload" {
+		t.Fatalf("Wrong chaincode events for tx1: %v", tx1.ChaincodeEvents)
+	}
+	if fullEvent.Transactions[1].ValidationCode != pb.TxValidationCode_MVCC_READ_CONFLICT {
+		t.Fatalf("Wrong validation code for tx2")
+	}
+
+	if filteredEvent.Block != nil {
+		t.Fatalf("Filtered block registrant received the block")
+	}
+	filteredTx1 := filteredEvent.Transactions[0]
+	if filteredTx1.TxID != "tx1" || len(filteredTx1.ChaincodeEvents) != 1 {
+		t.Fatalf("Wrong filtered summary for tx1: %v", filteredTx1)
+	}
+	if filteredTx1.ChaincodeEvents[0].EventName != "ev" || filteredTx1.ChaincodeEvents[0].Payload != nil {
+		t.Fatalf("Filtered chaincode event should carry the name but not the payload")
+	}
+
+	eventHub.UnregisterBlockEvent(full)
+	eventHub.UnregisterBlockEvent(filtered)
+	fullEvent, filteredEvent = nil, nil
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+	if fullEvent != nil || filteredEvent != nil {
+		t.Fatalf("Unregistered block registrants were called")
+	}
+}
+
+func TestRejectionEvent(t *testing.T) {
+	eventHub := NewEventHub()
+
+	var blockCalled bool
+	eventHub.RegisterBlockEvent(func(e *BlockEvent) { blockCalled = true })
+
+	signatureHeader := &common.SignatureHeader{Nonce: []byte("nonce"), Creator: []byte("creator")}
+	txID, err := utils.ComputeProposalTxID(signatureHeader.Nonce, signatureHeader.Creator)
+	if err != nil {
+		t.Fatalf("ComputeProposalTxID return error: %s", err)
+	}
+
+	var callbackErr error
+	eventHub.RegisterTxEvent(txID, func(txID string, err error) { callbackErr = err })
+
+	rejection := &pb.Rejection{ErrorMsg: "rejected",
+		Tx: &pb.Transaction{Actions: []*pb.TransactionAction{{Header: marshalOrFail(t, signatureHeader)}}}}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Rejection{Rejection: rejection}})
+
+	rejectedErr, ok := callbackErr.(*TxRejectedError)
+	if !ok {
+		t.Fatalf("Expected TxRejectedError, got %v", callbackErr)
+	}
+	if rejectedErr.TxID != txID || rejectedErr.ErrorMsg != "rejected" {
+		t.Fatalf("TxRejectedError has wrong content: %v", rejectedErr)
+	}
+	if blockCalled {
+		t.Fatalf("Block registrant was called for a rejection event")
+	}
+
+	// rejections that cannot be parsed must not panic
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Rejection{Rejection: &pb.Rejection{ErrorMsg: "rejected"}}})
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Rejection{}})
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{}})
+	if blockCalled {
+		t.Fatalf("Block registrant was called with a nil block")
+	}
+}
+
+func TestTxEventRegistration(t *testing.T) {
+	eventHub := NewEventHub()
+
+	results := make(chan error, 10)
+	callback := func(txID string, err error) { results <- err }
+	eventHub.RegisterTxEvent("tx1", callback)
+	eventHub.RegisterTxEvent("tx1", callback)
+	removed := eventHub.RegisterTxEvent("tx1", callback)
+	eventHub.RegisterTxEventWithTimeout("tx2", 10*time.Millisecond, callback)
+	eventHub.RegisterTxEventWithTimeout("tx3", time.Hour, callback)
+	if eventHub.GetPendingTxCount() != 5 {
+		t.Fatalf("Expected 5 pending registrations, got %d", eventHub.GetPendingTxCount())
+	}
+
+	eventHub.UnregisterTxEventCBE(removed)
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: createTestBlock(t, 1, []*testTx{{txID: "tx1"}, {txID: "tx3"}})}})
+	for i := 0; i < 3; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("Expected commit callback without error, got %s", err)
+		}
+	}
+
+	select {
+	case err := <-results:
+		if _, ok := err.(*TxTimeoutError); !ok {
+			t.Fatalf("Expected TxTimeoutError, got %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Timed out waiting for registration timeout")
+	}
+
+	if eventHub.GetPendingTxCount() != 0 {
+		t.Fatalf("Expected no pending registrations, got %d", eventHub.GetPendingTxCount())
+	}
+	select {
+	case err := <-results:
+		t.Fatalf("Unexpected callback: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestChannelScopedRegistration(t *testing.T) {
+	hub := NewEventHub()
+	// chaincode registration requires a connected hub
+	hub.(*eventHub).connected = true
+
+	var blocks1, blocks2, blocksAny int
+	hub.RegisterBlockEventForChannel("channel1", func(e *BlockEvent) { blocks1++ })
+	hub.RegisterFilteredBlockEventForChannel("channel2", func(e *BlockEvent) { blocks2++ })
+	hub.RegisterBlockEvent(func(e *BlockEvent) { blocksAny++ })
+
+	var tx1, tx2 int
+	hub.RegisterTxEventForChannel("channel1", "tx", func(txID string, err error) { tx1++ })
+	hub.RegisterTxEventForChannel("channel2", "tx", func(txID string, err error) { tx2++ })
+
+	var cc1, cc2, ccAny int
+	hub.RegisterChaincodeEventForChannel("channel1", "cc", "ev", func(e *pb.ChaincodeEvent) { cc1++ })
+	hub.RegisterChaincodeEventForChannel("channel2", "cc", "ev", func(e *pb.ChaincodeEvent) { cc2++ })
+	ccAnyCBE := hub.RegisterChaincodeEvent("cc", "ev", func(e *pb.ChaincodeEvent) { ccAny++ })
+
+	ccEvent := &pb.ChaincodeEvent{ChaincodeId: "cc", TxId: "tx", EventName: "ev"}
+	block := createTestBlock(t, 1, []*testTx{{txID: "tx", channelID: "channel1", ccEvent: ccEvent}})
+	hub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+	hub.Recv(&pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: ccEvent}})
+
+	if blocks1 != 1 || blocks2 != 0 || blocksAny != 1 {
+		t.Fatalf("Block registrants called wrong number of times: %d %d %d", blocks1, blocks2, blocksAny)
+	}
+	if tx1 != 1 || tx2 != 0 {
+		t.Fatalf("Tx registrants called wrong number of times: %d %d", tx1, tx2)
+	}
+	if hub.GetPendingTxCount() != 1 {
+		t.Fatalf("Registration for other channel should still be pending")
+	}
+	if cc1 != 1 || cc2 != 0 || ccAny != 1 {
+		t.Fatalf("Chaincode registrants called wrong number of times: %d %d %d", cc1, cc2, ccAny)
+	}
+
+	hub.UnregisterChaincodeEvent(ccAnyCBE)
+	hub.Recv(&pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: ccEvent}})
+	if ccAny != 1 {
+		t.Fatalf("Unregistered chaincode registrant was called")
+	}
+}
+
+func TestChannelChaincodeEventAddsBlockInterest(t *testing.T) {
+	hub := NewEventHub()
+	hub.(*eventHub).connected = true
+	hub.SetInterestedEvents([]*pb.Interest{{EventType: pb.EventType_CHAINCODE}})
+
+	hub.RegisterChaincodeEvent("cc", "ev", func(e *pb.ChaincodeEvent) {})
+	if interests, _ := hub.GetInterestedEvents(); len(interests) != 1 {
+		t.Fatalf("Chaincode registrations for any channel shouldn't change the interests, got %v", interests)
+	}
+	hub.RegisterChaincodeEventForChannel("channel1", "cc", "ev", func(e *pb.ChaincodeEvent) {})
+	hub.RegisterChaincodeEventForChannel("channel2", "cc", "ev", func(e *pb.ChaincodeEvent) {})
+	interests, _ := hub.GetInterestedEvents()
+	if len(interests) != 2 || interests[1].EventType != pb.EventType_BLOCK {
+		t.Fatalf("Channel scoped chaincode registrations should add BLOCK interest once, got %v", interests)
+	}
+}
+
+type testTx struct {
+	txID           string
+	channelID      string
+	validationCode pb.TxValidationCode
+	ccEvent        *pb.ChaincodeEvent
+}
+
+// createTestBlock builds a block of endorser transactions
+func createTestBlock(t *testing.T, number uint64, txs []*testTx) *common.Block {
+	block := &common.Block{Header: &common.BlockHeader{Number: number},
+		Data: &common.BlockData{}, Metadata: &common.BlockMetadata{Metadata: make([][]byte, 4)}}
+	txFilter := make([]byte, len(txs))
+	for i, tx := range txs {
+		block.Data.Data = append(block.Data.Data, marshalOrFail(t, createTestEnvelope(t, tx)))
+		txFilter[i] = byte(tx.validationCode)
+	}
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = txFilter
+	return block
+}
+
+func createTestEnvelope(t *testing.T, tx *testTx) *common.Envelope {
+	ccAction := &pb.ChaincodeAction{Results: []byte("results")}
+	if tx.ccEvent != nil {
+		ccAction.Events = marshalOrFail(t, tx.ccEvent)
+	}
+	prp := &pb.ProposalResponsePayload{Extension: marshalOrFail(t, ccAction)}
+	cap := &pb.ChaincodeActionPayload{Action: &pb.ChaincodeEndorsedAction{ProposalResponsePayload: marshalOrFail(t, prp)}}
+	transaction := &pb.Transaction{Actions: []*pb.TransactionAction{{Payload: marshalOrFail(t, cap)}}}
+
+	channelHeader := &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION),
+		TxId: tx.txID, ChannelId: tx.channelID}
+	payload := &common.Payload{Header: &common.Header{ChannelHeader: marshalOrFail(t, channelHeader)},
+		Data: marshalOrFail(t, transaction)}
+	return &common.Envelope{Payload: marshalOrFail(t, payload)}
+}
+
+func marshalOrFail(t *testing.T, msg proto.Message) []byte {
+	bytes, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("proto.Marshal return error: %s", err)
+	}
+	return bytes
+}
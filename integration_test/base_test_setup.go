@@ -20,18 +20,15 @@ limitations under the License.
 package integration
 
 import (
-	"encoding/pem"
 	"fmt"
 	"testing"
 
 	"github.com/hyperledger/fabric-sdk-go/config"
 	"github.com/hyperledger/fabric-sdk-go/events"
 	"github.com/hyperledger/fabric-sdk-go/msp"
-	"github.com/hyperledger/fabric/bccsp"
 
 	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
 	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
-	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
@@ -49,25 +46,10 @@ type BaseSetupImpl struct {
 
 // GetChains initializes and returns a query chain and invoke chain
 func (setup *BaseSetupImpl) GetChains(t *testing.T) (fabric_sdk.Chain, fabric_sdk.Chain) {
-	client := fabric_sdk.NewClient()
-
-	err := bccspFactory.InitFactories(&bccspFactory.FactoryOpts{
-		ProviderName: "SW",
-		SwOpts: &bccspFactory.SwOpts{
-			HashFamily: config.GetSecurityAlgorithm(),
-			SecLevel:   config.GetSecurityLevel(),
-			FileKeystore: &bccspFactory.FileKeystoreOpts{
-				KeyStorePath: config.GetKeyStorePath(),
-			},
-			Ephemeral: false,
-		},
-	})
+	client, err := fabric_sdk.NewClientFromConfig()
 	if err != nil {
-		t.Fatalf("Failed getting ephemeral software-based BCCSP [%s]", err)
+		t.Fatalf("NewClientFromConfig return error: %v", err)
 	}
-	cryptoSuite := bccspFactory.GetDefault()
-
-	client.SetCryptoSuite(cryptoSuite)
 	stateStore, err := kvs.CreateNewFileKeyValueStore("/tmp/enroll_user")
 	if err != nil {
 		t.Fatalf("CreateNewFileKeyValueStore return error[%s]", err)
@@ -82,17 +64,14 @@ func (setup *BaseSetupImpl) GetChains(t *testing.T) (fabric_sdk.Chain, fabric_sd
 		if err1 != nil {
 			t.Fatalf("NewFabricCOPServices return error: %v", err)
 		}
-		key, cert, err1 := msps.Enroll("testUser", "user1")
-		keyPem, _ := pem.Decode(key)
+		// the key is generated in the client's crypto suite
+		msps.SetCryptoSuite(client.GetCryptoSuite())
+		cert, key, err1 := msps.EnrollWithCSR("testUser", "user1", nil)
 		if err1 != nil {
-			t.Fatalf("Enroll return error: %v", err1)
+			t.Fatalf("EnrollWithCSR return error: %v", err1)
 		}
 		user := fabric_sdk.NewUser("testUser")
-		k, err1 := client.GetCryptoSuite().KeyImport(keyPem.Bytes, &bccsp.ECDSAPrivateKeyImportOpts{Temporary: false})
-		if err1 != nil {
-			t.Fatalf("KeyImport return error: %v", err)
-		}
-		user.SetPrivateKey(k)
+		user.SetPrivateKey(key)
 		user.SetEnrollmentCertificate(cert)
 		err = client.SetUserContext(user, false)
 		if err != nil {
@@ -107,6 +86,7 @@ func (setup *BaseSetupImpl) GetChains(t *testing.T) (fabric_sdk.Chain, fabric_sd
 
 	for _, p := range config.GetPeersConfig() {
 		endorser := fabric_sdk.CreateNewPeer(fmt.Sprintf("%s:%s", p.Host, p.Port))
+		endorser.SetMspID(p.MspID)
 		querychain.AddPeer(endorser)
 		break
 	}
@@ -120,6 +100,7 @@ func (setup *BaseSetupImpl) GetChains(t *testing.T) (fabric_sdk.Chain, fabric_sd
 
 	for _, p := range config.GetPeersConfig() {
 		endorser := fabric_sdk.CreateNewPeer(fmt.Sprintf("%s:%s", p.Host, p.Port))
+		endorser.SetMspID(p.MspID)
 		invokechain.AddPeer(endorser)
 	}
 
@@ -129,18 +129,14 @@ func invoke(t *testing.T, chain fabric_sdk.Chain, eventHub events.EventHub) erro
 		return fmt.Errorf("CreateTransaction return error: %v", err)
 
 	}
-	transactionResponse, err := chain.SendTransaction(proposal, tx)
+	outcome, err := chain.SendTransaction(proposal, tx)
 	if err != nil {
 		return fmt.Errorf("SendTransaction return error: %v", err)
 
 	}
-	for _, v := range transactionResponse {
-		if v.Err != nil {
-			return fmt.Errorf("Orderer %s return error: %v", v.Orderer, v.Err)
-		}
-	}
+	fmt.Printf("Orderer '%s' accepted the transaction\n", outcome.Orderer)
 	done := make(chan bool)
-	eventHub.RegisterTxEvent(txID, func(txId string, err error) {
+	eventHub.RegisterTxEventForChannel(chainId, txID, func(txId string, err error) {
 		fmt.Printf("receive success event for txid(%s)\n", txId)
 		done <- true
 	})
@@ -28,7 +28,6 @@ import (
 	config "github.com/hyperledger/fabric-sdk-go/config"
 	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
 	"github.com/hyperledger/fabric/bccsp"
-	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
 
 	msp "github.com/hyperledger/fabric-sdk-go/msp"
 )
@@ -39,26 +38,10 @@ import (
 // key value store
 func TestEnroll(t *testing.T) {
 	InitConfigForMsp()
-	client := fabric_sdk.NewClient()
-
-	err := bccspFactory.InitFactories(&bccspFactory.FactoryOpts{
-		ProviderName: "SW",
-		SwOpts: &bccspFactory.SwOpts{
-			HashFamily: config.GetSecurityAlgorithm(),
-			SecLevel:   config.GetSecurityLevel(),
-			FileKeystore: &bccspFactory.FileKeystoreOpts{
-				KeyStorePath: config.GetKeyStorePath(),
-			},
-			Ephemeral: false,
-		},
-	})
+	client, err := fabric_sdk.NewClientFromConfig()
 	if err != nil {
-		t.Fatalf("Failed getting ephemeral software-based BCCSP [%s]", err)
+		t.Fatalf("NewClientFromConfig return error: %v", err)
 	}
-
-	cryptoSuite := bccspFactory.GetDefault()
-
-	client.SetCryptoSuite(cryptoSuite)
 	stateStore, err := kvs.CreateNewFileKeyValueStore("/tmp/enroll_user")
 	if err != nil {
 		t.Fatalf("CreateNewFileKeyValueStore return error[%s]", err)
@@ -69,7 +52,8 @@ func TestEnroll(t *testing.T) {
 	if err != nil {
 		t.Fatalf("NewMSPServices return error: %v", err)
 	}
-	key, cert, err := msps.Enroll("testUser2", "user2")
+	msps.SetCryptoSuite(client.GetCryptoSuite())
+	cert, key, err := msps.Enroll("testUser2", "user2")
 	if err != nil {
 		t.Fatalf("Enroll return error: %v", err)
 	}
@@ -0,0 +1,75 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"os"
+	"testing"
+
+	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
+	config "github.com/hyperledger/fabric-sdk-go/config"
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+// TestPKCS11CryptoSuite signs with a key generated in SoftHSM. It needs a
+// token initialized with the configured label, for example
+// softhsm2-util --init-token --slot 0 --label "ForFabric" --pin 98765432 --so-pin 1234
+// and the PIN in the environment variable of client.security.pkcs11.pinEnv.
+func TestPKCS11CryptoSuite(t *testing.T) {
+	InitConfigForMsp()
+	viper := config.GetFabricClientViper()
+	if _, err := os.Stat(viper.GetString("client.security.pkcs11.library")); err != nil {
+		t.Skipf("SoftHSM library is not installed: %v", err)
+	}
+	if os.Getenv(viper.GetString("client.security.pkcs11.pinEnv")) == "" {
+		t.Skipf("SoftHSM PIN is not set")
+	}
+	viper.Set("client.security.provider", "PKCS11")
+	defer viper.Set("client.security.provider", "SW")
+
+	client, err := fabric_sdk.NewClientFromConfig()
+	if err != nil {
+		t.Fatalf("NewClientFromConfig return error: %v", err)
+	}
+	cryptoSuite := client.GetCryptoSuite()
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: false})
+	if err != nil {
+		t.Fatalf("KeyGen return error: %v", err)
+	}
+	if !key.Private() {
+		t.Fatalf("KeyGen should return a private key")
+	}
+	digest, err := cryptoSuite.Hash([]byte("test"), &bccsp.SHAOpts{})
+	if err != nil {
+		t.Fatalf("Hash return error: %v", err)
+	}
+	signature, err := cryptoSuite.Sign(key, digest, nil)
+	if err != nil {
+		t.Fatalf("Sign return error: %v", err)
+	}
+	if valid, err := cryptoSuite.Verify(key, signature, digest, nil); err != nil || !valid {
+		t.Fatalf("Signature of the HSM key should be valid: %v", err)
+	}
+
+	// keys are found again by their SKI
+	if _, err := cryptoSuite.GetKey(key.SKI()); err != nil {
+		t.Fatalf("GetKey return error: %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyvaluestore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// version of the encrypted value format
+const encryptedValueVersion = 1
+
+// size of the AES-256 data keys
+const dataKeySize = 32
+
+// EncryptedKeyValueStore ...
+/**
+ * KeyValueStore that encrypts values before saving them in another
+ * KeyValueStore. Each value is encrypted with AES-GCM under its own random
+ * data key, which is in turn encrypted by a KeyWrapper. The key name is
+ * authenticated along with the value, so values that were modified or moved
+ * to another key are rejected. Key names are not encrypted.
+ */
+type EncryptedKeyValueStore struct {
+	store KeyValueStore
+	// protects keyWrapper, held exclusively while rotating
+	mtx        sync.RWMutex
+	keyWrapper KeyWrapper
+}
+
+// encryptedValue is the format of the values saved in the wrapped store
+type encryptedValue struct {
+	Version    int    `json:"version"`
+	KeyID      []byte `json:"keyId"`
+	WrappedKey []byte `json:"wrappedKey"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// CreateNewEncryptedKeyValueStore ...
+/**
+ * @param {KeyValueStore} store where the encrypted values are saved
+ * @param {KeyWrapper} keyWrapper encrypts the data keys
+ */
+func CreateNewEncryptedKeyValueStore(store KeyValueStore, keyWrapper KeyWrapper) (*EncryptedKeyValueStore, error) {
+	if store == nil {
+		return nil, fmt.Errorf("Failed to create EncryptedKeyValueStore. Missing requirement 'store' parameter.")
+	}
+	if keyWrapper == nil {
+		return nil, fmt.Errorf("Failed to create EncryptedKeyValueStore. Missing requirement 'keyWrapper' parameter.")
+	}
+	return &EncryptedKeyValueStore{store: store, keyWrapper: keyWrapper}, nil
+}
+
+// GetValue ...
+/**
+ * Get and decrypt the value associated with name.
+ * @param {string} name
+ * @returns []byte for the value
+ */
+func (ekvs *EncryptedKeyValueStore) GetValue(key string) ([]byte, error) {
+	ekvs.mtx.RLock()
+	defer ekvs.mtx.RUnlock()
+
+	return ekvs.getValue(key, ekvs.keyWrapper)
+}
+
+// SetValue ...
+/**
+ * Encrypt and set the value associated with name.
+ * @param {string} name of the key to save
+ * @param {[]byte} value to save
+ */
+func (ekvs *EncryptedKeyValueStore) SetValue(key string, value []byte) error {
+	ekvs.mtx.RLock()
+	defer ekvs.mtx.RUnlock()
+
+	return ekvs.setValue(key, value, ekvs.keyWrapper)
+}
+
+// DeleteValue ...
+/**
+ * Delete the value associated with name.
+ * @param {string} name of the key to delete
+ */
+func (ekvs *EncryptedKeyValueStore) DeleteValue(key string) error {
+	return ekvs.store.DeleteValue(key)
+}
+
+// ListKeys ...
+/**
+ * List the keys that start with prefix.
+ * @param {string} prefix of the keys to list, empty for all keys
+ * @returns {[]string}
+ */
+func (ekvs *EncryptedKeyValueStore) ListKeys(prefix string) ([]string, error) {
+	return ekvs.store.ListKeys(prefix)
+}
+
+// Exists ...
+/**
+ * Check whether a value is associated with name.
+ * @param {string} name of the key
+ * @returns {bool}
+ */
+func (ekvs *EncryptedKeyValueStore) Exists(key string) (bool, error) {
+	return ekvs.store.Exists(key)
+}
+
+// RotateKey ...
+/**
+ * Re-encrypt every value of the store under a new key encryption key and
+ * use it for all further operations. Values are re-encrypted in place one
+ * by one, so if the rotation is interrupted it can be resumed by calling
+ * RotateKey again with the same new key: values already encrypted under
+ * the new key are skipped. Entries of the wrapped store that weren't
+ * written by an EncryptedKeyValueStore, or that are encrypted under
+ * another key than the current one, e.g. by another store sharing the
+ * wrapped store, are left as they are.
+ * @param {KeyWrapper} newKeyWrapper wraps the new key encryption key
+ */
+func (ekvs *EncryptedKeyValueStore) RotateKey(newKeyWrapper KeyWrapper) error {
+	if newKeyWrapper == nil {
+		return fmt.Errorf("newKeyWrapper is nil")
+	}
+
+	ekvs.mtx.Lock()
+	defer ekvs.mtx.Unlock()
+
+	keys, err := ekvs.store.ListKeys("")
+	if err != nil {
+		return fmt.Errorf("store ListKeys return error: %v", err)
+	}
+	for _, key := range keys {
+		data, err := ekvs.store.GetValue(key)
+		if IsKeyNotFound(err) {
+			// deleted since the keys were listed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ev, ok := parseEncryptedValue(data)
+		if !ok {
+			logger.Debugf("Skipping value %s, it is not an encrypted value", key)
+			continue
+		}
+		if bytes.Equal(ev.KeyID, newKeyWrapper.KeyID()) {
+			logger.Debugf("Value %s is already encrypted with key %s", key, hex.EncodeToString(ev.KeyID))
+			continue
+		}
+		if !bytes.Equal(ev.KeyID, ekvs.keyWrapper.KeyID()) {
+			logger.Warningf("Skipping value %s, it is encrypted with unknown key %s", key, hex.EncodeToString(ev.KeyID))
+			continue
+		}
+		value, err := ekvs.decrypt(key, ev, ekvs.keyWrapper)
+		if err != nil {
+			return err
+		}
+		if err := ekvs.setValue(key, value, newKeyWrapper); err != nil {
+			return fmt.Errorf("Failed to re-encrypt value %s: %v", key, err)
+		}
+	}
+
+	ekvs.keyWrapper = newKeyWrapper
+	return nil
+}
+
+func (ekvs *EncryptedKeyValueStore) getValue(key string, keyWrapper KeyWrapper) ([]byte, error) {
+	ev, err := ekvs.getEncryptedValue(key)
+	if err != nil {
+		return nil, err
+	}
+	return ekvs.decrypt(key, ev, keyWrapper)
+}
+
+func (ekvs *EncryptedKeyValueStore) getEncryptedValue(key string) (*encryptedValue, error) {
+	data, err := ekvs.store.GetValue(key)
+	if err != nil {
+		return nil, err
+	}
+	ev := &encryptedValue{}
+	if err := json.Unmarshal(data, ev); err != nil {
+		return nil, fmt.Errorf("Value %s is not an encrypted value: %v", key, err)
+	}
+	if ev.Version != encryptedValueVersion {
+		return nil, fmt.Errorf("Value %s has unsupported encryption version %d", key, ev.Version)
+	}
+	return ev, nil
+}
+
+// parseEncryptedValue returns the encrypted value of data, ok is false if
+// data wasn't written by an EncryptedKeyValueStore
+func parseEncryptedValue(data []byte) (ev *encryptedValue, ok bool) {
+	ev = &encryptedValue{}
+	if err := json.Unmarshal(data, ev); err != nil {
+		return nil, false
+	}
+	if ev.Version != encryptedValueVersion || len(ev.KeyID) == 0 ||
+		len(ev.WrappedKey) == 0 || len(ev.Ciphertext) == 0 {
+		return nil, false
+	}
+	return ev, true
+}
+
+func (ekvs *EncryptedKeyValueStore) decrypt(key string, ev *encryptedValue, keyWrapper KeyWrapper) ([]byte, error) {
+	if !bytes.Equal(ev.KeyID, keyWrapper.KeyID()) {
+		return nil, fmt.Errorf("Value %s is encrypted with unknown key %s", key, hex.EncodeToString(ev.KeyID))
+	}
+	dataKey, err := keyWrapper.UnwrapKey(ev.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt data key of value %s: %v", key, err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt value %s: %v", key, err)
+	}
+	value, err := openWithNonce(aead, ev.Ciphertext, additionalData(key, ev))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt value %s, it may have been tampered with: %v", key, err)
+	}
+	return value, nil
+}
+
+func (ekvs *EncryptedKeyValueStore) setValue(key string, value []byte, keyWrapper KeyWrapper) error {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("Failed to generate data key: %v", err)
+	}
+	wrappedKey, err := keyWrapper.WrapKey(dataKey)
+	if err != nil {
+		return fmt.Errorf("Failed to encrypt data key: %v", err)
+	}
+	ev := &encryptedValue{Version: encryptedValueVersion, KeyID: keyWrapper.KeyID(), WrappedKey: wrappedKey}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+	ev.Ciphertext, err = sealWithNonce(aead, value, additionalData(key, ev))
+	if err != nil {
+		return fmt.Errorf("Failed to encrypt value %s: %v", key, err)
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("Marshal json return error: %v", err)
+	}
+	return ekvs.store.SetValue(key, data)
+}
+
+// additionalData binds the ciphertext to the key name and to the
+// wrapped data key
+func additionalData(key string, ev *encryptedValue) []byte {
+	data, _ := json.Marshal([]interface{}{ev.Version, key, ev.KeyID, ev.WrappedKey})
+	return data
+}
@@ -0,0 +1,206 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyvaluestore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestEncryptedKVSMethods(t *testing.T) {
+	stateStore, cleanup := createTestFileStore(t)
+	defer cleanup()
+
+	keyWrapper, err := NewPassphraseKeyWrapper([]byte("passphrase"), []byte("salt"))
+	if err != nil {
+		t.Fatalf("NewPassphraseKeyWrapper return error[%s]", err)
+	}
+	encryptedStore, err := CreateNewEncryptedKeyValueStore(stateStore, keyWrapper)
+	if err != nil {
+		t.Fatalf("CreateNewEncryptedKeyValueStore return error[%s]", err)
+	}
+
+	if err := encryptedStore.SetValue("testvalue", []byte("secret data")); err != nil {
+		t.Fatalf("encryptedStore.SetValue return error[%s]", err)
+	}
+	raw, err := stateStore.GetValue("testvalue")
+	if err != nil {
+		t.Fatalf("stateStore.GetValue return error[%s]", err)
+	}
+	if bytes.Contains(raw, []byte("secret data")) {
+		t.Fatalf("value was saved in plain text")
+	}
+	value, err := encryptedStore.GetValue("testvalue")
+	if err != nil {
+		t.Fatalf("encryptedStore.GetValue return error[%s]", err)
+	}
+	if string(value) != "secret data" {
+		t.Fatalf("encryptedStore.GetValue didn't return the right value")
+	}
+	if _, err := encryptedStore.GetValue("missing"); !IsKeyNotFound(err) {
+		t.Fatalf("encryptedStore.GetValue should return KeyNotFoundError, got %v", err)
+	}
+
+	// the same passphrase and salt open the store again
+	keyWrapper, _ = NewPassphraseKeyWrapper([]byte("passphrase"), []byte("salt"))
+	reopened, _ := CreateNewEncryptedKeyValueStore(stateStore, keyWrapper)
+	if value, err := reopened.GetValue("testvalue"); err != nil || string(value) != "secret data" {
+		t.Fatalf("reopened store didn't return the right value: %v", err)
+	}
+
+	// a different passphrase does not
+	keyWrapper, _ = NewPassphraseKeyWrapper([]byte("wrong"), []byte("salt"))
+	wrongStore, _ := CreateNewEncryptedKeyValueStore(stateStore, keyWrapper)
+	if _, err := wrongStore.GetValue("testvalue"); err == nil {
+		t.Fatalf("GetValue with the wrong passphrase should fail")
+	}
+}
+
+func TestEncryptedKVSTampering(t *testing.T) {
+	stateStore, cleanup := createTestFileStore(t)
+	defer cleanup()
+
+	keyWrapper, _ := NewPassphraseKeyWrapper([]byte("passphrase"), []byte("salt"))
+	encryptedStore, _ := CreateNewEncryptedKeyValueStore(stateStore, keyWrapper)
+	encryptedStore.SetValue("a", []byte("value a"))
+	encryptedStore.SetValue("b", []byte("value b"))
+
+	raw, _ := stateStore.GetValue("a")
+	ev := &encryptedValue{}
+	if err := json.Unmarshal(raw, ev); err != nil {
+		t.Fatalf("json.Unmarshal return error[%s]", err)
+	}
+	ev.Ciphertext[len(ev.Ciphertext)-1] ^= 1
+	tampered, _ := json.Marshal(ev)
+	stateStore.SetValue("a", tampered)
+	if _, err := encryptedStore.GetValue("a"); err == nil {
+		t.Fatalf("GetValue should reject a tampered value")
+	}
+
+	// a value moved to another key is rejected as well
+	raw, _ = stateStore.GetValue("b")
+	stateStore.SetValue("a", raw)
+	if _, err := encryptedStore.GetValue("a"); err == nil {
+		t.Fatalf("GetValue should reject a value moved from another key")
+	}
+
+	stateStore.SetValue("a", []byte("not encrypted"))
+	if _, err := encryptedStore.GetValue("a"); err == nil {
+		t.Fatalf("GetValue should reject a value that isn't encrypted")
+	}
+}
+
+func TestEncryptedKVSKeyRotation(t *testing.T) {
+	stateStore, cleanup := createTestFileStore(t)
+	defer cleanup()
+
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error[%s]", err)
+	}
+	cryptoSuite := bccspFactory.GetDefault()
+	key, err := cryptoSuite.KeyGen(&bccsp.AES256KeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error[%s]", err)
+	}
+	oldKeyWrapper, err := NewBCCSPKeyWrapper(cryptoSuite, key)
+	if err != nil {
+		t.Fatalf("NewBCCSPKeyWrapper return error[%s]", err)
+	}
+	encryptedStore, _ := CreateNewEncryptedKeyValueStore(stateStore, oldKeyWrapper)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := encryptedStore.SetValue(key, []byte("value "+key)); err != nil {
+			t.Fatalf("encryptedStore.SetValue return error[%s]", err)
+		}
+	}
+
+	newKeyWrapper, _ := NewPassphraseKeyWrapper([]byte("new passphrase"), []byte("salt"))
+
+	// simulate a rotation interrupted after the first value
+	partial, _ := CreateNewEncryptedKeyValueStore(stateStore, newKeyWrapper)
+	partial.SetValue("a", []byte("value a"))
+
+	// entries of the shared store that the encrypted store didn't write
+	stateStore.SetValue("plain", []byte("plain value"))
+	otherKeyWrapper, _ := NewPassphraseKeyWrapper([]byte("other passphrase"), []byte("salt"))
+	other, _ := CreateNewEncryptedKeyValueStore(stateStore, otherKeyWrapper)
+	other.SetValue("other", []byte("other value"))
+
+	if err := encryptedStore.RotateKey(newKeyWrapper); err != nil {
+		t.Fatalf("encryptedStore.RotateKey return error[%s]", err)
+	}
+
+	rotated, _ := CreateNewEncryptedKeyValueStore(stateStore, newKeyWrapper)
+	for _, key := range []string{"a", "b", "c"} {
+		value, err := rotated.GetValue(key)
+		if err != nil || string(value) != "value "+key {
+			t.Fatalf("value %s wasn't re-encrypted with the new key: %v", key, err)
+		}
+	}
+	if value, err := encryptedStore.GetValue("b"); err != nil || string(value) != "value b" {
+		t.Fatalf("rotated store should use the new key: %v", err)
+	}
+
+	if value, err := stateStore.GetValue("plain"); err != nil || string(value) != "plain value" {
+		t.Fatalf("unencrypted values should be left as they are: %v", err)
+	}
+	if value, err := other.GetValue("other"); err != nil || string(value) != "other value" {
+		t.Fatalf("values encrypted with another key should be left as they are: %v", err)
+	}
+
+	old, _ := CreateNewEncryptedKeyValueStore(stateStore, oldKeyWrapper)
+	if _, err := old.GetValue("b"); err == nil {
+		t.Fatalf("old key should no longer decrypt values")
+	}
+}
+
+func TestPassphraseKeyWrapperKey(t *testing.T) {
+	wrapper, err := NewPassphraseKeyWrapper([]byte("passwd"), []byte("salt"))
+	if err != nil {
+		t.Fatalf("NewPassphraseKeyWrapper return error: %s", err)
+	}
+	// the key is derived with PBKDF2-SHA256, changing the parameters
+	// would make existing stores unreadable
+	key := pbkdf2.Key([]byte("passwd"), []byte("salt"), passphraseIterations, 32, sha256.New)
+	keyID := sha256.Sum256(append([]byte("keyid"), key...))
+	if !bytes.Equal(wrapper.KeyID(), keyID[:]) {
+		t.Fatalf("passphrase key wrapper has the wrong key %x", wrapper.KeyID())
+	}
+}
+
+func createTestFileStore(t *testing.T) (*FileKeyValueStore, func()) {
+	dir, err := ioutil.TempDir("", "keyvaluestore")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	stateStore, err := CreateNewFileKeyValueStore(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("CreateNewFileKeyValueStore return error[%s]", err)
+	}
+	return stateStore, func() { os.RemoveAll(dir) }
+}
@@ -22,8 +22,12 @@ package keyvaluestore
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/op/go-logging"
 
@@ -32,9 +36,26 @@ import (
 
 var logger = logging.MustGetLogger("fabric_sdk_go")
 
+const (
+	fileSuffix   = ".json"
+	lockFileName = ".lock"
+	tmpPrefix    = ".tmp"
+)
+
 // FileKeyValueStore ...
+/**
+ * KeyValueStore that saves each value in its own file. Keys are escaped
+ * before being used as file names, so they cannot address files outside
+ * the store directory. Values saved under the unescaped file names of
+ * earlier versions are still read, and are moved to the escaped name on
+ * their next write. Writes go to a temporary file which is renamed over
+ * the value file, and are serialized across processes with a lock file.
+ */
 type FileKeyValueStore struct {
 	path string
+	// serializes writes within the process, the lock file
+	// serializes them across processes
+	mtx sync.Mutex
 }
 
 // CreateNewFileKeyValueStore ...
@@ -53,8 +74,15 @@ func CreateNewFileKeyValueStore(path string) (*FileKeyValueStore, error) {
  * @returns []byte for the value
  */
 func (fkvs *FileKeyValueStore) GetValue(key string) ([]byte, error) {
-	file := path.Join(fkvs.path, key+".json")
-	value, err := ioutil.ReadFile(file)
+	value, err := ioutil.ReadFile(fkvs.keyFile(key))
+	if os.IsNotExist(err) {
+		if legacyFile, ok := fkvs.legacyKeyFile(key); ok {
+			value, err = ioutil.ReadFile(legacyFile)
+		}
+	}
+	if os.IsNotExist(err) {
+		return nil, &KeyNotFoundError{Key: key}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -68,14 +96,170 @@ func (fkvs *FileKeyValueStore) GetValue(key string) ([]byte, error) {
  * @param {[]byte} value to save
  */
 func (fkvs *FileKeyValueStore) SetValue(key string, value []byte) error {
-	file := path.Join(fkvs.path, key+".json")
-	err := ioutil.WriteFile(file, value, 0600)
+	unlock, err := fkvs.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tmpFile, err := ioutil.TempFile(fkvs.path, tmpPrefix)
 	if err != nil {
 		return err
 	}
+	if err = writeAndSync(tmpFile, value); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	if err = os.Rename(tmpFile.Name(), fkvs.keyFile(key)); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	// the legacy file would shadow a later delete
+	if legacyFile, ok := fkvs.legacyKeyFile(key); ok {
+		if err = os.Remove(legacyFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 	return nil
 }
 
+// DeleteValue ...
+/**
+ * Delete the value associated with name.
+ * @param {string} name of the key to delete
+ */
+func (fkvs *FileKeyValueStore) DeleteValue(key string) error {
+	unlock, err := fkvs.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = os.Remove(fkvs.keyFile(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	found := err == nil
+	if legacyFile, ok := fkvs.legacyKeyFile(key); ok {
+		err = os.Remove(legacyFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		found = found || err == nil
+	}
+	if !found {
+		return &KeyNotFoundError{Key: key}
+	}
+	return nil
+}
+
+// ListKeys ...
+/**
+ * List the keys that start with prefix.
+ * @param {string} prefix of the keys to list, empty for all keys
+ * @returns {[]string} the keys in sorted order
+ */
+func (fkvs *FileKeyValueStore) ListKeys(prefix string) ([]string, error) {
+	files, err := ioutil.ReadDir(fkvs.path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		key := strings.TrimSuffix(name, fileSuffix)
+		// files that don't hold escaped keys were saved under their
+		// legacy names, a name that is both is taken as escaped
+		if unescaped, err := url.QueryUnescape(key); err == nil && url.QueryEscape(unescaped) == key {
+			key = unescaped
+		}
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Exists ...
+/**
+ * Check whether a value is associated with name.
+ * @param {string} name of the key
+ * @returns {bool}
+ */
+func (fkvs *FileKeyValueStore) Exists(key string) (bool, error) {
+	_, err := os.Stat(fkvs.keyFile(key))
+	if os.IsNotExist(err) {
+		if legacyFile, ok := fkvs.legacyKeyFile(key); ok {
+			_, err = os.Stat(legacyFile)
+		}
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// keyFile returns the file holding the value of key. The key is
+// escaped so that it cannot contain path separators.
+func (fkvs *FileKeyValueStore) keyFile(key string) string {
+	return path.Join(fkvs.path, url.QueryEscape(key)+fileSuffix)
+}
+
+// legacyKeyFile returns the file that earlier versions saved the value of
+// key in, unescaped. ok is false if the key needs no escaping or the file
+// would be outside the store directory.
+func (fkvs *FileKeyValueStore) legacyKeyFile(key string) (file string, ok bool) {
+	if url.QueryEscape(key) == key || strings.ContainsAny(key, "/\\") {
+		return "", false
+	}
+	return path.Join(fkvs.path, key+fileSuffix), true
+}
+
+// lock takes the store's write lock, the returned function releases it
+func (fkvs *FileKeyValueStore) lock() (func(), error) {
+	fkvs.mtx.Lock()
+	lockFile, err := os.OpenFile(path.Join(fkvs.path, lockFileName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		fkvs.mtx.Unlock()
+		return nil, fmt.Errorf("Could not open lock file: %v", err)
+	}
+	if err = lockFileExclusive(lockFile); err != nil {
+		lockFile.Close()
+		fkvs.mtx.Unlock()
+		return nil, fmt.Errorf("Could not lock store: %v", err)
+	}
+	return func() {
+		unlockFile(lockFile)
+		lockFile.Close()
+		fkvs.mtx.Unlock()
+	}, nil
+}
+
+func writeAndSync(file *os.File, value []byte) error {
+	if _, err := file.Write(value); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
 // createDirIfNotExists
 func createDirIfNotExists(path string) error {
 	missing, err := utils.DirMissingOrEmpty(path)
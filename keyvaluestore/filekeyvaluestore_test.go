@@ -20,6 +20,9 @@ limitations under the License.
 package keyvaluestore
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 )
 
@@ -38,3 +41,108 @@ func TestFKVSMethods(t *testing.T) {
 	}
 
 }
+
+func TestFKVSContract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyvaluestore")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	defer os.RemoveAll(dir)
+	stateStore, err := CreateNewFileKeyValueStore(path.Join(dir, "store"))
+	if err != nil {
+		t.Fatalf("CreateNewFileKeyValueStore return error[%s]", err)
+	}
+
+	_, err = stateStore.GetValue("missing")
+	if !IsKeyNotFound(err) {
+		t.Fatalf("stateStore.GetValue should return KeyNotFoundError, got %v", err)
+	}
+	exists, err := stateStore.Exists("missing")
+	if err != nil || exists {
+		t.Fatalf("stateStore.Exists should return false for missing key")
+	}
+
+	for _, key := range []string{"user.a", "user.b", "other", "../escape"} {
+		if err := stateStore.SetValue(key, []byte(key)); err != nil {
+			t.Fatalf("stateStore.SetValue return error[%s]", err)
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "escape.json")); !os.IsNotExist(err) {
+		t.Fatalf("key escaped the store directory")
+	}
+	value, err := stateStore.GetValue("../escape")
+	if err != nil || string(value) != "../escape" {
+		t.Fatalf("stateStore.GetValue didn't return the right value")
+	}
+
+	keys, err := stateStore.ListKeys("user.")
+	if err != nil {
+		t.Fatalf("stateStore.ListKeys return error[%s]", err)
+	}
+	if len(keys) != 2 || keys[0] != "user.a" || keys[1] != "user.b" {
+		t.Fatalf("stateStore.ListKeys returned wrong keys: %v", keys)
+	}
+	keys, err = stateStore.ListKeys("")
+	if err != nil || len(keys) != 4 {
+		t.Fatalf("stateStore.ListKeys should list all keys, got %v", keys)
+	}
+
+	if err := stateStore.DeleteValue("user.a"); err != nil {
+		t.Fatalf("stateStore.DeleteValue return error[%s]", err)
+	}
+	exists, err = stateStore.Exists("user.a")
+	if err != nil || exists {
+		t.Fatalf("stateStore.Exists should return false for deleted key")
+	}
+	if err := stateStore.DeleteValue("user.a"); !IsKeyNotFound(err) {
+		t.Fatalf("stateStore.DeleteValue should return KeyNotFoundError, got %v", err)
+	}
+}
+
+func TestFKVSLegacyFileNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyvaluestore")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	defer os.RemoveAll(dir)
+	stateStore, err := CreateNewFileKeyValueStore(dir)
+	if err != nil {
+		t.Fatalf("CreateNewFileKeyValueStore return error[%s]", err)
+	}
+	// saved by an earlier version, without escaping the key
+	if err := ioutil.WriteFile(path.Join(dir, "admin@org1.json"), []byte("legacy"), 0600); err != nil {
+		t.Fatalf("WriteFile return error[%s]", err)
+	}
+
+	value, err := stateStore.GetValue("admin@org1")
+	if err != nil || string(value) != "legacy" {
+		t.Fatalf("stateStore.GetValue should read the legacy file, got %s %v", value, err)
+	}
+	exists, err := stateStore.Exists("admin@org1")
+	if err != nil || !exists {
+		t.Fatalf("stateStore.Exists should find the legacy file")
+	}
+	keys, err := stateStore.ListKeys("admin")
+	if err != nil || len(keys) != 1 || keys[0] != "admin@org1" {
+		t.Fatalf("stateStore.ListKeys should list the legacy key, got %v", keys)
+	}
+
+	if err := stateStore.SetValue("admin@org1", []byte("data")); err != nil {
+		t.Fatalf("stateStore.SetValue return error[%s]", err)
+	}
+	if _, err := os.Stat(path.Join(dir, "admin@org1.json")); !os.IsNotExist(err) {
+		t.Fatalf("stateStore.SetValue should replace the legacy file")
+	}
+	value, err = stateStore.GetValue("admin@org1")
+	if err != nil || string(value) != "data" {
+		t.Fatalf("stateStore.GetValue didn't return the right value")
+	}
+
+	ioutil.WriteFile(path.Join(dir, "user 1.json"), []byte("legacy"), 0600)
+	if err := stateStore.DeleteValue("user 1"); err != nil {
+		t.Fatalf("stateStore.DeleteValue should delete the legacy file, got %v", err)
+	}
+	if exists, _ := stateStore.Exists("user 1"); exists {
+		t.Fatalf("stateStore.Exists should return false for deleted key")
+	}
+}
@@ -19,6 +19,8 @@ limitations under the License.
 
 package keyvaluestore
 
+import "fmt"
+
 // KeyValueStore ...
 /**
  * Abstract class for a Key-Value store. The Chain class uses this store
@@ -41,4 +43,46 @@ type KeyValueStore interface {
 	 * @param {[]byte} value to save
 	 */
 	SetValue(key string, value []byte) error
+
+	/**
+	 * Delete the value associated with name.
+	 * @param {string} name of the key to delete
+	 */
+	DeleteValue(key string) error
+
+	/**
+	 * List the keys that start with prefix.
+	 * @param {string} prefix of the keys to list, empty for all keys
+	 * @returns {[]string}
+	 */
+	ListKeys(prefix string) ([]string, error)
+
+	/**
+	 * Check whether a value is associated with name.
+	 * @param {string} name of the key
+	 * @returns {bool}
+	 */
+	Exists(key string) (bool, error)
+}
+
+// KeyNotFoundError ...
+/**
+ * Returned by KeyValueStore implementations when no value is
+ * associated with a key.
+ */
+type KeyNotFoundError struct {
+	Key string
+}
+
+func (e *KeyNotFoundError) Error() string {
+	return fmt.Sprintf("key %s not found", e.Key)
+}
+
+// IsKeyNotFound ...
+/**
+ * Check whether err is a KeyNotFoundError.
+ */
+func IsKeyNotFound(err error) bool {
+	_, ok := err.(*KeyNotFoundError)
+	return ok
 }
@@ -0,0 +1,163 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyvaluestore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/hyperledger/fabric/bccsp"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// number of PBKDF2 iterations used to derive passphrase keys
+const passphraseIterations = 100000
+
+// KeyWrapper ...
+/**
+ * Encrypts and decrypts the per-value data keys of an
+ * EncryptedKeyValueStore with a key encryption key.
+ */
+type KeyWrapper interface {
+	/**
+	 * Identifies the key encryption key. Saved with each value so that
+	 * values encrypted with another key can be detected.
+	 * @returns {[]byte}
+	 */
+	KeyID() []byte
+
+	/**
+	 * Encrypt a data key.
+	 * @param {[]byte} dataKey to encrypt
+	 * @returns {[]byte} the wrapped key
+	 */
+	WrapKey(dataKey []byte) ([]byte, error)
+
+	/**
+	 * Decrypt a data key.
+	 * @param {[]byte} wrappedKey returned by WrapKey
+	 * @returns {[]byte} the data key
+	 */
+	UnwrapKey(wrappedKey []byte) ([]byte, error)
+}
+
+type bccspKeyWrapper struct {
+	cryptoSuite bccsp.BCCSP
+	key         bccsp.Key
+}
+
+// NewBCCSPKeyWrapper ...
+/**
+ * Returns a KeyWrapper that encrypts data keys with a symmetric key held
+ * by the crypto suite, for example one obtained with
+ * KeyGen(&bccsp.AES256KeyGenOpts{Temporary: false}) and later loaded
+ * again with GetKey(ski). The key never leaves the crypto suite.
+ */
+func NewBCCSPKeyWrapper(cryptoSuite bccsp.BCCSP, key bccsp.Key) (KeyWrapper, error) {
+	if cryptoSuite == nil {
+		return nil, fmt.Errorf("cryptoSuite is nil")
+	}
+	if key == nil || !key.Symmetric() {
+		return nil, fmt.Errorf("key must be a symmetric key")
+	}
+	return &bccspKeyWrapper{cryptoSuite: cryptoSuite, key: key}, nil
+}
+
+func (w *bccspKeyWrapper) KeyID() []byte {
+	return w.key.SKI()
+}
+
+func (w *bccspKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	return w.cryptoSuite.Encrypt(w.key, dataKey, &bccsp.AESCBCPKCS7ModeOpts{})
+}
+
+func (w *bccspKeyWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	// the software crypto suite decrypts in place
+	ciphertext := append([]byte(nil), wrappedKey...)
+	return w.cryptoSuite.Decrypt(w.key, ciphertext, &bccsp.AESCBCPKCS7ModeOpts{})
+}
+
+type passphraseKeyWrapper struct {
+	keyID []byte
+	aead  cipher.AEAD
+}
+
+// NewPassphraseKeyWrapper ...
+/**
+ * Returns a KeyWrapper that encrypts data keys with AES-GCM under a key
+ * derived from a passphrase with PBKDF2-SHA256. The same salt must be
+ * used every time the store is opened.
+ */
+func NewPassphraseKeyWrapper(passphrase []byte, salt []byte) (KeyWrapper, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	if len(salt) == 0 {
+		return nil, fmt.Errorf("salt is empty")
+	}
+	key := pbkdf2.Key(passphrase, salt, passphraseIterations, 32, sha256.New)
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	keyID := sha256.Sum256(append([]byte("keyid"), key...))
+	return &passphraseKeyWrapper{keyID: keyID[:], aead: aead}, nil
+}
+
+func (w *passphraseKeyWrapper) KeyID() []byte {
+	return w.keyID
+}
+
+func (w *passphraseKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	return sealWithNonce(w.aead, dataKey, nil)
+}
+
+func (w *passphraseKeyWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	return openWithNonce(w.aead, wrappedKey, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealWithNonce encrypts plaintext under a random nonce, which is
+// prepended to the returned ciphertext
+func sealWithNonce(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openWithNonce(aead cipher.AEAD, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], additionalData)
+}
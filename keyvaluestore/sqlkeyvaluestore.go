@@ -0,0 +1,388 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyvaluestore
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maximum number of attempts of SetValue when other
+// writers keep updating the same key
+const maxSetValueAttempts = 10
+
+// sqlDialect holds the differences between the supported databases
+type sqlDialect struct {
+	// numbered placeholders ($1, $2, ...) instead of ?
+	numberedPlaceholders bool
+	blobType             string
+	// the backslash as a string literal, for LIKE ... ESCAPE
+	backslashLiteral string
+}
+
+var sqlDialects = map[string]*sqlDialect{
+	"sqlite3":  {blobType: "BLOB", backslashLiteral: `'\'`},
+	"mysql":    {blobType: "LONGBLOB", backslashLiteral: `'\\'`},
+	"postgres": {numberedPlaceholders: true, blobType: "BYTEA", backslashLiteral: `'\'`},
+}
+
+// sqlMigrations are the statements creating the schema. Each entry is
+// one schema version, applied in order; new versions must be appended.
+// MySQL commits DDL statements implicitly, so a version that failed
+// halfway isn't rolled back there: statements must be safe to run again
+// (CREATE TABLE IF NOT EXISTS, ...).
+var sqlMigrations = [][]string{
+	{
+		"CREATE TABLE IF NOT EXISTS kvs_entries (namespace VARCHAR(255) NOT NULL, kvs_key VARCHAR(255) NOT NULL, " +
+			"value {{BLOB}}, version BIGINT NOT NULL, PRIMARY KEY (namespace, kvs_key))",
+	},
+}
+
+// VersionConflictError ...
+/**
+ * Returned by SQLKeyValueStore.CompareAndSetValue when the value was
+ * changed by another writer since the expected version was read.
+ */
+type VersionConflictError struct {
+	Key     string
+	Version int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("key %s is no longer at version %d", e.Key, e.Version)
+}
+
+// IsVersionConflict ...
+/**
+ * Check whether err is a VersionConflictError.
+ */
+func IsVersionConflict(err error) bool {
+	_, ok := err.(*VersionConflictError)
+	return ok
+}
+
+// SQLKeyValueStore ...
+/**
+ * KeyValueStore backed by a database/sql database, so that several
+ * application instances can share state. Keys are scoped to a namespace,
+ * allowing several clients to use the same tables. Every value carries a
+ * version that is incremented on each write, which CompareAndSetValue uses
+ * to detect concurrent updates.
+ * The sqlite3, mysql and postgres drivers are supported; the application
+ * imports the driver and opens the database.
+ */
+type SQLKeyValueStore struct {
+	db        *sql.DB
+	dialect   *sqlDialect
+	namespace string
+}
+
+// CreateNewSQLKeyValueStore ...
+/**
+ * Creates the store and migrates the database schema to the latest version.
+ * @param {*sql.DB} db the opened database
+ * @param {string} driverName the name the database driver is registered under
+ * @param {string} namespace the keys are scoped to
+ */
+func CreateNewSQLKeyValueStore(db *sql.DB, driverName string, namespace string) (*SQLKeyValueStore, error) {
+	if db == nil {
+		return nil, fmt.Errorf("Failed to create SQLKeyValueStore. Missing requirement 'db' parameter.")
+	}
+	dialect, ok := sqlDialects[driverName]
+	if !ok {
+		return nil, fmt.Errorf("Failed to create SQLKeyValueStore. Unsupported driver %s", driverName)
+	}
+	skvs := &SQLKeyValueStore{db: db, dialect: dialect, namespace: namespace}
+	if err := skvs.migrate(); err != nil {
+		return nil, fmt.Errorf("Failed to migrate SQLKeyValueStore schema: %v", err)
+	}
+	return skvs, nil
+}
+
+// GetValue ...
+/**
+ * Get the value associated with name.
+ * @param {string} name
+ * @returns []byte for the value
+ */
+func (skvs *SQLKeyValueStore) GetValue(key string) ([]byte, error) {
+	value, _, err := skvs.GetVersionedValue(key)
+	return value, err
+}
+
+// GetVersionedValue ...
+/**
+ * Get the value associated with name along with its version.
+ * @param {string} name
+ * @returns []byte for the value
+ * @returns {int64} the version to pass to CompareAndSetValue
+ */
+func (skvs *SQLKeyValueStore) GetVersionedValue(key string) ([]byte, int64, error) {
+	var value []byte
+	var version int64
+	err := skvs.db.QueryRow(skvs.rebind("SELECT value, version FROM kvs_entries WHERE namespace = ? AND kvs_key = ?"),
+		skvs.namespace, key).Scan(&value, &version)
+	if err == sql.ErrNoRows {
+		return nil, 0, &KeyNotFoundError{Key: key}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, version, nil
+}
+
+// SetValue ...
+/**
+ * Set the value associated with name, whatever its current version.
+ * @param {string} name of the key to save
+ * @param {[]byte} value to save
+ */
+func (skvs *SQLKeyValueStore) SetValue(key string, value []byte) error {
+	for attempt := 0; attempt < maxSetValueAttempts; attempt++ {
+		_, version, err := skvs.GetVersionedValue(key)
+		if err != nil && !IsKeyNotFound(err) {
+			return err
+		}
+		_, err = skvs.CompareAndSetValue(key, value, version)
+		if !IsVersionConflict(err) {
+			return err
+		}
+		logger.Debugf("Concurrent update of key %s, retrying", key)
+	}
+	return fmt.Errorf("Failed to set key %s after %d attempts due to concurrent updates", key, maxSetValueAttempts)
+}
+
+// SetValueInTx ...
+/**
+ * Set the value associated with name as part of the caller's transaction,
+ * so that it is committed or rolled back along with the caller's own
+ * writes. The transaction must be on the store's database.
+ * @param {*sql.Tx} tx the caller's transaction
+ * @param {string} name of the key to save
+ * @param {[]byte} value to save
+ */
+func (skvs *SQLKeyValueStore) SetValueInTx(tx *sql.Tx, key string, value []byte) error {
+	if tx == nil {
+		return fmt.Errorf("tx is nil")
+	}
+	result, err := tx.Exec(skvs.rebind("UPDATE kvs_entries SET value = ?, version = version + 1 "+
+		"WHERE namespace = ? AND kvs_key = ?"), value, skvs.namespace, key)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+	_, err = tx.Exec(skvs.rebind("INSERT INTO kvs_entries (namespace, kvs_key, value, version) VALUES (?, ?, ?, 1)"),
+		skvs.namespace, key, value)
+	return err
+}
+
+// CompareAndSetValue ...
+/**
+ * Set the value associated with name only if its version is still the
+ * expected one.
+ * @param {string} name of the key to save
+ * @param {[]byte} value to save
+ * @param {int64} version returned by GetVersionedValue, or 0 if the key
+ * must not exist yet
+ * @returns {int64} the new version of the value
+ */
+func (skvs *SQLKeyValueStore) CompareAndSetValue(key string, value []byte, version int64) (int64, error) {
+	if version == 0 {
+		_, err := skvs.db.Exec(skvs.rebind("INSERT INTO kvs_entries (namespace, kvs_key, value, version) VALUES (?, ?, ?, 1)"),
+			skvs.namespace, key, value)
+		if err != nil {
+			// the insert fails if the key was created concurrently
+			if exists, existsErr := skvs.Exists(key); existsErr == nil && exists {
+				return 0, &VersionConflictError{Key: key, Version: version}
+			}
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	result, err := skvs.db.Exec(skvs.rebind("UPDATE kvs_entries SET value = ?, version = ? "+
+		"WHERE namespace = ? AND kvs_key = ? AND version = ?"), value, version+1, skvs.namespace, key, version)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, &VersionConflictError{Key: key, Version: version}
+	}
+	return version + 1, nil
+}
+
+// DeleteValue ...
+/**
+ * Delete the value associated with name.
+ * @param {string} name of the key to delete
+ */
+func (skvs *SQLKeyValueStore) DeleteValue(key string) error {
+	result, err := skvs.db.Exec(skvs.rebind("DELETE FROM kvs_entries WHERE namespace = ? AND kvs_key = ?"),
+		skvs.namespace, key)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return &KeyNotFoundError{Key: key}
+	}
+	return nil
+}
+
+// ListKeys ...
+/**
+ * List the keys that start with prefix.
+ * @param {string} prefix of the keys to list, empty for all keys
+ * @returns {[]string} the keys in sorted order
+ */
+func (skvs *SQLKeyValueStore) ListKeys(prefix string) ([]string, error) {
+	rows, err := skvs.db.Query(skvs.rebind("SELECT kvs_key FROM kvs_entries WHERE namespace = ? "+
+		"AND kvs_key LIKE ? ESCAPE "+skvs.dialect.backslashLiteral+" ORDER BY kvs_key"),
+		skvs.namespace, escapeLikePattern(prefix)+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		// LIKE ignores case on SQLite and MySQL
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, rows.Err()
+}
+
+// escapeLikePattern escapes the wildcards of a LIKE pattern with backslashes
+func escapeLikePattern(pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(pattern)
+}
+
+// Exists ...
+/**
+ * Check whether a value is associated with name.
+ * @param {string} name of the key
+ * @returns {bool}
+ */
+func (skvs *SQLKeyValueStore) Exists(key string) (bool, error) {
+	var count int
+	err := skvs.db.QueryRow(skvs.rebind("SELECT COUNT(*) FROM kvs_entries WHERE namespace = ? AND kvs_key = ?"),
+		skvs.namespace, key).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// migrate applies the schema versions missing from the database. Each
+// version is applied in a transaction that records it, so concurrent
+// instances don't apply a version twice. On MySQL the DDL statements
+// commit on their own, only the version record is transactional; a
+// version that failed is applied again from its first statement.
+func (skvs *SQLKeyValueStore) migrate() error {
+	if _, err := skvs.db.Exec("CREATE TABLE IF NOT EXISTS kvs_schema (version INTEGER NOT NULL PRIMARY KEY)"); err != nil {
+		return err
+	}
+	for i, statements := range sqlMigrations {
+		version := i + 1
+		current, err := skvs.schemaVersion()
+		if err != nil {
+			return err
+		}
+		if current >= version {
+			continue
+		}
+		logger.Infof("Migrating KeyValueStore schema to version %d", version)
+		if err := skvs.applyMigration(version, statements); err != nil {
+			// another instance may have applied the same version
+			if current, currentErr := skvs.schemaVersion(); currentErr == nil && current >= version {
+				continue
+			}
+			return fmt.Errorf("schema version %d: %v", version, err)
+		}
+	}
+	return nil
+}
+
+func (skvs *SQLKeyValueStore) applyMigration(version int, statements []string) error {
+	tx, err := skvs.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(strings.Replace(statement, "{{BLOB}}", skvs.dialect.blobType, -1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(skvs.rebind("INSERT INTO kvs_schema (version) VALUES (?)"), version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (skvs *SQLKeyValueStore) schemaVersion() (int, error) {
+	var version sql.NullInt64
+	if err := skvs.db.QueryRow("SELECT MAX(version) FROM kvs_schema").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// rebind replaces the ? placeholders of query with the
+// placeholders of the database
+func (skvs *SQLKeyValueStore) rebind(query string) string {
+	if !skvs.dialect.numberedPlaceholders {
+		return query
+	}
+	var rebound []byte
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			rebound = append(rebound, query[i])
+			continue
+		}
+		n++
+		rebound = append(rebound, '$')
+		rebound = strconv.AppendInt(rebound, int64(n), 10)
+	}
+	return string(rebound)
+}
@@ -0,0 +1,186 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyvaluestore
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSQLKVSMethods(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	stateStore, err := CreateNewSQLKeyValueStore(db, "sqlite3", "client1")
+	if err != nil {
+		t.Fatalf("CreateNewSQLKeyValueStore return error[%s]", err)
+	}
+	// a second store on the same database finds the schema migrated
+	otherStore, err := CreateNewSQLKeyValueStore(db, "sqlite3", "client2")
+	if err != nil {
+		t.Fatalf("CreateNewSQLKeyValueStore return error[%s]", err)
+	}
+
+	if _, err := stateStore.GetValue("missing"); !IsKeyNotFound(err) {
+		t.Fatalf("stateStore.GetValue should return KeyNotFoundError, got %v", err)
+	}
+	for _, key := range []string{"user.a", "user.b", "other"} {
+		if err := stateStore.SetValue(key, []byte(key)); err != nil {
+			t.Fatalf("stateStore.SetValue return error[%s]", err)
+		}
+	}
+	if err := stateStore.SetValue("user.a", []byte("data")); err != nil {
+		t.Fatalf("stateStore.SetValue return error[%s]", err)
+	}
+	value, err := stateStore.GetValue("user.a")
+	if err != nil || string(value) != "data" {
+		t.Fatalf("stateStore.GetValue didn't return the right value")
+	}
+
+	keys, err := stateStore.ListKeys("user.")
+	if err != nil {
+		t.Fatalf("stateStore.ListKeys return error[%s]", err)
+	}
+	if len(keys) != 2 || keys[0] != "user.a" || keys[1] != "user.b" {
+		t.Fatalf("stateStore.ListKeys returned wrong keys: %v", keys)
+	}
+	keys, err = stateStore.ListKeys("")
+	if err != nil || len(keys) != 3 {
+		t.Fatalf("stateStore.ListKeys should list all keys, got %v", keys)
+	}
+
+	// namespaces don't see each other's keys
+	if exists, err := otherStore.Exists("user.a"); err != nil || exists {
+		t.Fatalf("key of another namespace should not exist")
+	}
+	if keys, err := otherStore.ListKeys(""); err != nil || len(keys) != 0 {
+		t.Fatalf("otherStore.ListKeys should not list keys of another namespace, got %v", keys)
+	}
+
+	if err := stateStore.DeleteValue("user.a"); err != nil {
+		t.Fatalf("stateStore.DeleteValue return error[%s]", err)
+	}
+	if exists, err := stateStore.Exists("user.a"); err != nil || exists {
+		t.Fatalf("stateStore.Exists should return false for deleted key")
+	}
+	if err := stateStore.DeleteValue("user.a"); !IsKeyNotFound(err) {
+		t.Fatalf("stateStore.DeleteValue should return KeyNotFoundError, got %v", err)
+	}
+}
+
+func TestSQLKVSListKeysWildcards(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	stateStore, err := CreateNewSQLKeyValueStore(db, "sqlite3", "client1")
+	if err != nil {
+		t.Fatalf("CreateNewSQLKeyValueStore return error[%s]", err)
+	}
+	for _, key := range []string{"user_1", "userA1", "USER_2", "100%", "1000", `a\b`, "axb"} {
+		if err := stateStore.SetValue(key, []byte(key)); err != nil {
+			t.Fatalf("stateStore.SetValue return error[%s]", err)
+		}
+	}
+	for prefix, expected := range map[string]string{"user_": "user_1", "100%": "100%", `a\`: `a\b`} {
+		keys, err := stateStore.ListKeys(prefix)
+		if err != nil || len(keys) != 1 || keys[0] != expected {
+			t.Fatalf("stateStore.ListKeys(%s) should only list %s, got %v %v", prefix, expected, keys, err)
+		}
+	}
+}
+
+func TestSQLKVSCompareAndSet(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	stateStore, err := CreateNewSQLKeyValueStore(db, "sqlite3", "client1")
+	if err != nil {
+		t.Fatalf("CreateNewSQLKeyValueStore return error[%s]", err)
+	}
+
+	version, err := stateStore.CompareAndSetValue("key", []byte("v1"), 0)
+	if err != nil || version != 1 {
+		t.Fatalf("CompareAndSetValue should create the key, got version %d error %v", version, err)
+	}
+	if _, err := stateStore.CompareAndSetValue("key", []byte("v1"), 0); !IsVersionConflict(err) {
+		t.Fatalf("CompareAndSetValue should fail for an existing key, got %v", err)
+	}
+
+	_, readVersion, err := stateStore.GetVersionedValue("key")
+	if err != nil || readVersion != 1 {
+		t.Fatalf("GetVersionedValue returned version %d error %v", readVersion, err)
+	}
+	// another writer updates the key
+	if err := stateStore.SetValue("key", []byte("v2")); err != nil {
+		t.Fatalf("stateStore.SetValue return error[%s]", err)
+	}
+	if _, err := stateStore.CompareAndSetValue("key", []byte("stale"), readVersion); !IsVersionConflict(err) {
+		t.Fatalf("CompareAndSetValue should fail for a stale version, got %v", err)
+	}
+
+	value, readVersion, _ := stateStore.GetVersionedValue("key")
+	if string(value) != "v2" || readVersion != 2 {
+		t.Fatalf("expected v2 at version 2, got %s at version %d", value, readVersion)
+	}
+	version, err = stateStore.CompareAndSetValue("key", []byte("v3"), readVersion)
+	if err != nil || version != 3 {
+		t.Fatalf("CompareAndSetValue should update the key, got version %d error %v", version, err)
+	}
+}
+
+func TestSQLKVSUnsupportedDriver(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+
+	if _, err := CreateNewSQLKeyValueStore(db, "unknown", "client1"); err == nil {
+		t.Fatalf("CreateNewSQLKeyValueStore should fail for an unsupported driver")
+	}
+	if _, err := CreateNewSQLKeyValueStore(nil, "sqlite3", "client1"); err == nil {
+		t.Fatalf("CreateNewSQLKeyValueStore should fail without a database")
+	}
+}
+
+func TestSQLRebind(t *testing.T) {
+	skvs := &SQLKeyValueStore{dialect: sqlDialects["postgres"]}
+	if query := skvs.rebind("a = ? AND b = ?"); query != "a = $1 AND b = $2" {
+		t.Fatalf("rebind returned %s", query)
+	}
+}
+
+func openTestDB(t *testing.T) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "sqlkeyvaluestore")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	db, err := sql.Open("sqlite3", path.Join(dir, "kvs.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("sql.Open return error[%s]", err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+// LocalMSP ...
+/**
+ * The LocalMSP holds the content of a local MSP directory, as generated
+ * by cryptogen: the signing certificate and its private key, and the
+ * certificates of the organization's CAs and admins.
+ */
+type LocalMSP struct {
+	MspID string
+	// PEM encoded signing certificate
+	SignCert          []byte
+	CACerts           []*x509.Certificate
+	IntermediateCerts []*x509.Certificate
+	AdminCerts        []*x509.Certificate
+	// PEM encoded private key matching SignCert
+	privateKey []byte
+}
+
+// LoadLocalMSP ...
+/**
+ * Load a local MSP directory. The directory contains signcerts/ with the
+ * signing certificate, keystore/ with its private key, cacerts/ and
+ * optionally intermediatecerts/ and admincerts/. The private key is the one
+ * in keystore/ that matches the signing certificate, and the signing
+ * certificate must be issued by one of the CAs.
+ * @param {string} mspDir path of the MSP directory
+ * @param {string} mspID of the organization, which the directory doesn't hold
+ */
+func LoadLocalMSP(mspDir string, mspID string) (*LocalMSP, error) {
+	if mspID == "" {
+		return nil, fmt.Errorf("MSP ID is empty")
+	}
+	signCerts, err := readPEMFiles(path.Join(mspDir, "signcerts"))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read signcerts: %v", err)
+	}
+	if len(signCerts) == 0 {
+		return nil, fmt.Errorf("No signing certificate found in %s", path.Join(mspDir, "signcerts"))
+	}
+	m := &LocalMSP{MspID: mspID, SignCert: signCerts[0]}
+	signCert, err := parseCertificatePEM(m.SignCert)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.CACerts, err = readCertificates(path.Join(mspDir, "cacerts"), true); err != nil {
+		return nil, err
+	}
+	if m.IntermediateCerts, err = readCertificates(path.Join(mspDir, "intermediatecerts"), false); err != nil {
+		return nil, err
+	}
+	if m.AdminCerts, err = readCertificates(path.Join(mspDir, "admincerts"), false); err != nil {
+		return nil, err
+	}
+	if err := m.verify(signCert); err != nil {
+		return nil, fmt.Errorf("Signing certificate is not valid for MSP %s: %v", mspID, err)
+	}
+
+	keys, err := readPEMFiles(path.Join(mspDir, "keystore"))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read keystore: %v", err)
+	}
+	for _, keyPEM := range keys {
+		key, err := parsePrivateKeyPEM(keyPEM)
+		if err != nil {
+			continue
+		}
+		if keyMatchesCertificate(key, signCert) {
+			m.privateKey = keyPEM
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("No private key in %s matches the signing certificate", path.Join(mspDir, "keystore"))
+}
+
+// GetWalletIdentity ...
+/**
+ * Get the signing identity of the MSP as a wallet identity.
+ * @param {string} label of the identity
+ */
+func (m *LocalMSP) GetWalletIdentity(label string) (*WalletIdentity, error) {
+	return NewWalletIdentity(label, m.MspID, m.SignCert, m.privateKey)
+}
+
+// CreateUser ...
+/**
+ * Create a User for the signing identity of the MSP, importing the private
+ * key into the crypto suite.
+ * @param {string} name of the user
+ * @param {bccsp.BCCSP} cryptoSuite the key is imported into
+ * @param {bool} temporary true to keep the key in memory only
+ */
+func (m *LocalMSP) CreateUser(name string, cryptoSuite bccsp.BCCSP, temporary bool) (User, error) {
+	identity, err := m.GetWalletIdentity(name)
+	if err != nil {
+		return nil, err
+	}
+	return identity.CreateUser(cryptoSuite, temporary)
+}
+
+// VerifyCertificate ...
+/**
+ * Verify that a certificate was issued by one of the MSP's CAs.
+ * @param {[]byte} certPEM the PEM encoded certificate
+ */
+func (m *LocalMSP) VerifyCertificate(certPEM []byte) error {
+	cert, err := parseCertificatePEM(certPEM)
+	if err != nil {
+		return err
+	}
+	return m.verify(cert)
+}
+
+func (m *LocalMSP) verify(cert *x509.Certificate) error {
+	opts := x509.VerifyOptions{Roots: x509.NewCertPool(), Intermediates: x509.NewCertPool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+	for _, caCert := range m.CACerts {
+		opts.Roots.AddCert(caCert)
+	}
+	for _, intermediateCert := range m.IntermediateCerts {
+		opts.Intermediates.AddCert(intermediateCert)
+	}
+	_, err := cert.Verify(opts)
+	return err
+}
+
+// readCertificates parses the PEM certificates of a directory
+func readCertificates(dir string, required bool) ([]*x509.Certificate, error) {
+	files, err := readPEMFiles(dir)
+	if os.IsNotExist(err) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s: %v", dir, err)
+	}
+	if required && len(files) == 0 {
+		return nil, fmt.Errorf("No certificate found in %s", dir)
+	}
+	var certs []*x509.Certificate
+	for _, file := range files {
+		cert, err := parseCertificatePEM(file)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse certificate in %s: %v", dir, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// readPEMFiles returns the content of the PEM files of a directory,
+// in file name order
+func readPEMFiles(dir string) ([][]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var contents [][]byte
+	for _, name := range names {
+		content, err := ioutil.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if block, _ := pem.Decode(content); block == nil {
+			logger.Debugf("Skipping file %s in %s, it isn't PEM encoded", name, dir)
+			continue
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+)
+
+func TestLoadLocalMSP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localmsp")
+	if err != nil {
+		t.Fatalf("TempDir return error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	caCert, caKey := createTestCA(t)
+	signCert, signKey := createTestSignedCertificate(t, caCert, caKey)
+	_, otherKey := createTestCertificate(t)
+
+	writeTestFile(t, path.Join(dir, "cacerts", "ca.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw}))
+	writeTestFile(t, path.Join(dir, "signcerts", "user1-cert.pem"), signCert)
+	writeTestFile(t, path.Join(dir, "admincerts", "admin-cert.pem"), signCert)
+	writeTestFile(t, path.Join(dir, "keystore", "a_sk"), marshalTestKey(t, otherKey))
+	writeTestFile(t, path.Join(dir, "keystore", "b_sk"), marshalTestKey(t, signKey))
+
+	localMSP, err := LoadLocalMSP(dir, "Org1MSP")
+	if err != nil {
+		t.Fatalf("LoadLocalMSP return error: %s", err)
+	}
+	if localMSP.MspID != "Org1MSP" || len(localMSP.CACerts) != 1 || len(localMSP.AdminCerts) != 1 {
+		t.Fatalf("LoadLocalMSP returned wrong content")
+	}
+	if err := localMSP.VerifyCertificate(signCert); err != nil {
+		t.Fatalf("VerifyCertificate return error: %s", err)
+	}
+	selfSigned, _ := createTestCertificate(t)
+	if err := localMSP.VerifyCertificate(selfSigned); err == nil {
+		t.Fatalf("VerifyCertificate should fail for a certificate of another CA")
+	}
+
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %s", err)
+	}
+	user, err := localMSP.CreateUser("user1", bccspFactory.GetDefault(), true)
+	if err != nil {
+		t.Fatalf("CreateUser return error: %s", err)
+	}
+	if user.GetName() != "user1" || user.GetPrivateKey() == nil || !bytes.Equal(user.GetEnrollmentCertificate(), signCert) {
+		t.Fatalf("CreateUser returned wrong user")
+	}
+
+	// the signing key is required
+	os.Remove(path.Join(dir, "keystore", "b_sk"))
+	if _, err := LoadLocalMSP(dir, "Org1MSP"); err == nil {
+		t.Fatalf("LoadLocalMSP should fail without the signing key")
+	}
+	if _, err := LoadLocalMSP(path.Join(dir, "missing"), "Org1MSP"); err == nil {
+		t.Fatalf("LoadLocalMSP should fail for a missing directory")
+	}
+}
+
+func createTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error: %s", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ca"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate return error: %s", err)
+	}
+	return cert, key
+}
+
+func createTestSignedCertificate(t *testing.T, caCert *x509.Certificate, caKey *ecdsa.PrivateKey) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error: %s", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "user1"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), key
+}
+
+func marshalTestKey(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey return error: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func writeTestFile(t *testing.T, file string, content []byte) {
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		t.Fatalf("MkdirAll return error: %s", err)
+	}
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		t.Fatalf("WriteFile return error: %s", err)
+	}
+}
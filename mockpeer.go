@@ -33,6 +33,7 @@ type mockPeer struct {
 	MockURL   string
 	MockRoles []string
 	MockCert  *pem.Block
+	MockMspID string
 }
 
 // ConnectEventSource does not connect anywhere
@@ -85,6 +86,16 @@ func (p *mockPeer) SetEnrollmentCertificate(pem *pem.Block) {
 	p.MockCert = pem
 }
 
+// GetMspID returns the mock peer's mock MSP ID
+func (p *mockPeer) GetMspID() string {
+	return p.MockMspID
+}
+
+// SetMspID sets the mock peer's mock MSP ID
+func (p *mockPeer) SetMspID(mspID string) {
+	p.MockMspID = mspID
+}
+
 // GetURL returns the mock peer's mock URL
 func (p *mockPeer) GetURL() string {
 	return p.MockURL
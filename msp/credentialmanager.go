@@ -0,0 +1,291 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msp
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp"
+
+	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
+)
+
+// Reenroller ...
+/**
+ * A Reenroller gets a new certificate and key for an enrolled user.
+ * Services implements it.
+ */
+type Reenroller interface {
+	ReenrollWithCSR(user fabric_sdk.User, request *CSRRequest) ([]byte, bccsp.Key, error)
+}
+
+// RenewalEvent ...
+/**
+ * The RenewalEvent reports the renewal of a user's enrollment certificate.
+ * Err is set if the renewal failed, the user then keeps its certificate.
+ */
+type RenewalEvent struct {
+	UserName  string
+	OldExpiry time.Time
+	NewExpiry time.Time
+	Err       error
+}
+
+// CredentialManager ...
+/**
+ * The CredentialManager watches the expiry of the enrollment certificates
+ * of a Client's users. Once a certificate is within the renewal window of
+ * its expiry, the user is re-enrolled and the new certificate and key
+ * replace the old ones in the Client and its state store.
+ */
+type CredentialManager struct {
+	client          fabric_sdk.Client
+	reenroller      Reenroller
+	renewalWindow   time.Duration
+	csrRequest      *CSRRequest
+	skipPersistence bool
+	mtx             sync.Mutex
+	callbacks       []func(*RenewalEvent)
+	// serializes checks, so that a user is renewed once
+	checkMtx sync.Mutex
+	stop     chan struct{}
+}
+
+// NewCredentialManager ...
+/**
+ * @param {Client} client whose users are renewed
+ * @param {Reenroller} reenroller the CA services, typically Services
+ * @param {time.Duration} renewalWindow how long before expiry certificates are renewed
+ */
+func NewCredentialManager(client fabric_sdk.Client, reenroller Reenroller, renewalWindow time.Duration) (*CredentialManager, error) {
+	if client == nil {
+		return nil, fmt.Errorf("client is nil")
+	}
+	if reenroller == nil {
+		return nil, fmt.Errorf("reenroller is nil")
+	}
+	if renewalWindow <= 0 {
+		return nil, fmt.Errorf("renewal window must be positive")
+	}
+	return &CredentialManager{client: client, reenroller: reenroller, renewalWindow: renewalWindow}, nil
+}
+
+// SetCSRRequest ...
+/**
+ * Set the content of the CSRs sent at renewal, nil for the defaults.
+ */
+func (cm *CredentialManager) SetCSRRequest(request *CSRRequest) {
+	cm.mtx.Lock()
+	defer cm.mtx.Unlock()
+	cm.csrRequest = request
+}
+
+// SetSkipPersistence ...
+/**
+ * Set to true to keep renewed users out of the Client's state store.
+ */
+func (cm *CredentialManager) SetSkipPersistence(skipPersistence bool) {
+	cm.mtx.Lock()
+	defer cm.mtx.Unlock()
+	cm.skipPersistence = skipPersistence
+}
+
+// RegisterRenewalEvent ...
+/**
+ * Register a callback invoked after each renewal attempt.
+ */
+func (cm *CredentialManager) RegisterRenewalEvent(callback func(*RenewalEvent)) {
+	cm.mtx.Lock()
+	defer cm.mtx.Unlock()
+	cm.callbacks = append(cm.callbacks, callback)
+}
+
+// GetCertificateExpiry ...
+/**
+ * Get the expiry of a PEM encoded certificate.
+ */
+func GetCertificateExpiry(certPEM []byte) (time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Could not parse certificate: %v", err)
+	}
+	return cert.NotAfter, nil
+}
+
+// TimeToExpiry ...
+/**
+ * Get the time left until the enrollment certificate of a user expires,
+ * negative if it has expired.
+ * @param {string} name of the user, empty for the user context
+ */
+func (cm *CredentialManager) TimeToExpiry(name string) (time.Duration, error) {
+	user, err := cm.getUser(name)
+	if err != nil {
+		return 0, err
+	}
+	expiry, err := GetCertificateExpiry(user.GetEnrollmentCertificate())
+	if err != nil {
+		return 0, err
+	}
+	return expiry.Sub(time.Now()), nil
+}
+
+// CheckUser ...
+/**
+ * Renew the enrollment certificate of a user if it is within the renewal
+ * window of its expiry.
+ * @param {string} name of the user, empty for the user context
+ * @returns {bool} true if the certificate was renewed
+ */
+func (cm *CredentialManager) CheckUser(name string) (bool, error) {
+	cm.checkMtx.Lock()
+	defer cm.checkMtx.Unlock()
+	user, err := cm.getUser(name)
+	if err != nil {
+		return false, err
+	}
+	expiry, err := GetCertificateExpiry(user.GetEnrollmentCertificate())
+	if err != nil {
+		return false, err
+	}
+	if expiry.Sub(time.Now()) > cm.renewalWindow {
+		return false, nil
+	}
+
+	event := &RenewalEvent{UserName: user.GetName(), OldExpiry: expiry}
+	event.NewExpiry, event.Err = cm.renew(user)
+	cm.notify(event)
+	if event.Err != nil {
+		return false, event.Err
+	}
+	return true, nil
+}
+
+// Start ...
+/**
+ * Start checking the users periodically in the background.
+ * @param {time.Duration} interval between checks
+ * @param {[]string} names of the users, empty for the user context
+ */
+func (cm *CredentialManager) Start(interval time.Duration, names []string) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	cm.mtx.Lock()
+	defer cm.mtx.Unlock()
+	if cm.stop != nil {
+		return fmt.Errorf("CredentialManager is already started")
+	}
+	stop := make(chan struct{})
+	cm.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, name := range names {
+				if _, err := cm.CheckUser(name); err != nil {
+					logger.Warningf("Could not check the certificate of user '%s': %s", name, err)
+				}
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ...
+/**
+ * Stop the background checks.
+ */
+func (cm *CredentialManager) Stop() {
+	cm.mtx.Lock()
+	defer cm.mtx.Unlock()
+	if cm.stop != nil {
+		close(cm.stop)
+		cm.stop = nil
+	}
+}
+
+func (cm *CredentialManager) getUser(name string) (fabric_sdk.User, error) {
+	user, err := cm.client.GetUserContext(name)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("User '%s' not found", name)
+	}
+	return user, nil
+}
+
+// renew re-enrolls user and replaces it in the client, it returns
+// the expiry of the new certificate
+func (cm *CredentialManager) renew(user fabric_sdk.User) (time.Time, error) {
+	cm.mtx.Lock()
+	csrRequest := cm.csrRequest
+	skipPersistence := cm.skipPersistence
+	cm.mtx.Unlock()
+
+	cert, key, err := cm.reenroller.ReenrollWithCSR(user, csrRequest)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiry, err := GetCertificateExpiry(cert)
+	if err != nil {
+		return time.Time{}, err
+	}
+	renewed := fabric_sdk.NewUser(user.GetName())
+	renewed.SetMspID(user.GetMspID())
+	renewed.SetRoles(user.GetRoles())
+	renewed.SetEnrollmentCertificate(cert)
+	renewed.SetPrivateKey(key)
+	// the renewed user keeps signing and getting TCerts the same way
+	renewed.SetSigner(user.GetSigner())
+	renewed.SetTCertFetcher(user.GetTCertFetcher())
+	if err := cm.client.ReplaceUser(renewed, skipPersistence); err != nil {
+		return time.Time{}, err
+	}
+	logger.Infof("Renewed the certificate of user %s, it expires on %s", user.GetName(), expiry)
+	return expiry, nil
+}
+
+func (cm *CredentialManager) notify(event *RenewalEvent) {
+	cm.mtx.Lock()
+	callbacks := append([]func(*RenewalEvent){}, cm.callbacks...)
+	cm.mtx.Unlock()
+	for _, callback := range callbacks {
+		callback(event)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	cryptoSigner "github.com/hyperledger/fabric/bccsp/signer"
+
+	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
+	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
+)
+
+// mockReenroller issues self-signed certificates valid for validity
+type mockReenroller struct {
+	validity time.Duration
+	err      error
+}
+
+func (r *mockReenroller) ReenrollWithCSR(user fabric_sdk.User, request *CSRRequest) ([]byte, bccsp.Key, error) {
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	key, err := bccspFactory.GetDefault().KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	return createTestUserCertificate(key, r.validity), key, nil
+}
+
+func createTestUserCertificate(key bccsp.Key, validity time.Duration) []byte {
+	signer := &cryptoSigner.CryptoSigner{}
+	if err := signer.Init(bccspFactory.GetDefault(), key); err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "user1"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(validity)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		panic(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCredentialManager(t *testing.T) {
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "credentialmanager")
+	if err != nil {
+		t.Fatalf("TempDir return error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stateStore, err := kvs.CreateNewFileKeyValueStore(dir)
+	if err != nil {
+		t.Fatalf("CreateNewFileKeyValueStore return error: %v", err)
+	}
+	client := fabric_sdk.NewClient()
+	client.SetCryptoSuite(bccspFactory.GetDefault())
+	client.SetStateStore(stateStore)
+
+	key, _ := bccspFactory.GetDefault().KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	user := fabric_sdk.NewUser("user1")
+	user.SetMspID("Org1MSP")
+	user.SetPrivateKey(key)
+	user.SetEnrollmentCertificate(createTestUserCertificate(key, 48*time.Hour))
+	fetcher := &Services{}
+	user.SetTCertFetcher(fetcher)
+	if err := client.SetUserContext(user, false); err != nil {
+		t.Fatalf("SetUserContext return error: %v", err)
+	}
+
+	reenroller := &mockReenroller{validity: 30 * 24 * time.Hour}
+	cm, err := NewCredentialManager(client, reenroller, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("NewCredentialManager return error: %v", err)
+	}
+	var events []*RenewalEvent
+	cm.RegisterRenewalEvent(func(event *RenewalEvent) {
+		events = append(events, event)
+	})
+
+	if ttl, err := cm.TimeToExpiry(""); err != nil || ttl < 47*time.Hour || ttl > 48*time.Hour {
+		t.Fatalf("TimeToExpiry returned %s %v", ttl, err)
+	}
+	// outside the renewal window
+	if renewed, err := cm.CheckUser("user1"); err != nil || renewed || len(events) != 0 {
+		t.Fatalf("CheckUser should not renew a certificate outside the renewal window")
+	}
+
+	user.SetEnrollmentCertificate(createTestUserCertificate(key, time.Hour))
+	renewed, err := cm.CheckUser("")
+	if err != nil || !renewed {
+		t.Fatalf("CheckUser should renew a certificate within the renewal window: %v", err)
+	}
+	if len(events) != 1 || events[0].UserName != "user1" || events[0].Err != nil ||
+		events[0].NewExpiry.Sub(events[0].OldExpiry) < 29*24*time.Hour {
+		t.Fatalf("CheckUser should emit a renewal event")
+	}
+	renewedUser, _ := client.GetUserContext("")
+	if renewedUser == user || renewedUser.GetMspID() != "Org1MSP" || renewedUser.GetPrivateKey() == key {
+		t.Fatalf("the user context should be replaced by the renewed user")
+	}
+	if renewedUser.GetTCertFetcher() != fetcher {
+		t.Fatalf("the renewed user should keep its TCert fetcher")
+	}
+	data, err := stateStore.GetValue("user1")
+	if err != nil {
+		t.Fatalf("stateStore GetValue return error: %v", err)
+	}
+	var saved fabric_sdk.UserJSON
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Unmarshal return error: %v", err)
+	}
+	if !bytes.Equal(saved.EnrollmentCertificate, renewedUser.GetEnrollmentCertificate()) {
+		t.Fatalf("the renewed user should be saved in the state store")
+	}
+
+	// failures are reported and the user is kept
+	renewedUser.SetEnrollmentCertificate(createTestUserCertificate(renewedUser.GetPrivateKey(), time.Hour))
+	reenroller.err = fmt.Errorf("CA unavailable")
+	if _, err := cm.CheckUser(""); err == nil {
+		t.Fatalf("CheckUser should return the reenrollment error")
+	}
+	if len(events) != 2 || events[1].Err == nil {
+		t.Fatalf("CheckUser should emit an event for a failed renewal")
+	}
+	if current, _ := client.GetUserContext(""); current != renewedUser {
+		t.Fatalf("the user should be kept when the renewal fails")
+	}
+}
+
+func TestCredentialManagerStart(t *testing.T) {
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %v", err)
+	}
+	client := fabric_sdk.NewClient()
+	key, _ := bccspFactory.GetDefault().KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	user := fabric_sdk.NewUser("user1")
+	user.SetPrivateKey(key)
+	user.SetEnrollmentCertificate(createTestUserCertificate(key, time.Hour))
+	client.SetUserContext(user, true)
+
+	cm, err := NewCredentialManager(client, &mockReenroller{validity: 48 * time.Hour}, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("NewCredentialManager return error: %v", err)
+	}
+	cm.SetSkipPersistence(true)
+	renewals := make(chan *RenewalEvent, 1)
+	cm.RegisterRenewalEvent(func(event *RenewalEvent) {
+		renewals <- event
+	})
+	if err := cm.Start(time.Hour, nil); err != nil {
+		t.Fatalf("Start return error: %v", err)
+	}
+	defer cm.Stop()
+	if err := cm.Start(time.Hour, nil); err == nil {
+		t.Fatalf("Start should fail when started")
+	}
+	select {
+	case event := <-renewals:
+		if event.Err != nil {
+			t.Fatalf("renewal failed: %v", event.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the user context should be renewed in the background")
+	}
+}
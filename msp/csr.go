@@ -0,0 +1,188 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msp
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/hyperledger/fabric/bccsp"
+	cryptoSigner "github.com/hyperledger/fabric/bccsp/signer"
+
+	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
+)
+
+// CSRRequest ...
+/**
+ * The CSRRequest holds the content of the certificate signing request
+ * sent at enrollment.
+ */
+type CSRRequest struct {
+	// Subject of the certificate. The common name is always the enrollment ID.
+	Subject pkix.Name
+	// Hosts are the subject alternative names: DNS names, IP addresses
+	// and email addresses
+	Hosts []string
+	// KeyOpts are the options of the key pair generated in the crypto
+	// suite. If nil, an ECDSA P-256 key is generated and stored in the
+	// key store, so that the user can be saved with Client.SetUserContext.
+	KeyOpts bccsp.KeyGenOpts
+}
+
+// EnrollWithCSR ...
+/**
+ * Enroll a registered user with a key pair generated in the crypto suite.
+ * Only the certificate signing request is sent to the CA, so the private
+ * key never leaves the crypto suite and HSM backed key stores can be used.
+ * @param {string} enrollmentID The registered ID to use for enrollment
+ * @param {string} enrollmentSecret The secret associated with the enrollment ID
+ * @param {CSRRequest} request the content of the CSR, nil for the defaults
+ * @returns {[]byte} PEM encoded X509 certificate
+ * @returns {bccsp.Key} the private key in the crypto suite
+ */
+func (msps *Services) EnrollWithCSR(enrollmentID string, enrollmentSecret string, request *CSRRequest) ([]byte, bccsp.Key, error) {
+	if enrollmentID == "" {
+		return nil, nil, fmt.Errorf("enrollmentID is empty")
+	}
+	if enrollmentSecret == "" {
+		return nil, nil, fmt.Errorf("enrollmentSecret is empty")
+	}
+	key, reqBody, err := msps.createSignRequest(enrollmentID, request)
+	if err != nil {
+		return nil, nil, err
+	}
+	post, err := msps.mspClient.NewPost("enroll", reqBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	post.SetBasicAuth(enrollmentID, enrollmentSecret)
+	result, err := msps.mspClient.SendPost(post)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Enroll failed: %s", err)
+	}
+	return msps.checkEnrollmentResponse(result, key)
+}
+
+// ReenrollWithCSR ...
+/**
+ * Reenroll an enrolled user with a new key pair generated in the crypto
+ * suite. The request is signed with the user's current key.
+ * @param {User} user the enrolled user
+ * @param {CSRRequest} request the content of the CSR, nil for the defaults
+ * @returns {[]byte} PEM encoded X509 certificate
+ * @returns {bccsp.Key} the new private key in the crypto suite
+ */
+func (msps *Services) ReenrollWithCSR(user fabric_sdk.User, request *CSRRequest) ([]byte, bccsp.Key, error) {
+	if user == nil {
+		return nil, nil, fmt.Errorf("user is nil")
+	}
+	enrollmentID, err := getEnrollmentID(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, reqBody, err := msps.createSignRequest(enrollmentID, request)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := msps.post(user, "reenroll", reqBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Reenroll failed: %s", err)
+	}
+	return msps.checkEnrollmentResponse(result, key)
+}
+
+// createSignRequest generates a key pair in the crypto suite and returns
+// it with the body of an enroll request for its CSR
+func (msps *Services) createSignRequest(enrollmentID string, request *CSRRequest) (bccsp.Key, []byte, error) {
+	if request == nil {
+		request = &CSRRequest{}
+	}
+	keyOpts := request.KeyOpts
+	if keyOpts == nil {
+		keyOpts = &bccsp.ECDSAP256KeyGenOpts{}
+	}
+	cryptoSuite := msps.getCryptoSuite()
+	key, err := cryptoSuite.KeyGen(keyOpts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("KeyGen return error: %v", err)
+	}
+	csrPEM, err := createCSR(cryptoSuite, key, enrollmentID, request)
+	if err != nil {
+		return nil, nil, err
+	}
+	reqBody, err := json.Marshal(&signer.SignRequest{Hosts: request.Hosts, Request: string(csrPEM)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Marshal json return error: %v", err)
+	}
+	return key, reqBody, nil
+}
+
+// checkEnrollmentResponse returns the certificate of an enrollment
+// response after checking it was issued for key
+func (msps *Services) checkEnrollmentResponse(result interface{}, key bccsp.Key) ([]byte, bccsp.Key, error) {
+	certPEM, err := decodeCertificateResponse(result)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("Certificate returned by the CA is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not parse certificate returned by the CA: %v", err)
+	}
+	if err := checkPublicKey(key, cert); err != nil {
+		return nil, nil, err
+	}
+	return certPEM, key, nil
+}
+
+// createCSR returns a PEM encoded CSR signed with key, which stays in
+// the crypto suite
+func createCSR(cryptoSuite bccsp.BCCSP, key bccsp.Key, enrollmentID string, request *CSRRequest) ([]byte, error) {
+	csrSigner := &cryptoSigner.CryptoSigner{}
+	if err := csrSigner.Init(cryptoSuite, key); err != nil {
+		return nil, fmt.Errorf("Could not create signer: %v", err)
+	}
+	template := &x509.CertificateRequest{Subject: request.Subject}
+	template.Subject.CommonName = enrollmentID
+	for _, host := range request.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if strings.Contains(host, "@") {
+			template.EmailAddresses = append(template.EmailAddresses, host)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, csrSigner)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create CSR: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
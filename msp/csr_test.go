@@ -0,0 +1,117 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+func TestEnrollWithCSR(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error: %v", err)
+	}
+	var lastCSR *x509.CertificateRequest
+	signCSR := func(body []byte) (interface{}, error) {
+		req := &signer.SignRequest{}
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode([]byte(req.Request))
+		if block == nil {
+			return nil, fmt.Errorf("CSR is not PEM encoded")
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if err := csr.CheckSignature(); err != nil {
+			return nil, err
+		}
+		lastCSR = csr
+		template := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: csr.Subject,
+			DNSNames: csr.DNSNames, IPAddresses: csr.IPAddresses, EmailAddresses: csr.EmailAddresses,
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, csr.PublicKey, caKey)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), nil
+	}
+	msps, user, server := setupTestCAServer(t, map[string]interface{}{"enroll": signCSR, "reenroll": signCSR})
+	defer server.Close()
+
+	request := &CSRRequest{Subject: pkix.Name{Organization: []string{"Org1"}, CommonName: "ignored"},
+		Hosts:   []string{"peer0.org1.example.com", "127.0.0.1", "user1@org1.example.com"},
+		KeyOpts: &bccsp.ECDSAP256KeyGenOpts{Temporary: true}}
+	certPEM, key, err := msps.EnrollWithCSR("user1", "secret1", request)
+	if err != nil {
+		t.Fatalf("EnrollWithCSR return error: %v", err)
+	}
+	if !key.Private() {
+		t.Fatalf("EnrollWithCSR should return the private key")
+	}
+	if lastCSR.Subject.CommonName != "user1" || len(lastCSR.Subject.Organization) != 1 {
+		t.Fatalf("CSR has wrong subject: %v", lastCSR.Subject)
+	}
+	if len(lastCSR.DNSNames) != 1 || len(lastCSR.IPAddresses) != 1 || len(lastCSR.EmailAddresses) != 1 {
+		t.Fatalf("CSR has wrong subject alternative names")
+	}
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCertificate return error: %v", err)
+	}
+	if err := checkPublicKey(key, cert); err != nil {
+		t.Fatalf("certificate should be issued for the generated key: %v", err)
+	}
+
+	if _, _, err := msps.EnrollWithCSR("user1", "wrong", request); err == nil {
+		t.Fatalf("EnrollWithCSR should fail for a wrong secret")
+	}
+	if _, _, err := msps.EnrollWithCSR("", "secret1", request); err == nil {
+		t.Fatalf("EnrollWithCSR should fail without enrollment ID")
+	}
+
+	_, newKey, err := msps.ReenrollWithCSR(user, &CSRRequest{KeyOpts: &bccsp.ECDSAP384KeyGenOpts{Temporary: true}})
+	if err != nil {
+		t.Fatalf("ReenrollWithCSR return error: %v", err)
+	}
+	if lastCSR.Subject.CommonName != "admin" || lastCSR.PublicKey.(*ecdsa.PublicKey).Curve != elliptic.P384() {
+		t.Fatalf("reenrollment CSR should be for the user's enrollment ID and the requested key")
+	}
+	if string(newKey.SKI()) == string(user.GetPrivateKey().SKI()) {
+		t.Fatalf("ReenrollWithCSR should generate a new key")
+	}
+}
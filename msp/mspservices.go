@@ -20,10 +20,19 @@ limitations under the License.
 package msp
 
 import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 
+	"github.com/cloudflare/cfssl/signer"
 	"github.com/hyperledger/fabric-ca/api"
 	msp "github.com/hyperledger/fabric-ca/lib"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+
+	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
 
 	"github.com/op/go-logging"
 )
@@ -32,7 +41,8 @@ var logger = logging.MustGetLogger("fabric_sdk_go")
 
 // Services ...
 type Services struct {
-	mspClient *msp.Client
+	mspClient   *msp.Client
+	cryptoSuite bccsp.BCCSP
 }
 
 // NewMSPServices ...
@@ -54,13 +64,73 @@ func NewMSPServices(clientConfigFile string) (*Services, error) {
 	return msps, nil
 }
 
+// SetCryptoSuite ...
+/**
+ * Set the crypto suite holding the private keys of the users the services
+ * act for. The default crypto suite is used if none is set.
+ */
+func (msps *Services) SetCryptoSuite(cryptoSuite bccsp.BCCSP) {
+	msps.cryptoSuite = cryptoSuite
+}
+
+func (msps *Services) getCryptoSuite() bccsp.BCCSP {
+	if msps.cryptoSuite == nil {
+		return bccspFactory.GetDefault()
+	}
+	return msps.cryptoSuite
+}
+
+// RegistrationRequest ...
+/**
+ * The RegistrationRequest holds the identity to register with the CA.
+ */
+type RegistrationRequest struct {
+	// Name is the enrollment ID of the identity
+	Name string
+	// Type of the identity, e.g. "user", "peer" or "app"
+	Type string
+	// Secret is optional, the CA generates one if it is empty
+	Secret string
+	// MaxEnrollments is the number of times the secret can be used to
+	// enroll, 0 for the CA's default
+	MaxEnrollments int
+	// Affiliation of the identity, e.g. "org1.department1"
+	Affiliation string
+	// Attributes of the identity, e.g. hf.Revoker=true
+	Attributes []Attribute
+}
+
+// Attribute ...
+/**
+ * A name/value attribute of a registered identity.
+ */
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+// RevocationRequest ...
+/**
+ * The RevocationRequest selects what to revoke: all certificates of the
+ * identity Name, or the single certificate with Serial and AKI.
+ */
+type RevocationRequest struct {
+	Name   string
+	Serial string
+	AKI    string
+	// Reason is an OCSP reason code, see golang.org/x/crypto/ocsp
+	Reason int
+}
+
 // Enroll ...
 /**
- * Enroll a registered user in order to receive a signed X509 certificate
+ * Enroll a registered user in order to receive a signed X509 certificate.
+ * The key pair is generated outside the crypto suite and the private key is
+ * returned to be imported, use EnrollWithCSR to keep it in the crypto suite.
  * @param {string} enrollmentID The registered ID to use for enrollment
  * @param {string} enrollmentSecret The secret associated with the enrollment ID
- * @returns {[]byte} X509 certificate
- * @returns {[]byte} private key
+ * @returns {[]byte} PEM encoded X509 certificate
+ * @returns {[]byte} PEM encoded private key
  */
 func (msps *Services) Enroll(enrollmentID string, enrollmentSecret string) ([]byte, []byte, error) {
 	if enrollmentID == "" {
@@ -77,5 +147,158 @@ func (msps *Services) Enroll(enrollmentID string, enrollmentSecret string) ([]by
 	if err != nil {
 		return nil, nil, fmt.Errorf("Enroll failed: %s", err)
 	}
-	return id.GetECert().Key(), id.GetECert().Cert(), nil
+	return id.GetECert().Cert(), id.GetECert().Key(), nil
+}
+
+// Register ...
+/**
+ * Register an identity with the CA.
+ * @param {User} registrar an enrolled user allowed to register identities
+ * of the request's type and affiliation
+ * @param {RegistrationRequest} request the identity to register
+ * @returns {string} the enrollment secret of the identity
+ */
+func (msps *Services) Register(registrar fabric_sdk.User, request *RegistrationRequest) (string, error) {
+	if registrar == nil {
+		return "", fmt.Errorf("registrar is nil")
+	}
+	if request == nil {
+		return "", fmt.Errorf("request is nil")
+	}
+	if request.Name == "" {
+		return "", fmt.Errorf("request name is empty")
+	}
+	if request.Affiliation == "" {
+		return "", fmt.Errorf("request affiliation is empty")
+	}
+	req := &api.RegistrationRequest{Name: request.Name, Type: request.Type, Secret: request.Secret,
+		MaxEnrollments: request.MaxEnrollments, Affiliation: request.Affiliation}
+	for _, attr := range request.Attributes {
+		req.Attributes = append(req.Attributes, api.Attribute{Name: attr.Name, Value: attr.Value})
+	}
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("Marshal json return error: %v", err)
+	}
+	result, err := msps.post(registrar, "register", reqBody)
+	if err != nil {
+		return "", fmt.Errorf("Register failed: %s", err)
+	}
+	switch result := result.(type) {
+	case string:
+		return result, nil
+	case map[string]interface{}:
+		if secret, ok := result["credential"].(string); ok {
+			return secret, nil
+		}
+	}
+	return "", fmt.Errorf("Register returned an invalid response: %v", result)
+}
+
+// Reenroll ...
+/**
+ * Reenroll an enrolled user to get a new certificate, e.g. before its
+ * certificate expires. The request is signed with the user's current key.
+ * Like Enroll, the new private key is returned to be imported, use
+ * ReenrollWithCSR to keep it in the crypto suite.
+ * @param {User} user the enrolled user
+ * @returns {[]byte} PEM encoded X509 certificate
+ * @returns {[]byte} PEM encoded private key
+ */
+func (msps *Services) Reenroll(user fabric_sdk.User) ([]byte, []byte, error) {
+	if user == nil {
+		return nil, nil, fmt.Errorf("user is nil")
+	}
+	enrollmentID, err := getEnrollmentID(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	csrPEM, key, err := msps.mspClient.GenCSR(nil, enrollmentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GenCSR return error: %s", err)
+	}
+	reqBody, err := json.Marshal(&signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Marshal json return error: %v", err)
+	}
+	result, err := msps.post(user, "reenroll", reqBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Reenroll failed: %s", err)
+	}
+	cert, err := decodeCertificateResponse(result)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// Revoke ...
+/**
+ * Revoke an identity or a certificate.
+ * @param {User} registrar an enrolled user with the hf.Revoker attribute
+ * @param {RevocationRequest} request what to revoke
+ */
+func (msps *Services) Revoke(registrar fabric_sdk.User, request *RevocationRequest) error {
+	if registrar == nil {
+		return fmt.Errorf("registrar is nil")
+	}
+	if request == nil {
+		return fmt.Errorf("request is nil")
+	}
+	if request.Name == "" && (request.Serial == "" || request.AKI == "") {
+		return fmt.Errorf("request needs a name, or a serial and an AKI")
+	}
+	reqBody, err := json.Marshal(&api.RevocationRequest{Name: request.Name, Serial: request.Serial,
+		AKI: request.AKI, Reason: request.Reason})
+	if err != nil {
+		return fmt.Errorf("Marshal json return error: %v", err)
+	}
+	if _, err := msps.post(registrar, "revoke", reqBody); err != nil {
+		return fmt.Errorf("Revoke failed: %s", err)
+	}
+	return nil
+}
+
+// RevokeSelf ...
+/**
+ * Revoke the identity of an enrolled user and all its certificates.
+ * @param {User} user the enrolled user
+ */
+func (msps *Services) RevokeSelf(user fabric_sdk.User) error {
+	if user == nil {
+		return fmt.Errorf("user is nil")
+	}
+	enrollmentID, err := getEnrollmentID(user)
+	if err != nil {
+		return err
+	}
+	return msps.Revoke(user, &RevocationRequest{Name: enrollmentID})
+}
+
+// getEnrollmentID returns the enrollment ID of user, which is the
+// common name of its enrollment certificate
+func getEnrollmentID(user fabric_sdk.User) (string, error) {
+	block, _ := pem.Decode(user.GetEnrollmentCertificate())
+	if block == nil {
+		return "", fmt.Errorf("User %s has no PEM encoded enrollment certificate", user.GetName())
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse enrollment certificate: %v", err)
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// decodeCertificateResponse returns the PEM certificate of an
+// enroll or reenroll response, which is base64 encoded
+func decodeCertificateResponse(result interface{}) ([]byte, error) {
+	encoded, ok := result.(string)
+	if !ok {
+		return nil, fmt.Errorf("Invalid response format from server: %v", result)
+	}
+	cert, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid response format from server: %s", err)
+	}
+	return cert, nil
 }
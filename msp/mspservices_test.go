@@ -20,7 +20,29 @@ limitations under the License.
 package msp
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path"
 	"testing"
+	"time"
+
+	cfsslapi "github.com/cloudflare/cfssl/api"
+	"github.com/hyperledger/fabric-ca/util"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+
+	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
 )
 
 func TestEnrollWithMissingParameters(t *testing.T) {
@@ -43,3 +65,121 @@ func TestEnrollWithMissingParameters(t *testing.T) {
 		t.Fatalf("Enroll didn't return right error")
 	}
 }
+
+func TestRegisterAndRevoke(t *testing.T) {
+	msps, registrar, server := setupTestCAServer(t, map[string]interface{}{
+		"register": map[string]interface{}{"credential": "secret1"},
+		"revoke":   nil,
+	})
+	defer server.Close()
+
+	secret, err := msps.Register(registrar, &RegistrationRequest{Name: "user2", Type: "user",
+		Affiliation: "org1.department1", MaxEnrollments: 2, Attributes: []Attribute{{Name: "role", Value: "client"}}})
+	if err != nil {
+		t.Fatalf("Register return error: %v", err)
+	}
+	if secret != "secret1" {
+		t.Fatalf("Register returned wrong secret %s", secret)
+	}
+	if err := msps.Revoke(registrar, &RevocationRequest{Name: "user2"}); err != nil {
+		t.Fatalf("Revoke return error: %v", err)
+	}
+	if err := msps.RevokeSelf(registrar); err != nil {
+		t.Fatalf("RevokeSelf return error: %v", err)
+	}
+
+	if _, err := msps.Register(registrar, &RegistrationRequest{Name: "user2"}); err == nil {
+		t.Fatalf("Register should fail without affiliation")
+	}
+	if _, err := msps.Register(nil, &RegistrationRequest{Name: "user2", Affiliation: "org1"}); err == nil {
+		t.Fatalf("Register should fail without registrar")
+	}
+	if err := msps.Revoke(registrar, &RevocationRequest{Serial: "1"}); err == nil {
+		t.Fatalf("Revoke should fail without name or AKI")
+	}
+	if err := msps.RevokeSelf(fabric_sdk.NewUser("notEnrolled")); err == nil {
+		t.Fatalf("RevokeSelf should fail for a user that isn't enrolled")
+	}
+}
+
+func TestReenroll(t *testing.T) {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("new cert")})
+	msps, user, server := setupTestCAServer(t, map[string]interface{}{
+		"reenroll": base64.StdEncoding.EncodeToString(certPEM),
+	})
+	defer server.Close()
+	cert, key, err := msps.Reenroll(user)
+	if err != nil {
+		t.Fatalf("Reenroll return error: %v", err)
+	}
+	if !bytes.Equal(cert, certPEM) {
+		t.Fatalf("Reenroll returned wrong certificate")
+	}
+	if block, _ := pem.Decode(key); block == nil {
+		t.Fatalf("Reenroll should return a PEM encoded private key")
+	}
+}
+
+// setupTestCAServer starts a CA that returns results by endpoint after
+// verifying the authorization token, or the enrollment secret of user1,
+// and returns an enrolled user
+func setupTestCAServer(t *testing.T, results map[string]interface{}) (*Services, fabric_sdk.User, *httptest.Server) {
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %v", err)
+	}
+	cryptoSuite := bccspFactory.GetDefault()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if name, secret, ok := r.BasicAuth(); ok {
+			if name != "user1" || secret != "secret1" {
+				cfsslapi.HandleError(w, fmt.Errorf("wrong enrollment secret"))
+				return
+			}
+		} else if _, err := util.VerifyToken(cryptoSuite, r.Header.Get("authorization"), body); err != nil {
+			cfsslapi.HandleError(w, err)
+			return
+		}
+		result, ok := results[path.Base(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// results can be computed from the request body
+		if handler, ok := result.(func([]byte) (interface{}, error)); ok {
+			var err error
+			if result, err = handler(body); err != nil {
+				cfsslapi.HandleError(w, err)
+				return
+			}
+		}
+		cfsslapi.SendResponse(w, result)
+	}))
+	msps, err := NewMSPServices("/test.json")
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewMSPServices return error: %v", err)
+	}
+	msps.SetCryptoSuite(cryptoSuite)
+	msps.mspClient.Config.URL = server.URL
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error: %v", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "admin"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	bccspKey, err := cryptoSuite.KeyImport(keyDER, &bccsp.ECDSAPrivateKeyImportOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyImport return error: %v", err)
+	}
+	user := fabric_sdk.NewUser("admin")
+	user.SetEnrollmentCertificate(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	user.SetPrivateKey(bccspKey)
+	return msps, user, server
+}
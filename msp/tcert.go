@@ -0,0 +1,188 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hyperledger/fabric-ca/api"
+	"github.com/hyperledger/fabric-ca/lib/tcert"
+	"github.com/hyperledger/fabric-ca/util"
+	"github.com/hyperledger/fabric/bccsp"
+
+	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
+)
+
+// GetTCertBatch ...
+/**
+ * Get a batch of TCerts for an enrolled user, implementing fabric_sdk.TCertFetcher.
+ * The private key of each TCert is derived from the user's private key with the
+ * key derivation data returned by the CA, so it never leaves the crypto suite.
+ * @param {User} user the enrolled user, the request is signed with its private key
+ * @param {int} count the number of TCerts in the batch
+ * @param {[]string} attributes names of the user's attributes to include in the TCerts
+ */
+func (msps *Services) GetTCertBatch(user fabric_sdk.User, count int, attributes []string) ([]*fabric_sdk.TCert, error) {
+	if user == nil {
+		return nil, fmt.Errorf("user is nil")
+	}
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	reqBody, err := json.Marshal(&api.GetTCertBatchRequest{Count: count, AttrNames: attributes})
+	if err != nil {
+		return nil, fmt.Errorf("Marshal json return error: %v", err)
+	}
+	result, err := msps.post(user, "tcert", reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("GetTCertBatch failed: %s", err)
+	}
+	// the result is the decoded JSON of the batch response
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("Marshal json return error: %v", err)
+	}
+	resp := &tcert.GetBatchResponse{}
+	if err := json.Unmarshal(resultBytes, resp); err != nil {
+		return nil, fmt.Errorf("Unmarshal json return error: %v", err)
+	}
+	return msps.deriveTCerts(user, resp)
+}
+
+// deriveTCerts derives the private keys of the TCerts of a batch response.
+// The CA computes each TCert public key as the user's public key plus k*G,
+// with k the HMAC of the TCert index, which is encrypted in the TCert.
+func (msps *Services) deriveTCerts(user fabric_sdk.User, resp *tcert.GetBatchResponse) ([]*fabric_sdk.TCert, error) {
+	if user.GetPrivateKey() == nil {
+		return nil, fmt.Errorf("User %s has no private key", user.GetName())
+	}
+	cryptoSuite := msps.getCryptoSuite()
+
+	mac := hmac.New(sha512.New384, resp.Key)
+	mac.Write([]byte{1})
+	indexKey := mac.Sum(nil)[:32]
+	mac = hmac.New(sha512.New384, resp.Key)
+	mac.Write([]byte{2})
+	expansionKey := mac.Sum(nil)
+
+	var tcerts []*fabric_sdk.TCert
+	for _, t := range resp.TCerts {
+		block, _ := pem.Decode(t.Cert)
+		if block == nil {
+			return nil, fmt.Errorf("TCert is not PEM encoded")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse TCert: %v", err)
+		}
+		var encryptedIndex []byte
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(tcert.TCertEncTCertIndex) {
+				encryptedIndex = ext.Value
+			}
+		}
+		if encryptedIndex == nil {
+			return nil, fmt.Errorf("TCert has no TCert index")
+		}
+		index, err := tcert.CBCPKCS7Decrypt(indexKey, encryptedIndex)
+		if err != nil {
+			return nil, fmt.Errorf("Could not decrypt TCert index: %v", err)
+		}
+
+		mac := hmac.New(sha512.New384, expansionKey)
+		mac.Write(index)
+		key, err := cryptoSuite.KeyDeriv(user.GetPrivateKey(),
+			&bccsp.ECDSAReRandKeyOpts{Temporary: true, Expansion: mac.Sum(nil)})
+		if err != nil {
+			return nil, fmt.Errorf("KeyDeriv return error: %v", err)
+		}
+		if err := checkPublicKey(key, cert); err != nil {
+			return nil, err
+		}
+		tcerts = append(tcerts, &fabric_sdk.TCert{Certificate: t.Cert, PrivateKey: key})
+	}
+	return tcerts, nil
+}
+
+// checkPublicKey checks that key is the private key of the certificate
+func checkPublicKey(key bccsp.Key, cert *x509.Certificate) error {
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return fmt.Errorf("Could not get public key: %v", err)
+	}
+	keyBytes, err := publicKey.Bytes()
+	if err != nil {
+		return fmt.Errorf("Could not marshal public key: %v", err)
+	}
+	certKeyBytes, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return fmt.Errorf("Could not marshal certificate public key: %v", err)
+	}
+	if !bytes.Equal(keyBytes, certKeyBytes) {
+		return fmt.Errorf("Derived key doesn't match the TCert public key")
+	}
+	return nil
+}
+
+// post sends a request to the CA, authorized with a token signed
+// by the user's private key
+func (msps *Services) post(user fabric_sdk.User, endpoint string, body []byte) (interface{}, error) {
+	req, err := msps.mspClient.NewPost(endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	token, err := msps.createToken(user, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("authorization", token)
+	return msps.mspClient.SendPost(req)
+}
+
+// createToken creates the CA's authorization token for body: the user's
+// certificate and the signature of the body and certificate
+func (msps *Services) createToken(user fabric_sdk.User, body []byte) (string, error) {
+	cert := user.GetEnrollmentCertificate()
+	if len(cert) == 0 || (user.GetPrivateKey() == nil && user.GetSigner() == nil) {
+		return "", fmt.Errorf("User %s is not enrolled", user.GetName())
+	}
+	cryptoSuite := msps.getCryptoSuite()
+	b64cert := util.B64Encode(cert)
+	digest, err := cryptoSuite.Hash([]byte(util.B64Encode(body)+"."+b64cert), &bccsp.SHAOpts{})
+	if err != nil {
+		return "", fmt.Errorf("Hash return error: %v", err)
+	}
+	var signature []byte
+	if signer := user.GetSigner(); signer != nil {
+		signature, err = signer.Sign(digest)
+	} else {
+		signature, err = cryptoSuite.Sign(user.GetPrivateKey(), digest, nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Sign return error: %v", err)
+	}
+	return b64cert + "." + util.B64Encode(signature), nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/tcert"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+
+	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
+)
+
+func TestDeriveTCerts(t *testing.T) {
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %v", err)
+	}
+	cryptoSuite := bccspFactory.GetDefault()
+	msps, err := NewMSPServices("/test.json")
+	if err != nil {
+		t.Fatalf("NewMSPServices return error: %v", err)
+	}
+	msps.SetCryptoSuite(cryptoSuite)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error: %v", err)
+	}
+	caTemplate := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ca"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	// enroll a user whose key is in the crypto suite
+	userKey, err := cryptoSuite.KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error: %v", err)
+	}
+	publicKey, _ := userKey.PublicKey()
+	publicKeyBytes, _ := publicKey.Bytes()
+	userPublicKey, err := x509.ParsePKIXPublicKey(publicKeyBytes)
+	if err != nil {
+		t.Fatalf("ParsePKIXPublicKey return error: %v", err)
+	}
+	ecertTemplate := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "user1"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	ecertDER, err := x509.CreateCertificate(rand.Reader, ecertTemplate, caCert, userPublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error: %v", err)
+	}
+	ecert, _ := x509.ParseCertificate(ecertDER)
+	user := fabric_sdk.NewUser("user1")
+	user.SetEnrollmentCertificate(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ecertDER}))
+	user.SetPrivateKey(userKey)
+
+	// the batch the CA would return
+	mgr, err := tcert.NewMgr(caKey, caCert)
+	if err != nil {
+		t.Fatalf("NewMgr return error: %v", err)
+	}
+	resp, err := mgr.GetBatch(&tcert.GetBatchRequest{Count: 3, PreKey: "prekey"}, ecert)
+	if err != nil {
+		t.Fatalf("GetBatch return error: %v", err)
+	}
+
+	tcerts, err := msps.deriveTCerts(user, resp)
+	if err != nil {
+		t.Fatalf("deriveTCerts return error: %v", err)
+	}
+	if len(tcerts) != 3 {
+		t.Fatalf("deriveTCerts returned %d TCerts instead of 3", len(tcerts))
+	}
+	for _, tc := range tcerts {
+		digest, _ := cryptoSuite.Hash([]byte("test"), &bccsp.SHAOpts{})
+		signature, err := cryptoSuite.Sign(tc.PrivateKey, digest, nil)
+		if err != nil {
+			t.Fatalf("Sign return error: %v", err)
+		}
+		block, _ := pem.Decode(tc.Certificate)
+		cert, _ := x509.ParseCertificate(block.Bytes)
+		certKey, err := cryptoSuite.KeyImport(cert, &bccsp.X509PublicKeyImportOpts{Temporary: true})
+		if err != nil {
+			t.Fatalf("KeyImport return error: %v", err)
+		}
+		if valid, err := cryptoSuite.Verify(certKey, signature, digest, nil); err != nil || !valid {
+			t.Fatalf("TCert key should sign for the TCert public key")
+		}
+	}
+
+	// the batch of another user's key can't be used
+	otherKey, _ := cryptoSuite.KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	user.SetPrivateKey(otherKey)
+	if _, err := msps.deriveTCerts(user, resp); err == nil {
+		t.Fatalf("deriveTCerts should fail for another user's key")
+	}
+}
+
+func TestGetTCertBatchWithMissingParameters(t *testing.T) {
+	msps, err := NewMSPServices("/test.json")
+	if err != nil {
+		t.Fatalf("NewMSPServices return error: %v", err)
+	}
+	if _, err := msps.GetTCertBatch(nil, 1, nil); err == nil {
+		t.Fatalf("GetTCertBatch should fail without user")
+	}
+	if _, err := msps.GetTCertBatch(fabric_sdk.NewUser("user1"), 0, nil); err == nil {
+		t.Fatalf("GetTCertBatch should fail for a count of 0")
+	}
+	if _, err := msps.GetTCertBatch(fabric_sdk.NewUser("user1"), 1, nil); err == nil {
+		t.Fatalf("GetTCertBatch should fail for a user that isn't enrolled")
+	}
+}
@@ -20,7 +20,6 @@ limitations under the License.
 package fabricsdk
 
 import (
-	"fmt"
 	"io"
 	"strings"
 	"time"
@@ -77,6 +76,7 @@ func (o *orderer) GetURL() string {
 // SendBroadcast ...
 /**
  * Send the created transaction to Orderer.
+ * A BroadcastError is returned if the orderer doesn't accept it.
  */
 func (o *orderer) SendBroadcast(envelope *common.Envelope) error {
 	conn, err := grpc.Dial(o.url, o.grpcDialOption...)
@@ -87,7 +87,7 @@ func (o *orderer) SendBroadcast(envelope *common.Envelope) error {
 
 	broadcastStream, err := ab.NewAtomicBroadcastClient(conn).Broadcast(context.Background())
 	if err != nil {
-		return fmt.Errorf("Error Create NewAtomicBroadcastClient %v", err)
+		return grpcErrorf(err, "Error Create NewAtomicBroadcastClient %v", err)
 	}
 	done := make(chan bool)
 	var broadcastErr error
@@ -100,18 +100,24 @@ func (o *orderer) SendBroadcast(envelope *common.Envelope) error {
 					done <- true
 					return
 				}
-				broadcastErr = fmt.Errorf("Error broadcast respone : %v\n", err)
+				broadcastErr = grpcErrorf(err, "Error broadcast respone : %v\n", err)
 				continue
 			}
 			if broadcastResponse.Status != common.Status_SUCCESS {
-				broadcastErr = fmt.Errorf("broadcast respone is not success : %v\n", broadcastResponse.Status)
+				broadcastErr = &BroadcastError{Status: broadcastResponse.Status}
 			}
 		}
 	}()
 	if err := broadcastStream.Send(envelope); err != nil {
-		return fmt.Errorf("Failed to send a envelope to orderer: %v", err)
+		return grpcErrorf(err, "Failed to send a envelope to orderer: %v", err)
 	}
 	broadcastStream.CloseSend()
 	<-done
 	return broadcastErr
 }
+
+// grpcErrorf formats an error with the gRPC code of cause, so that retry
+// policies can tell transient errors
+func grpcErrorf(cause error, format string, args ...interface{}) error {
+	return grpc.Errorf(grpc.Code(cause), format, args...)
+}
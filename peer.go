@@ -58,6 +58,8 @@ type Peer interface {
 	SetRoles(roles []string)
 	GetEnrollmentCertificate() *pem.Block
 	SetEnrollmentCertificate(pem *pem.Block)
+	GetMspID() string
+	SetMspID(mspID string)
 	GetURL() string
 	SendProposal(signedProposal *pb.SignedProposal) (*pb.ProposalResponse, error)
 }
@@ -68,6 +70,7 @@ type peer struct {
 	name                  string
 	roles                 []string
 	enrollmentCertificate *pem.Block
+	mspID                 string
 }
 
 // CreateNewPeer ...
@@ -205,6 +208,25 @@ func (p *peer) SetEnrollmentCertificate(pem *pem.Block) {
 	p.enrollmentCertificate = pem
 }
 
+// GetMspID ...
+/**
+ * Get the ID of the MSP of the Peer's organization, which endorsement
+ * policies refer to.
+ * @returns {string} The MSP ID of the Peer, empty if unknown
+ */
+func (p *peer) GetMspID() string {
+	return p.mspID
+}
+
+// SetMspID ...
+/**
+ * Set the ID of the MSP of the Peer's organization.
+ * @param {string} mspID The MSP ID.
+ */
+func (p *peer) SetMspID(mspID string) {
+	p.mspID = mspID
+}
+
 // GetURL ...
 /**
  * Get the Peer url. Required property for the instance objects.
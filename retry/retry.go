@@ -0,0 +1,196 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/op/go-logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	config "github.com/hyperledger/fabric-sdk-go/config"
+)
+
+var logger = logging.MustGetLogger("fabric_sdk_go")
+
+const (
+	// DefaultAttempts is the number of attempts of the default policy
+	DefaultAttempts = 3
+	// DefaultInitialBackoff is the wait before the first retry
+	DefaultInitialBackoff = 250 * time.Millisecond
+	// DefaultMaxBackoff is the longest wait between retries
+	DefaultMaxBackoff = 5 * time.Second
+	// DefaultBackoffFactor is the factor the wait grows by after each retry
+	DefaultBackoffFactor = 2.0
+	// DefaultJitter is the fraction of the wait that is randomized
+	DefaultJitter = 0.2
+)
+
+// DefaultRetryableCodes are the gRPC codes of transient failures, e.g. a
+// peer restarting. Other errors, such as chaincode errors, aren't retried.
+var DefaultRetryableCodes = []codes.Code{codes.Unavailable, codes.ResourceExhausted}
+
+// Policy ...
+/**
+ * The Policy decides whether and when failed network calls are retried.
+ * Calls are attempted up to MaxAttempts times. The wait before a retry
+ * starts at InitialBackoff and grows by BackoffFactor up to MaxBackoff,
+ * randomized by +/- Jitter of its length.
+ */
+type Policy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	BackoffFactor  float64
+	Jitter         float64
+	// RetryableCodes are the gRPC codes of the errors that are retried
+	RetryableCodes []codes.Code
+}
+
+// DefaultPolicy ...
+/**
+ * Returns a Policy with the default settings.
+ */
+func DefaultPolicy() *Policy {
+	return &Policy{MaxAttempts: DefaultAttempts, InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff: DefaultMaxBackoff, BackoffFactor: DefaultBackoffFactor, Jitter: DefaultJitter,
+		RetryableCodes: DefaultRetryableCodes}
+}
+
+// NoRetry ...
+/**
+ * Returns a Policy that attempts calls once.
+ */
+func NoRetry() *Policy {
+	policy := DefaultPolicy()
+	policy.MaxAttempts = 1
+	return policy
+}
+
+// PolicyFromConfig ...
+/**
+ * Returns the Policy of the client.retry config, the settings that aren't
+ * configured are the defaults.
+ */
+func PolicyFromConfig() *Policy {
+	policy := DefaultPolicy()
+	if attempts := config.GetRetryAttempts(); attempts > 0 {
+		policy.MaxAttempts = attempts
+	}
+	if backoff := config.GetRetryInitialBackoff(); backoff > 0 {
+		policy.InitialBackoff = backoff
+	}
+	if backoff := config.GetRetryMaxBackoff(); backoff > 0 {
+		policy.MaxBackoff = backoff
+	}
+	if factor := config.GetRetryBackoffFactor(); factor >= 1 {
+		policy.BackoffFactor = factor
+	}
+	if jitter := config.GetRetryJitter(); jitter > 0 && jitter <= 1 {
+		policy.Jitter = jitter
+	}
+	return policy
+}
+
+// WithAttempts ...
+/**
+ * Returns a copy of the policy with another number of attempts.
+ */
+func (p *Policy) WithAttempts(attempts int) *Policy {
+	policy := *p
+	policy.MaxAttempts = attempts
+	return &policy
+}
+
+// IsRetryable ...
+/**
+ * Returns true if err has one of the retryable gRPC codes.
+ */
+func (p *Policy) IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := grpc.Code(err)
+	for _, retryable := range p.RetryableCodes {
+		if code == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff ...
+/**
+ * Returns the wait before the given retry, 1 for the first one.
+ */
+func (p *Policy) Backoff(retry int) time.Duration {
+	if retry < 1 || p.InitialBackoff <= 0 {
+		return 0
+	}
+	factor := p.BackoffFactor
+	if factor < 1 {
+		factor = 1
+	}
+	backoff := float64(p.InitialBackoff) * math.Pow(factor, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+// Do ...
+/**
+ * Call op until it succeeds, fails with an error that isn't retryable,
+ * or the attempts are exhausted.
+ * @returns {int} the number of attempts
+ * @returns {error} the error of the last attempt
+ */
+func (p *Policy) Do(op func() error) (int, error) {
+	return p.DoWith(op, p.IsRetryable)
+}
+
+// DoWith ...
+/**
+ * Call op as Do, retrying the errors for which isRetryable is true.
+ */
+func (p *Policy) DoWith(op func() error, isRetryable func(error) bool) (int, error) {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = op(); err == nil {
+			return attempt, nil
+		}
+		if attempt >= maxAttempts || !isRetryable(err) {
+			return attempt, err
+		}
+		backoff := p.Backoff(attempt)
+		logger.Debugf("Attempt %d failed, retrying in %s: %v", attempt, backoff, err)
+		time.Sleep(backoff)
+	}
+}
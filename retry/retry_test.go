@@ -0,0 +1,105 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	config "github.com/hyperledger/fabric-sdk-go/config"
+)
+
+func TestDo(t *testing.T) {
+	policy := &Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, BackoffFactor: 2,
+		RetryableCodes: DefaultRetryableCodes}
+
+	calls := 0
+	attempts, err := policy.Do(func() error {
+		calls++
+		if calls < 3 {
+			return grpc.Errorf(codes.Unavailable, "peer is restarting")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("Do should succeed on the third attempt, got %d attempts: %v", attempts, err)
+	}
+
+	calls = 0
+	attempts, err = policy.Do(func() error {
+		calls++
+		return grpc.Errorf(codes.Unavailable, "peer is down")
+	})
+	if err == nil || attempts != 3 || calls != 3 {
+		t.Fatalf("Do should give up after 3 attempts, got %d attempts: %v", attempts, err)
+	}
+
+	// other errors aren't retried
+	for _, opErr := range []error{grpc.Errorf(codes.Unknown, "chaincode error"), fmt.Errorf("invalid request")} {
+		attempts, err = policy.Do(func() error { return opErr })
+		if err != opErr || attempts != 1 {
+			t.Fatalf("Do shouldn't retry %v, got %d attempts", opErr, attempts)
+		}
+	}
+
+	if attempts, _ := NoRetry().Do(func() error { return grpc.Errorf(codes.Unavailable, "down") }); attempts != 1 {
+		t.Fatalf("NoRetry should attempt once, got %d attempts", attempts)
+	}
+	if policy.WithAttempts(5).MaxAttempts != 5 || policy.MaxAttempts != 3 {
+		t.Fatalf("WithAttempts should return a copy with the attempts")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := &Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, BackoffFactor: 2}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second}
+	for i, backoff := range expected {
+		if actual := policy.Backoff(i + 1); actual != backoff {
+			t.Fatalf("Backoff of retry %d should be %s, got %s", i+1, backoff, actual)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if backoff := policy.Backoff(2); backoff < 100*time.Millisecond || backoff > 300*time.Millisecond {
+			t.Fatalf("Backoff with jitter should be within 50%% of 200ms, got %s", backoff)
+		}
+	}
+}
+
+func TestPolicyFromConfig(t *testing.T) {
+	if policy := PolicyFromConfig(); policy.MaxAttempts != DefaultAttempts || policy.InitialBackoff != DefaultInitialBackoff {
+		t.Fatalf("Policy should have the defaults without config, got %+v", policy)
+	}
+	viper := config.GetFabricClientViper()
+	viper.Set("client.retry.attempts", 5)
+	viper.Set("client.retry.initialBackoff", "1s")
+	defer viper.Set("client.retry.attempts", nil)
+	defer viper.Set("client.retry.initialBackoff", nil)
+	policy := PolicyFromConfig()
+	if policy.MaxAttempts != 5 || policy.InitialBackoff != time.Second || policy.MaxBackoff != DefaultMaxBackoff {
+		t.Fatalf("Policy should have the configured settings, got %+v", policy)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/bccsp"
+	msp "github.com/hyperledger/fabric/msp"
+
+	config "github.com/hyperledger/fabric-sdk-go/config"
+)
+
+// ecdsaSignature is the ASN.1 encoding of ECDSA signatures
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// getHashOpts returns the hash that signed objects are hashed with, from
+// the client.security hash algorithm (SHA2 or SHA3) and level (256 or 384).
+// It defaults to SHA2 and 256.
+func getHashOpts() (bccsp.HashOpts, crypto.Hash, error) {
+	family := strings.ToUpper(config.GetSecurityAlgorithm())
+	level := config.GetSecurityLevel()
+	if family == "" {
+		family = "SHA2"
+	}
+	if level == 0 {
+		level = 256
+	}
+	switch {
+	case family == "SHA2" && level == 256:
+		return &bccsp.SHA256Opts{}, crypto.SHA256, nil
+	case family == "SHA2" && level == 384:
+		return &bccsp.SHA384Opts{}, crypto.SHA384, nil
+	case family == "SHA3" && level == 256:
+		return &bccsp.SHA3_256Opts{}, crypto.SHA3_256, nil
+	case family == "SHA3" && level == 384:
+		return &bccsp.SHA3_384Opts{}, crypto.SHA3_384, nil
+	}
+	return nil, 0, fmt.Errorf("Unsupported hash algorithm %s at security level %d", family, level)
+}
+
+// getSignerOpts returns the options to sign a digest with key: RSA keys
+// sign with PSS and the configured hash, ECDSA keys need no options
+func getSignerOpts(key bccsp.Key) (bccsp.SignerOpts, error) {
+	if _, ok := getPublicKey(key).(*rsa.PublicKey); !ok {
+		return nil, nil
+	}
+	_, hash, err := getHashOpts()
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}, nil
+}
+
+// getPublicKey returns the public key of a bccsp key, nil if unknown
+func getPublicKey(key bccsp.Key) crypto.PublicKey {
+	if key == nil {
+		return nil
+	}
+	if !key.Private() {
+		return parsePublicKey(key)
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return nil
+	}
+	return parsePublicKey(publicKey)
+}
+
+func parsePublicKey(key bccsp.Key) crypto.PublicKey {
+	raw, err := key.Bytes()
+	if err != nil {
+		return nil
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(raw)
+	if err != nil {
+		return nil
+	}
+	return publicKey
+}
+
+// getIdentityPublicKey returns the public key of the certificate of a
+// serialized identity, nil if the identity has no certificate
+func getIdentityPublicKey(identity []byte) crypto.PublicKey {
+	serializedIdentity := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(identity, serializedIdentity); err != nil {
+		return nil
+	}
+	block, _ := pem.Decode(serializedIdentity.IdBytes)
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return cert.PublicKey
+}
+
+// toLowS returns the canonical low-S form of an ECDSA signature of the
+// given identity, which peers require. Other signatures are returned as is.
+func toLowS(identity []byte, signature []byte) ([]byte, error) {
+	publicKey, ok := getIdentityPublicKey(identity).(*ecdsa.PublicKey)
+	if !ok {
+		return signature, nil
+	}
+	return ecdsaToLowS(publicKey.Curve, signature)
+}
+
+func ecdsaToLowS(curve elliptic.Curve, signature []byte) ([]byte, error) {
+	sig := &ecdsaSignature{}
+	if _, err := asn1.Unmarshal(signature, sig); err != nil {
+		return nil, fmt.Errorf("Invalid ECDSA signature: %v", err)
+	}
+	if sig.R == nil || sig.S == nil || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 {
+		return nil, fmt.Errorf("Invalid ECDSA signature: R and S must be positive")
+	}
+	order := curve.Params().N
+	halfOrder := new(big.Int).Rsh(order, 1)
+	if sig.S.Cmp(halfOrder) <= 0 {
+		return signature, nil
+	}
+	sig.S = new(big.Int).Sub(order, sig.S)
+	return asn1.Marshal(*sig)
+}
@@ -0,0 +1,146 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+
+	config "github.com/hyperledger/fabric-sdk-go/config"
+)
+
+func TestGetHashOpts(t *testing.T) {
+	viper := config.GetFabricClientViper()
+	defer viper.Set("client.security.hashAlgorithm", nil)
+	defer viper.Set("client.security.level", nil)
+
+	hashOpts, hash, err := getHashOpts()
+	if err != nil || hash != crypto.SHA256 {
+		t.Fatalf("Hash should default to SHA2 256, got %v: %v", hash, err)
+	}
+	if _, ok := hashOpts.(*bccsp.SHA256Opts); !ok {
+		t.Fatalf("Hash options should be SHA256Opts, got %T", hashOpts)
+	}
+	viper.Set("client.security.hashAlgorithm", "SHA3")
+	viper.Set("client.security.level", 384)
+	hashOpts, hash, err = getHashOpts()
+	if err != nil || hash != crypto.SHA3_384 {
+		t.Fatalf("Hash should be SHA3 384, got %v: %v", hash, err)
+	}
+	if _, ok := hashOpts.(*bccsp.SHA3_384Opts); !ok {
+		t.Fatalf("Hash options should be SHA3_384Opts, got %T", hashOpts)
+	}
+	viper.Set("client.security.level", 512)
+	if _, _, err := getHashOpts(); err == nil {
+		t.Fatalf("getHashOpts should fail for an unsupported level")
+	}
+}
+
+func TestToLowS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error: %s", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "user1"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error: %s", err)
+	}
+	user := NewUser("user1")
+	identity, err := serializeIdentity(user, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
+	if err != nil {
+		t.Fatalf("serializeIdentity return error: %s", err)
+	}
+
+	// the high-S form of a signature is valid, but not canonical
+	digest := sha256.Sum256([]byte("test"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Sign return error: %s", err)
+	}
+	order := elliptic.P256().Params().N
+	if s.Cmp(new(big.Int).Rsh(order, 1)) <= 0 {
+		s = new(big.Int).Sub(order, s)
+	}
+	highS, _ := asn1.Marshal(ecdsaSignature{R: r, S: s})
+
+	lowS, err := toLowS(identity, highS)
+	if err != nil {
+		t.Fatalf("toLowS return error: %s", err)
+	}
+	sig := &ecdsaSignature{}
+	if _, err := asn1.Unmarshal(lowS, sig); err != nil {
+		t.Fatalf("Unmarshal return error: %s", err)
+	}
+	if sig.S.Cmp(new(big.Int).Rsh(order, 1)) > 0 {
+		t.Fatalf("toLowS should return the low-S form")
+	}
+	if !ecdsa.Verify(&key.PublicKey, digest[:], sig.R, sig.S) {
+		t.Fatalf("Low-S signature should be valid")
+	}
+
+	// signatures of identities without an ECDSA certificate are kept
+	other, _ := serializeIdentity(user, []byte("ecert"))
+	if kept, err := toLowS(other, highS); err != nil || string(kept) != string(highS) {
+		t.Fatalf("toLowS should keep the signature of an unknown key: %v", err)
+	}
+	if _, err := toLowS(identity, []byte("not a signature")); err == nil {
+		t.Fatalf("toLowS should fail for an invalid signature")
+	}
+}
+
+func TestBCCSPSignerRSA(t *testing.T) {
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %s", err)
+	}
+	cryptoSuite := bccspFactory.GetDefault()
+	key, err := cryptoSuite.KeyGen(&bccsp.RSA2048KeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error: %s", err)
+	}
+	signer, err := NewBCCSPSigner(cryptoSuite, key, []byte("identity"))
+	if err != nil {
+		t.Fatalf("NewBCCSPSigner return error: %s", err)
+	}
+	digest, _ := cryptoSuite.Hash([]byte("test"), &bccsp.SHA256Opts{})
+	signature, err := signer.Sign(digest)
+	if err != nil {
+		t.Fatalf("Sign return error: %s", err)
+	}
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	if valid, err := cryptoSuite.Verify(key, signature, digest, opts); err != nil || !valid {
+		t.Fatalf("RSA signature should be a valid PSS signature: %v", err)
+	}
+}
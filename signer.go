@@ -0,0 +1,346 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+// Signer ...
+/**
+ * A Signer signs on behalf of an identity without exposing its private key,
+ * so that signatures can come from an HSM or a remote signing service.
+ * Sign signs a digest, Serialize returns the identity that signatures are
+ * verified against, as a serialized MSP identity (msp.SerializedIdentity).
+ */
+type Signer interface {
+	Sign(digest []byte) ([]byte, error)
+	Serialize() ([]byte, error)
+}
+
+type bccspSigner struct {
+	cryptoSuite bccsp.BCCSP
+	key         bccsp.Key
+	identity    []byte
+}
+
+// NewBCCSPSigner ...
+/**
+ * Returns a Signer that signs with a key of a crypto suite.
+ * @param {bccsp.BCCSP} cryptoSuite the key belongs to
+ * @param {bccsp.Key} key the private key
+ * @param {[]byte} identity the serialized identity of the key's certificate
+ */
+func NewBCCSPSigner(cryptoSuite bccsp.BCCSP, key bccsp.Key, identity []byte) (Signer, error) {
+	if cryptoSuite == nil {
+		return nil, fmt.Errorf("cryptoSuite is nil")
+	}
+	return &bccspSigner{cryptoSuite: cryptoSuite, key: key, identity: identity}, nil
+}
+
+// Sign signs with PSS for RSA keys, and returns ECDSA signatures in
+// low-S form
+func (s *bccspSigner) Sign(digest []byte) ([]byte, error) {
+	opts, err := getSignerOpts(s.key)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := s.cryptoSuite.Sign(s.key, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	if publicKey, ok := getPublicKey(s.key).(*ecdsa.PublicKey); ok {
+		return ecdsaToLowS(publicKey.Curve, signature)
+	}
+	return signature, nil
+}
+
+func (s *bccspSigner) Serialize() ([]byte, error) {
+	return s.identity, nil
+}
+
+type rsaKeySigner struct {
+	key      *rsa.PrivateKey
+	identity []byte
+}
+
+// newRSAKeySigner returns a Signer that signs with an RSA key held in
+// memory, for crypto suites that can't import RSA private keys
+func newRSAKeySigner(key *rsa.PrivateKey, identity []byte) Signer {
+	return &rsaKeySigner{key: key, identity: identity}
+}
+
+// Sign signs with PSS, as bccspSigner does for RSA keys
+func (s *rsaKeySigner) Sign(digest []byte) ([]byte, error) {
+	_, hash, err := getHashOpts()
+	if err != nil {
+		return nil, err
+	}
+	return rsa.SignPSS(rand.Reader, s.key, hash, digest,
+		&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash})
+}
+
+func (s *rsaKeySigner) Serialize() ([]byte, error) {
+	return s.identity, nil
+}
+
+// signerRequest and signerResponse are the messages exchanged with an
+// out-of-process signer, one JSON request and response per connection
+type signerRequest struct {
+	Method string `json:"method"`
+	Digest []byte `json:"digest,omitempty"`
+	// Secret authenticates the requesting process, see ServeSigner
+	Secret []byte `json:"secret"`
+}
+
+type signerResponse struct {
+	Signature []byte `json:"signature,omitempty"`
+	Identity  []byte `json:"identity,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+const (
+	signMethod      = "sign"
+	serializeMethod = "serialize"
+)
+
+// minSignerSecretSize is the minimum size of the secret shared by a
+// signing process and its socket signers
+const minSignerSecretSize = 16
+
+// signerConnTimeout bounds the time ServeSigner spends on a connection,
+// and maxSignerRequestSize the size of the request it reads from it
+const (
+	signerConnTimeout    = 30 * time.Second
+	maxSignerRequestSize = 64 * 1024
+)
+
+type socketSigner struct {
+	network string
+	address string
+	secret  []byte
+	timeout time.Duration
+}
+
+// NewSocketSigner ...
+/**
+ * Returns a Signer that forwards requests to an out-of-process signer
+ * listening on a local socket, such as one served by ServeSigner.
+ * @param {string} network "unix", or "tcp" for a loopback address
+ * @param {string} address of the socket
+ * @param {[]byte} secret shared with the signing process, see ServeSigner
+ * @param {time.Duration} timeout of each request
+ */
+func NewSocketSigner(network string, address string, secret []byte, timeout time.Duration) (Signer, error) {
+	if err := checkSignerAddress(network, address); err != nil {
+		return nil, err
+	}
+	if len(secret) < minSignerSecretSize {
+		return nil, fmt.Errorf("secret must be at least %d bytes", minSignerSecretSize)
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive")
+	}
+	return &socketSigner{network: network, address: address, secret: secret, timeout: timeout}, nil
+}
+
+func (s *socketSigner) Sign(digest []byte) ([]byte, error) {
+	resp, err := s.call(&signerRequest{Method: signMethod, Digest: digest, Secret: s.secret})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Signature) == 0 {
+		return nil, fmt.Errorf("Signer returned an empty signature")
+	}
+	return resp.Signature, nil
+}
+
+func (s *socketSigner) Serialize() ([]byte, error) {
+	resp, err := s.call(&signerRequest{Method: serializeMethod, Secret: s.secret})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Identity, nil
+}
+
+func (s *socketSigner) call(req *signerRequest) (*signerResponse, error) {
+	conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to signer at %s: %v", s.address, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("Could not send request to signer: %v", err)
+	}
+	resp := &signerResponse{}
+	if err := json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, fmt.Errorf("Could not read response of signer: %v", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("Signer returned error: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// ListenSigner ...
+/**
+ * Listen for socket signers on a local socket, to be served by ServeSigner.
+ * A unix socket must be created in a directory that only the signing
+ * process's user can access, e.g. created with os.MkdirAll(dir, 0700),
+ * so that no other user can connect to it before ServeSigner restricts
+ * access to the socket itself.
+ * @param {string} network "unix", or "tcp" for a loopback address
+ * @param {string} address of the socket
+ */
+func ListenSigner(network string, address string) (net.Listener, error) {
+	if err := checkSignerAddress(network, address); err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if err := checkSignerSocketDir(address); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// ServeSigner ...
+/**
+ * Serve the requests of socket signers (see NewSocketSigner) with signer,
+ * until the listener is closed. This runs in the signing process.
+ * Any process that can connect to the socket could have any digest signed,
+ * so requests must carry the secret shared with the socket signers, and
+ * the socket must be local: a unix socket in a directory accessible to the
+ * signing process's user only (see ListenSigner), which is made accessible
+ * to that user only as well, or a loopback TCP address, which any local
+ * user can connect to. The secret must be kept from other processes, e.g.
+ * in a file only readable by the users of the signer. Processes running
+ * as root, or as the signing process's user, can still read the secret.
+ * @param {net.Listener} listener on a local socket, see ListenSigner
+ * @param {Signer} signer that signs the requests
+ * @param {[]byte} secret that requests must carry, at least 16 bytes
+ */
+func ServeSigner(listener net.Listener, signer Signer, secret []byte) error {
+	addr := listener.Addr()
+	if err := checkSignerAddress(addr.Network(), addr.String()); err != nil {
+		return err
+	}
+	if len(secret) < minSignerSecretSize {
+		return fmt.Errorf("secret must be at least %d bytes", minSignerSecretSize)
+	}
+	if addr.Network() == "unix" {
+		if err := checkSignerSocketDir(addr.String()); err != nil {
+			return err
+		}
+		if err := os.Chmod(addr.String(), 0600); err != nil {
+			return fmt.Errorf("Could not restrict access to signer socket %s: %v", addr, err)
+		}
+	}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serveSignerConn(conn, signer, secret)
+	}
+}
+
+func serveSignerConn(conn net.Conn, signer Signer, secret []byte) {
+	defer conn.Close()
+	// a client that stalls or sends an endless request must not hold
+	// the connection, nor the memory of its request
+	conn.SetDeadline(time.Now().Add(signerConnTimeout))
+	req := &signerRequest{}
+	if err := json.NewDecoder(io.LimitReader(conn, maxSignerRequestSize)).Decode(req); err != nil {
+		logger.Warningf("Could not read signer request: %v", err)
+		return
+	}
+	resp := &signerResponse{}
+	if subtle.ConstantTimeCompare(req.Secret, secret) != 1 {
+		logger.Warningf("Rejected signer request with a wrong secret")
+		resp.Error = "Request is not authorized"
+		sendSignerResponse(conn, resp)
+		return
+	}
+	var err error
+	switch req.Method {
+	case signMethod:
+		resp.Signature, err = signer.Sign(req.Digest)
+	case serializeMethod:
+		resp.Identity, err = signer.Serialize()
+	default:
+		err = fmt.Errorf("Unknown method %s", req.Method)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	sendSignerResponse(conn, resp)
+}
+
+func sendSignerResponse(conn net.Conn, resp *signerResponse) {
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		logger.Warningf("Could not send signer response: %v", err)
+	}
+}
+
+// checkSignerSocketDir checks that the directory of a unix signer socket
+// is only accessible to its owner
+func checkSignerSocketDir(address string) error {
+	dir := filepath.Dir(address)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("Could not check the directory of signer socket %s: %v", address, err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("Directory %s of signer socket is accessible to other users, its mode is %s", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+// checkSignerAddress checks that a signer address is a local socket
+func checkSignerAddress(network string, address string) error {
+	if network != "unix" && network != "tcp" {
+		return fmt.Errorf("Unsupported network %s, the signer must be on a local socket", network)
+	}
+	if network == "tcp" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("Invalid signer address %s: %v", address, err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return fmt.Errorf("Signer address %s is not a loopback address", address)
+		}
+	}
+	return nil
+}
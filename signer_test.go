@@ -0,0 +1,198 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+)
+
+// failingSigner fails every request
+type failingSigner struct{}
+
+func (s *failingSigner) Sign(digest []byte) ([]byte, error) {
+	return nil, fmt.Errorf("key is locked")
+}
+
+func (s *failingSigner) Serialize() ([]byte, error) {
+	return nil, fmt.Errorf("key is locked")
+}
+
+var testSignerSecret = []byte("0123456789abcdef")
+
+// startTestSigner serves signer on a unix socket, it returns the socket's
+// address and a function stopping the signer
+func startTestSigner(t *testing.T, signer Signer) (string, func()) {
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatalf("TempDir return error: %s", err)
+	}
+	address := filepath.Join(dir, "signer.sock")
+	listener, err := ListenSigner("unix", address)
+	if err != nil {
+		t.Fatalf("ListenSigner return error: %s", err)
+	}
+	go ServeSigner(listener, signer, testSignerSecret)
+	return address, func() {
+		listener.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSocketSigner(t *testing.T) {
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %s", err)
+	}
+	cryptoSuite := bccspFactory.GetDefault()
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error: %s", err)
+	}
+	if _, err := NewBCCSPSigner(nil, key, nil); err == nil {
+		t.Fatalf("NewBCCSPSigner should fail without crypto suite")
+	}
+	keySigner, err := NewBCCSPSigner(cryptoSuite, key, []byte("identity"))
+	if err != nil {
+		t.Fatalf("NewBCCSPSigner return error: %s", err)
+	}
+	address, stop := startTestSigner(t, keySigner)
+	defer stop()
+
+	signer, err := NewSocketSigner("unix", address, testSignerSecret, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewSocketSigner return error: %s", err)
+	}
+	identity, err := signer.Serialize()
+	if err != nil || string(identity) != "identity" {
+		t.Fatalf("Serialize should return the signer's identity, got %s: %v", identity, err)
+	}
+	digest, _ := cryptoSuite.Hash([]byte("test"), &bccsp.SHAOpts{})
+	signature, err := signer.Sign(digest)
+	if err != nil {
+		t.Fatalf("Sign return error: %s", err)
+	}
+	if valid, err := cryptoSuite.Verify(key, signature, digest, nil); err != nil || !valid {
+		t.Fatalf("Signature of the socket signer should be valid for the key: %v", err)
+	}
+
+	// errors of the signing process are returned
+	failingAddress, stopFailing := startTestSigner(t, &failingSigner{})
+	defer stopFailing()
+	signer, _ = NewSocketSigner("unix", failingAddress, testSignerSecret, 5*time.Second)
+	if _, err := signer.Sign(digest); err == nil {
+		t.Fatalf("Sign should return the error of the signing process")
+	}
+
+	if _, err := NewSocketSigner("tcp", "10.0.0.1:7000", testSignerSecret, time.Second); err == nil {
+		t.Fatalf("NewSocketSigner should fail for a remote address")
+	}
+	if _, err := NewSocketSigner("tcp", "127.0.0.1:7000", testSignerSecret, 0); err == nil {
+		t.Fatalf("NewSocketSigner should fail for a timeout of 0")
+	}
+	signer, _ = NewSocketSigner("unix", address+".missing", testSignerSecret, time.Second)
+	if _, err := signer.Sign(digest); err == nil {
+		t.Fatalf("Sign should fail when the signer isn't listening")
+	}
+}
+
+func TestServeSignerAuthentication(t *testing.T) {
+	address, stop := startTestSigner(t, &failingSigner{})
+	defer stop()
+
+	// wait for ServeSigner to restrict access to the socket
+	for i := 0; ; i++ {
+		info, err := os.Stat(address)
+		if err == nil && info.Mode().Perm() == 0600 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("The signer socket should only be accessible to its user, got %v %v", info, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := NewSocketSigner("unix", address, []byte("short"), time.Second); err == nil {
+		t.Fatalf("NewSocketSigner should fail for a short secret")
+	}
+	signer, _ := NewSocketSigner("unix", address, []byte("fedcba9876543210"), 5*time.Second)
+	if _, err := signer.Serialize(); err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Fatalf("Requests with a wrong secret should be rejected, got %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen return error: %s", err)
+	}
+	defer listener.Close()
+	if err := ServeSigner(listener, &failingSigner{}, nil); err == nil {
+		t.Fatalf("ServeSigner should fail without secret")
+	}
+
+	// requests are read up to a limit
+	conn, err := net.Dial("unix", address)
+	if err != nil {
+		t.Fatalf("Dial return error: %s", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte(`{"method":"serialize","digest":"` + strings.Repeat("A", maxSignerRequestSize)))
+	// the connection is closed, or reset as the rest of the request is unread
+	if resp, _ := ioutil.ReadAll(conn); len(resp) != 0 {
+		t.Fatalf("Oversized requests should be dropped, got %s", resp)
+	}
+}
+
+func TestListenSignerDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatalf("TempDir return error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatalf("Chmod return error: %s", err)
+	}
+	address := filepath.Join(dir, "signer.sock")
+	if _, err := ListenSigner("unix", address); err == nil {
+		t.Fatalf("ListenSigner should fail in a directory accessible to other users")
+	}
+
+	// a socket created elsewhere in such a directory isn't served either
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatalf("Listen return error: %s", err)
+	}
+	defer listener.Close()
+	if err := ServeSigner(listener, &failingSigner{}, testSignerSecret); err == nil {
+		t.Fatalf("ServeSigner should fail in a directory accessible to other users")
+	}
+
+	if _, err := ListenSigner("tcp", "10.0.0.1:0"); err == nil {
+		t.Fatalf("ListenSigner should fail for a remote address")
+	}
+}
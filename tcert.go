@@ -0,0 +1,164 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+// TCert ...
+/**
+ * A transaction certificate (TCert) and its private key. TCerts are issued
+ * in batches by the CA for an enrolled user; signing each transaction with a
+ * different TCert makes the user's transactions unlinkable.
+ */
+type TCert struct {
+	// PEM encoded certificate
+	Certificate []byte
+	PrivateKey  bccsp.Key
+}
+
+// TCertFetcher ...
+/**
+ * A TCertFetcher obtains batches of TCerts for a user from a CA.
+ * msp.Services implements it with the fabric-ca client.
+ */
+type TCertFetcher interface {
+	GetTCertBatch(user User, count int, attributes []string) ([]*TCert, error)
+}
+
+// TCertPool ...
+/**
+ * The TCertPool holds TCerts of a user, all carrying the same attributes.
+ * TCerts are fetched in batches; when the pool runs low it is refilled in
+ * the background, and when it is empty GetTCert fetches a batch and waits.
+ */
+type TCertPool struct {
+	user       User
+	attributes []string
+	mtx        sync.Mutex
+	batchSize  int
+	tcerts     []*TCert
+	refilling  bool
+}
+
+// NewTCertPool ...
+/**
+ * @param {User} user the TCerts are issued to, it must have a TCertFetcher
+ * @param {int} batchSize the number of TCerts to fetch at once
+ * @param {[]string} attributes to include in the TCerts
+ */
+func NewTCertPool(user User, batchSize int, attributes []string) (*TCertPool, error) {
+	if user == nil {
+		return nil, fmt.Errorf("user is nil")
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("TCert batch size must be positive, got %d", batchSize)
+	}
+	return &TCertPool{user: user, batchSize: batchSize, attributes: attributes}, nil
+}
+
+// GetUser ...
+/**
+ * Get the user the TCerts are issued to.
+ */
+func (p *TCertPool) GetUser() User {
+	return p.user
+}
+
+// SetBatchSize ...
+/**
+ * Set the number of TCerts fetched by the next refills.
+ */
+func (p *TCertPool) SetBatchSize(batchSize int) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("TCert batch size must be positive, got %d", batchSize)
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.batchSize = batchSize
+	return nil
+}
+
+// Size ...
+/**
+ * Get the number of TCerts available in the pool.
+ */
+func (p *TCertPool) Size() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return len(p.tcerts)
+}
+
+// GetTCert ...
+/**
+ * Take a TCert out of the pool. Each TCert is returned only once.
+ */
+func (p *TCertPool) GetTCert() (*TCert, error) {
+	p.mtx.Lock()
+	if len(p.tcerts) == 0 {
+		batchSize := p.batchSize
+		p.mtx.Unlock()
+		tcerts, err := p.fetch(batchSize)
+		if err != nil {
+			return nil, err
+		}
+		p.mtx.Lock()
+		p.tcerts = append(p.tcerts, tcerts...)
+	}
+	defer p.mtx.Unlock()
+
+	tcert := p.tcerts[0]
+	p.tcerts[0] = nil
+	p.tcerts = p.tcerts[1:]
+	// refill before running out, so that callers seldom wait for the CA
+	if len(p.tcerts) <= p.batchSize/4 && !p.refilling {
+		p.refilling = true
+		go p.refill(p.batchSize)
+	}
+	return tcert, nil
+}
+
+func (p *TCertPool) refill(batchSize int) {
+	tcerts, err := p.fetch(batchSize)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.refilling = false
+	if err != nil {
+		logger.Warningf("Could not refill the TCert pool of user %s: %s", p.user.GetName(), err)
+		return
+	}
+	p.tcerts = append(p.tcerts, tcerts...)
+}
+
+func (p *TCertPool) fetch(batchSize int) ([]*TCert, error) {
+	tcerts, err := p.user.GenerateTcerts(batchSize, p.attributes)
+	if err != nil {
+		return nil, err
+	}
+	if len(tcerts) == 0 {
+		return nil, fmt.Errorf("No TCert returned for user %s", p.user.GetName())
+	}
+	return tcerts, nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+)
+
+// mockTCertFetcher issues TCerts with generated keys
+type mockTCertFetcher struct {
+	mtx        sync.Mutex
+	batches    []int
+	attributes []string
+	issued     int
+	keys       map[string]bccsp.Key
+}
+
+func (f *mockTCertFetcher) GetTCertBatch(user User, count int, attributes []string) ([]*TCert, error) {
+	cryptoSuite := bccspFactory.GetDefault()
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.batches = append(f.batches, count)
+	f.attributes = attributes
+	var tcerts []*TCert
+	for i := 0; i < count; i++ {
+		key, err := cryptoSuite.KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+		if err != nil {
+			return nil, err
+		}
+		f.issued++
+		cert := fmt.Sprintf("tcert-%d of %s", f.issued, user.GetName())
+		f.keys[cert] = key
+		tcerts = append(tcerts, &TCert{Certificate: []byte(cert), PrivateKey: key})
+	}
+	return tcerts, nil
+}
+
+func (f *mockTCertFetcher) getBatches() []int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return append([]int(nil), f.batches...)
+}
+
+func newTestTCertUser(t *testing.T, name string) (User, *mockTCertFetcher) {
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %s", err)
+	}
+	key, err := bccspFactory.GetDefault().KeyGen(&bccsp.ECDSAP256KeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error: %s", err)
+	}
+	user := NewUser(name)
+	user.SetEnrollmentCertificate([]byte("ecert"))
+	user.SetPrivateKey(key)
+	fetcher := &mockTCertFetcher{keys: make(map[string]bccsp.Key)}
+	user.SetTCertFetcher(fetcher)
+	return user, fetcher
+}
+
+func TestGenerateTcerts(t *testing.T) {
+	user, fetcher := newTestTCertUser(t, "user1")
+	tcerts, err := user.GenerateTcerts(3, []string{"role"})
+	if err != nil {
+		t.Fatalf("GenerateTcerts return error: %s", err)
+	}
+	if len(tcerts) != 3 || len(fetcher.attributes) != 1 || fetcher.attributes[0] != "role" {
+		t.Fatalf("GenerateTcerts didn't request the right batch")
+	}
+	if _, err := user.GenerateTcerts(0, nil); err == nil {
+		t.Fatalf("GenerateTcerts should fail for a count of 0")
+	}
+	if _, err := NewUser("user2").GenerateTcerts(1, nil); err == nil {
+		t.Fatalf("GenerateTcerts should fail without a TCert fetcher")
+	}
+}
+
+func TestTCertPool(t *testing.T) {
+	user, fetcher := newTestTCertUser(t, "user1")
+	if _, err := NewTCertPool(user, 0, nil); err == nil {
+		t.Fatalf("NewTCertPool should fail for a batch size of 0")
+	}
+	pool, err := NewTCertPool(user, 4, nil)
+	if err != nil {
+		t.Fatalf("NewTCertPool return error: %s", err)
+	}
+	// batches are fetched with the current batch size
+	if err := pool.SetBatchSize(8); err != nil {
+		t.Fatalf("SetBatchSize return error: %s", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		tcert, err := pool.GetTCert()
+		if err != nil {
+			t.Fatalf("GetTCert return error: %s", err)
+		}
+		if seen[string(tcert.Certificate)] {
+			t.Fatalf("GetTCert returned %s twice", tcert.Certificate)
+		}
+		seen[string(tcert.Certificate)] = true
+	}
+
+	for _, batch := range fetcher.getBatches() {
+		if batch != 8 {
+			t.Fatalf("pool fetched a batch of %d TCerts instead of 8", batch)
+		}
+	}
+
+	// a new pool fetches its first batch, and refills in the background
+	// once a quarter of the batch is left
+	user, fetcher = newTestTCertUser(t, "user2")
+	pool, err = NewTCertPool(user, 4, nil)
+	if err != nil {
+		t.Fatalf("NewTCertPool return error: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := pool.GetTCert(); err != nil {
+			t.Fatalf("GetTCert return error: %s", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Size() != 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pool.Size() != 5 || len(fetcher.getBatches()) != 2 {
+		t.Fatalf("pool wasn't refilled in the background, %d TCerts left", pool.Size())
+	}
+}
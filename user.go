@@ -20,6 +20,8 @@ limitations under the License.
 package fabricsdk
 
 import (
+	"fmt"
+
 	"github.com/hyperledger/fabric/bccsp"
 )
 
@@ -43,24 +45,34 @@ import (
  */
 type User interface {
 	GetName() string
+	GetMspID() string
+	SetMspID(mspID string)
 	GetRoles() []string
 	SetRoles([]string)
 	GetEnrollmentCertificate() []byte
 	SetEnrollmentCertificate(cert []byte)
 	SetPrivateKey(privateKey bccsp.Key)
 	GetPrivateKey() bccsp.Key
-	GenerateTcerts(count int, attributes []string)
+	SetSigner(signer Signer)
+	GetSigner() Signer
+	SetTCertFetcher(fetcher TCertFetcher)
+	GetTCertFetcher() TCertFetcher
+	GenerateTcerts(count int, attributes []string) ([]*TCert, error)
 }
 
 type user struct {
 	name                  string
+	mspID                 string
 	roles                 []string
 	PrivateKey            bccsp.Key // ****This key is temporary We use it to sign transaction until we have tcerts
 	enrollmentCertificate []byte
+	signer                Signer
+	tcertFetcher          TCertFetcher
 }
 
 // UserJSON ...
 type UserJSON struct {
+	MspID                 string
 	PrivateKeySKI         []byte
 	EnrollmentCertificate []byte
 }
@@ -84,6 +96,26 @@ func (u *user) GetName() string {
 	return u.name
 }
 
+// GetMspID ...
+/**
+ * Get the ID of the MSP (organization) that issued the user's enrollment certificate.
+ * Identities built for the user are attributed to this MSP. When it is empty,
+ * the MSP ID from the configuration is used.
+ * @returns {string} The MSP ID.
+ */
+func (u *user) GetMspID() string {
+	return u.mspID
+}
+
+// SetMspID ...
+/**
+ * Set the MSP ID.
+ * @param mspID {string} The MSP ID.
+ */
+func (u *user) SetMspID(mspID string) {
+	u.mspID = mspID
+}
+
 // GetRoles ...
 /**
  * Get the roles.
@@ -134,14 +166,58 @@ func (u *user) GetPrivateKey() bccsp.Key {
 	return u.PrivateKey
 }
 
+// SetSigner ...
+/**
+ * Set the signer of the user's transactions, e.g. an HSM or a remote signing
+ * service. It replaces the private key for signing.
+ */
+func (u *user) SetSigner(signer Signer) {
+	u.signer = signer
+}
+
+// GetSigner ...
+/**
+ * Get the signer set with SetSigner, nil if transactions are signed with
+ * the user's private key.
+ */
+func (u *user) GetSigner() Signer {
+	return u.signer
+}
+
+// SetTCertFetcher ...
+/**
+ * Set the service TCerts are obtained from, typically msp.Services.
+ */
+func (u *user) SetTCertFetcher(fetcher TCertFetcher) {
+	u.tcertFetcher = fetcher
+}
+
+// GetTCertFetcher ...
+/**
+ * Get the service set with SetTCertFetcher, nil if none is set.
+ */
+func (u *user) GetTCertFetcher() TCertFetcher {
+	return u.tcertFetcher
+}
+
 // GenerateTcerts ...
 /**
  * Gets a batch of TCerts to use for transaction. there is a 1-to-1 relationship between
- * TCert and Transaction. The TCert can be generated locally by the SDK using the user’s crypto materials.
+ * TCert and Transaction. The TCert private keys are derived locally by the SDK from the
+ * user’s private key, which must therefore be set.
  * @param {int} count how many in the batch to obtain
  * @param {[]string} attributes  list of attributes to include in the TCert
- * @return {[]tcert} An array of TCerts
+ * @return {[]*TCert} An array of TCerts
  */
-func (u *user) GenerateTcerts(count int, attributes []string) {
-
+func (u *user) GenerateTcerts(count int, attributes []string) ([]*TCert, error) {
+	if u.tcertFetcher == nil {
+		return nil, fmt.Errorf("No TCert fetcher set for user %s", u.name)
+	}
+	if count <= 0 {
+		return nil, fmt.Errorf("TCert count must be positive, got %d", count)
+	}
+	if u.PrivateKey == nil || len(u.enrollmentCertificate) == 0 {
+		return nil, fmt.Errorf("User %s is not enrolled", u.name)
+	}
+	return u.tcertFetcher.GetTCertBatch(u, count, attributes)
 }
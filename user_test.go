@@ -40,4 +40,9 @@ func TestUserMethods(t *testing.T) {
 		t.Fatalf("user.GetRoles() return wrong user")
 	}
 
+	user.SetMspID("Org1MSP")
+	if user.GetMspID() != "Org1MSP" {
+		t.Fatalf("user.GetMspID() return wrong MSP ID")
+	}
+
 }
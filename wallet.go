@@ -0,0 +1,365 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+// Wallet ...
+/**
+ * A Wallet holds the identities an application can act as, each one
+ * under a label. Identities are kept in a portable form (PEM certificate
+ * and private key) and are turned into a User by importing the private
+ * key into a crypto suite.
+ */
+type Wallet interface {
+	Put(identity *WalletIdentity) error
+	Get(label string) (*WalletIdentity, error)
+	List() ([]string, error)
+	Remove(label string) error
+}
+
+// WalletIdentity ...
+/**
+ * The WalletIdentity is the content of a wallet entry. Its JSON encoding
+ * is the wallet's export format.
+ */
+type WalletIdentity struct {
+	Label string   `json:"label"`
+	MspID string   `json:"mspId"`
+	Roles []string `json:"roles,omitempty"`
+	// PEM encoded enrollment certificate
+	Certificate []byte `json:"certificate"`
+	// PEM encoded PKCS#8 private key
+	PrivateKey []byte `json:"privateKey"`
+}
+
+// NewWalletIdentity ...
+/**
+ * Create a wallet identity from a PEM encoded certificate and private key.
+ * The key can be a PKCS#8 or a SEC1 (EC PRIVATE KEY) key, it is stored as
+ * PKCS#8. Fails if the key doesn't match the certificate.
+ * @param {string} label of the identity in the wallet
+ * @param {string} mspID of the organization that issued the certificate
+ * @param {[]byte} certPEM the enrollment certificate
+ * @param {[]byte} keyPEM the private key
+ */
+func NewWalletIdentity(label string, mspID string, certPEM []byte, keyPEM []byte) (*WalletIdentity, error) {
+	if label == "" {
+		return nil, fmt.Errorf("label is empty")
+	}
+	cert, err := parseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !keyMatchesCertificate(key, cert) {
+		return nil, fmt.Errorf("private key doesn't match the certificate")
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal private key: %v", err)
+	}
+	return &WalletIdentity{Label: label, MspID: mspID,
+		Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})}, nil
+}
+
+// ImportWalletIdentity ...
+/**
+ * Create a wallet identity from the JSON returned by Export.
+ */
+func ImportWalletIdentity(data []byte) (*WalletIdentity, error) {
+	identity := &WalletIdentity{}
+	if err := json.Unmarshal(data, identity); err != nil {
+		return nil, fmt.Errorf("Unmarshal json return error: %v", err)
+	}
+	// validates and normalizes the certificate and key
+	imported, err := NewWalletIdentity(identity.Label, identity.MspID, identity.Certificate, identity.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	imported.Roles = identity.Roles
+	return imported, nil
+}
+
+// Export ...
+/**
+ * Export the identity as portable JSON.
+ * @returns {[]byte} JSON containing the certificate and private key in PEM
+ */
+func (id *WalletIdentity) Export() ([]byte, error) {
+	data, err := json.Marshal(id)
+	if err != nil {
+		return nil, fmt.Errorf("Marshal json return error: %v", err)
+	}
+	return data, nil
+}
+
+// CreateUser ...
+/**
+ * Create a User for the identity by importing the private key into the
+ * crypto suite. Unless temporary is true, the key is stored in the crypto
+ * suite's key store so that the user can be saved with Client.SetUserContext.
+ * The crypto suite can't import RSA private keys: the user of an RSA
+ * identity signs with the key held in memory, and can't be saved.
+ * @param {bccsp.BCCSP} cryptoSuite the key is imported into
+ * @param {bool} temporary true to keep the key in memory only
+ * @returns {User} a user named after the identity label
+ */
+func (id *WalletIdentity) CreateUser(cryptoSuite bccsp.BCCSP, temporary bool) (User, error) {
+	if cryptoSuite == nil {
+		return nil, fmt.Errorf("cryptoSuite is nil")
+	}
+	block, _ := pem.Decode(id.PrivateKey)
+	if block == nil {
+		return nil, fmt.Errorf("private key of identity %s is not PEM encoded", id.Label)
+	}
+	privateKey, err := parsePrivateKeyPEM(id.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("identity %s: %v", id.Label, err)
+	}
+	user := NewUser(id.Label)
+	user.SetMspID(id.MspID)
+	user.SetEnrollmentCertificate(id.Certificate)
+	user.SetRoles(id.Roles)
+
+	switch k := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		key, err := cryptoSuite.KeyImport(block.Bytes, &bccsp.ECDSAPrivateKeyImportOpts{Temporary: temporary})
+		if err != nil {
+			return nil, fmt.Errorf("KeyImport return error: %v", err)
+		}
+		user.SetPrivateKey(key)
+	case *rsa.PrivateKey:
+		creatorID, err := getSerializedIdentity(user)
+		if err != nil {
+			return nil, err
+		}
+		user.SetSigner(newRSAKeySigner(k, creatorID))
+	default:
+		return nil, fmt.Errorf("private key of identity %s has unsupported type %T", id.Label, privateKey)
+	}
+	return user, nil
+}
+
+type inMemoryWallet struct {
+	mtx        sync.RWMutex
+	identities map[string]*WalletIdentity
+}
+
+// NewInMemoryWallet ...
+/**
+ * Returns a Wallet that keeps identities in memory only.
+ */
+func NewInMemoryWallet() Wallet {
+	return &inMemoryWallet{identities: make(map[string]*WalletIdentity)}
+}
+
+func (w *inMemoryWallet) Put(identity *WalletIdentity) error {
+	if err := validateWalletIdentity(identity); err != nil {
+		return err
+	}
+	copied := *identity
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.identities[identity.Label] = &copied
+	return nil
+}
+
+func (w *inMemoryWallet) Get(label string) (*WalletIdentity, error) {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+	identity, ok := w.identities[label]
+	if !ok {
+		return nil, nil
+	}
+	copied := *identity
+	return &copied, nil
+}
+
+func (w *inMemoryWallet) List() ([]string, error) {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+	var labels []string
+	for label := range w.identities {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+func (w *inMemoryWallet) Remove(label string) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if _, ok := w.identities[label]; !ok {
+		return fmt.Errorf("identity %s not found in wallet", label)
+	}
+	delete(w.identities, label)
+	return nil
+}
+
+// walletKeyPrefix is the prefix of the keys of wallet identities, so that
+// a wallet can share its KeyValueStore with other entries
+const walletKeyPrefix = "wallet."
+
+// storeWallet keeps the exported identities in a KeyValueStore
+type storeWallet struct {
+	store kvs.KeyValueStore
+}
+
+// NewFileWallet ...
+/**
+ * Returns a Wallet that saves each identity as a JSON file in a directory.
+ * @param {string} path of the wallet directory
+ */
+func NewFileWallet(path string) (Wallet, error) {
+	store, err := kvs.CreateNewFileKeyValueStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewStoreWallet(store), nil
+}
+
+// NewStoreWallet ...
+/**
+ * Returns a Wallet that saves identities in a KeyValueStore, for example
+ * an EncryptedKeyValueStore to keep private keys encrypted at rest. The
+ * identities are saved under keys prefixed with "wallet.", entries of the
+ * store that don't have the prefix aren't part of the wallet.
+ */
+func NewStoreWallet(store kvs.KeyValueStore) Wallet {
+	return &storeWallet{store: store}
+}
+
+func (w *storeWallet) Put(identity *WalletIdentity) error {
+	if err := validateWalletIdentity(identity); err != nil {
+		return err
+	}
+	data, err := identity.Export()
+	if err != nil {
+		return err
+	}
+	return w.store.SetValue(walletKeyPrefix+identity.Label, data)
+}
+
+func (w *storeWallet) Get(label string) (*WalletIdentity, error) {
+	data, err := w.store.GetValue(walletKeyPrefix + label)
+	if kvs.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("store GetValue return error: %v", err)
+	}
+	identity := &WalletIdentity{}
+	if err := json.Unmarshal(data, identity); err != nil {
+		return nil, fmt.Errorf("Unmarshal json return error: %v", err)
+	}
+	return identity, nil
+}
+
+func (w *storeWallet) List() ([]string, error) {
+	keys, err := w.store.ListKeys(walletKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var labels []string
+	for _, key := range keys {
+		labels = append(labels, strings.TrimPrefix(key, walletKeyPrefix))
+	}
+	return labels, nil
+}
+
+func (w *storeWallet) Remove(label string) error {
+	err := w.store.DeleteValue(walletKeyPrefix + label)
+	if kvs.IsKeyNotFound(err) {
+		return fmt.Errorf("identity %s not found in wallet", label)
+	}
+	return err
+}
+
+func validateWalletIdentity(identity *WalletIdentity) error {
+	if identity == nil {
+		return fmt.Errorf("identity is nil")
+	}
+	if identity.Label == "" {
+		return fmt.Errorf("label is empty")
+	}
+	if len(identity.Certificate) == 0 || len(identity.PrivateKey) == 0 {
+		return fmt.Errorf("identity %s has no certificate or private key", identity.Label)
+	}
+	return nil
+}
+
+func parseCertificatePEM(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("certificate is not a PEM encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse certificate: %v", err)
+	}
+	return cert, nil
+}
+
+// parsePrivateKeyPEM parses a PKCS#8 or SEC1 private key
+func parsePrivateKeyPEM(keyPEM []byte) (interface{}, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return nil, fmt.Errorf("private key is not a PEM encoded private key")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("private key is neither a PKCS#8 nor a SEC1 key")
+}
+
+// keyMatchesCertificate checks that key is the private key of the
+// certificate's public key
+func keyMatchesCertificate(key interface{}, cert *x509.Certificate) bool {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		return ok && pub.Curve == k.Curve && pub.X.Cmp(k.X) == 0 && pub.Y.Cmp(k.Y) == 0
+	case *rsa.PrivateKey:
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		return ok && pub.E == k.E && pub.N.Cmp(k.N) == 0
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+
+	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
+)
+
+func TestWalletIdentityImport(t *testing.T) {
+	certPEM, key := createTestCertificate(t)
+	sec1, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey return error: %s", err)
+	}
+	sec1PEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey return error: %s", err)
+	}
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+
+	fromSEC1, err := NewWalletIdentity("user1", "Org1MSP", certPEM, sec1PEM)
+	if err != nil {
+		t.Fatalf("NewWalletIdentity with SEC1 key return error: %s", err)
+	}
+	fromPKCS8, err := NewWalletIdentity("user1", "Org1MSP", certPEM, pkcs8PEM)
+	if err != nil {
+		t.Fatalf("NewWalletIdentity with PKCS#8 key return error: %s", err)
+	}
+	if !bytes.Equal(fromSEC1.PrivateKey, fromPKCS8.PrivateKey) {
+		t.Fatalf("private keys should be normalized to PKCS#8")
+	}
+
+	_, otherKey := createTestCertificate(t)
+	otherSEC1, _ := x509.MarshalECPrivateKey(otherKey)
+	otherPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherSEC1})
+	if _, err := NewWalletIdentity("user1", "Org1MSP", certPEM, otherPEM); err == nil {
+		t.Fatalf("NewWalletIdentity should fail when the key doesn't match the certificate")
+	}
+
+	fromSEC1.Roles = []string{"client"}
+	data, err := fromSEC1.Export()
+	if err != nil {
+		t.Fatalf("Export return error: %s", err)
+	}
+	imported, err := ImportWalletIdentity(data)
+	if err != nil {
+		t.Fatalf("ImportWalletIdentity return error: %s", err)
+	}
+	if imported.Label != "user1" || imported.MspID != "Org1MSP" || len(imported.Roles) != 1 {
+		t.Fatalf("imported identity has wrong content: %v", imported)
+	}
+
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %s", err)
+	}
+	user, err := imported.CreateUser(bccspFactory.GetDefault(), true)
+	if err != nil {
+		t.Fatalf("CreateUser return error: %s", err)
+	}
+	if user.GetName() != "user1" || user.GetMspID() != "Org1MSP" || user.GetPrivateKey() == nil ||
+		!bytes.Equal(user.GetEnrollmentCertificate(), certPEM) {
+		t.Fatalf("CreateUser returned wrong user")
+	}
+}
+
+func TestWalletRSAIdentity(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey return error: %s", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "user1"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error: %s", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	identity, err := NewWalletIdentity("user1", "Org1MSP", certPEM,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	if err != nil {
+		t.Fatalf("NewWalletIdentity return error: %s", err)
+	}
+
+	if err := bccspFactory.InitFactories(nil); err != nil {
+		t.Fatalf("InitFactories return error: %s", err)
+	}
+	user, err := identity.CreateUser(bccspFactory.GetDefault(), true)
+	if err != nil {
+		t.Fatalf("CreateUser return error: %s", err)
+	}
+	if user.GetSigner() == nil {
+		t.Fatalf("The user of an RSA identity should sign with a signer")
+	}
+	digest := sha256.Sum256([]byte("data"))
+	signature, err := user.GetSigner().Sign(digest[:])
+	if err != nil {
+		t.Fatalf("Sign return error: %s", err)
+	}
+	if err := rsa.VerifyPSS(&key.PublicKey, crypto.SHA256, digest[:], signature, nil); err != nil {
+		t.Fatalf("The signature should verify with the certificate's key: %s", err)
+	}
+}
+
+func TestWallets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatalf("TempDir return error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fileWallet, err := NewFileWallet(dir)
+	if err != nil {
+		t.Fatalf("NewFileWallet return error: %s", err)
+	}
+	// an unrelated entry of the wallet's store
+	store, err := kvs.CreateNewFileKeyValueStore(dir)
+	if err != nil {
+		t.Fatalf("CreateNewFileKeyValueStore return error: %s", err)
+	}
+	if err := store.SetValue("user0", []byte("{}")); err != nil {
+		t.Fatalf("SetValue return error: %s", err)
+	}
+
+	for _, wallet := range []Wallet{NewInMemoryWallet(), fileWallet} {
+		certPEM, key := createTestCertificate(t)
+		sec1, _ := x509.MarshalECPrivateKey(key)
+		identity, err := NewWalletIdentity("user1", "Org1MSP", certPEM,
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}))
+		if err != nil {
+			t.Fatalf("NewWalletIdentity return error: %s", err)
+		}
+		if err := wallet.Put(identity); err != nil {
+			t.Fatalf("Put return error: %s", err)
+		}
+		identity.Label = "user2"
+		if err := wallet.Put(identity); err != nil {
+			t.Fatalf("Put return error: %s", err)
+		}
+		if err := wallet.Put(&WalletIdentity{Label: "empty"}); err == nil {
+			t.Fatalf("Put should fail for an identity without certificate")
+		}
+
+		labels, err := wallet.List()
+		if err != nil || len(labels) != 2 || labels[0] != "user1" || labels[1] != "user2" {
+			t.Fatalf("List returned wrong labels: %v %v", labels, err)
+		}
+		got, err := wallet.Get("user1")
+		if err != nil || got == nil {
+			t.Fatalf("Get return error: %v", err)
+		}
+		if got.Label != "user1" || got.MspID != "Org1MSP" || !bytes.Equal(got.Certificate, certPEM) {
+			t.Fatalf("Get returned wrong identity: %v", got)
+		}
+		if got, err := wallet.Get("missing"); err != nil || got != nil {
+			t.Fatalf("Get should return nil for a missing label")
+		}
+
+		if err := wallet.Remove("user1"); err != nil {
+			t.Fatalf("Remove return error: %s", err)
+		}
+		if err := wallet.Remove("user1"); err == nil {
+			t.Fatalf("Remove should fail for a missing label")
+		}
+		labels, _ = wallet.List()
+		if len(labels) != 1 || labels[0] != "user2" {
+			t.Fatalf("List returned wrong labels after Remove: %v", labels)
+		}
+	}
+}
+
+// createTestCertificate creates a self-signed ECDSA certificate
+func createTestCertificate(t *testing.T) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error: %s", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "user1"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), key
+}